@@ -4,12 +4,16 @@ import (
 	"context"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/goddeuce1/tg_bot_tz/internal/bot"
+	"github.com/goddeuce1/tg_bot_tz/internal/drafts"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/invites"
 	"github.com/goddeuce1/tg_bot_tz/internal/kafka"
 	"github.com/goddeuce1/tg_bot_tz/internal/kafka/models"
 	"github.com/goddeuce1/tg_bot_tz/internal/kafka/producer"
 	"github.com/goddeuce1/tg_bot_tz/internal/repository"
 	"github.com/goddeuce1/tg_bot_tz/internal/repository/postgres"
 	"github.com/goddeuce1/tg_bot_tz/internal/repository/redis"
+	"github.com/goddeuce1/tg_bot_tz/internal/sla"
 	"github.com/goddeuce1/tg_bot_tz/internal/tickets"
 	"github.com/goddeuce1/tg_bot_tz/internal/workerpool"
 	"github.com/pkg/errors"
@@ -20,6 +24,16 @@ import (
 )
 
 func Run(ctx context.Context, logger *logrus.Logger) error {
+	// Message templates, validated before anything starts
+	messageFormat := os.Getenv("MESSAGE_FORMAT")
+	if messageFormat == "" {
+		messageFormat = i18n.FormatText
+	}
+
+	if err := i18n.Configure(os.Getenv("TEMPLATES_DIR"), messageFormat, logger); err != nil {
+		return errors.Wrap(err, "i18n.Configure")
+	}
+
 	// Postgres
 	db, err := postgres.NewRepository(ctx, logger)
 	if err != nil {
@@ -56,13 +70,20 @@ func Run(ctx context.Context, logger *logrus.Logger) error {
 		return errors.Wrap(err, "tgbotapi.NewBotAPI")
 	}
 
+	// Invites
+	if err = invites.Bootstrap(ctx, repo, botAPI.Self.UserName, logger); err != nil {
+		return errors.Wrap(err, "invites.Bootstrap")
+	}
+
+	ticketsHandler := tickets.NewHandler(repo, rdb, rdb, rdb, botAPI, logger)
+
 	// Kafka
 	kafkaData := models.KafkaData{
 		Brokers: []string{os.Getenv("KAFKA_BROKER")},
 		ConsumerData: &models.ConsumerData{
 			Group: "test_group",
 			TopicsWithHandlers: map[string]models.HandlerFunc{
-				"tickets": tickets.NewHandler(repo, botAPI, logger).Handle,
+				"tickets": ticketsHandler.Handle,
 			},
 		},
 	}
@@ -82,7 +103,23 @@ func Run(ctx context.Context, logger *logrus.Logger) error {
 	wg.Add(1)
 	go consumer.Start(ctx, wg)
 
-	tgBot, err := bot.NewBot(botAPI, repo, rdb, botPool, kafkaProducer, logger)
+	// Уведомления, отложенные до открытия подразделения
+	wg.Add(1)
+	go ticketsHandler.StartDeferred(ctx, wg)
+
+	// SLA
+	slaScheduler := sla.NewScheduler(repo, rdb, botAPI, logger)
+
+	wg.Add(1)
+	go slaScheduler.Start(ctx, wg)
+
+	// Напоминания о черновиках заявок
+	draftReminder := drafts.NewReminder(repo, rdb, botAPI, logger)
+
+	wg.Add(1)
+	go draftReminder.Start(ctx, wg)
+
+	tgBot, err := bot.NewBot(botAPI, repo, rdb, rdb, rdb, rdb, botPool, kafkaProducer, logger)
 	if err != nil {
 		return errors.Wrap(err, "bot.NewBot")
 	}
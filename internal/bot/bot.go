@@ -6,17 +6,20 @@ import (
 	"github.com/goddeuce1/tg_bot_tz/internal/bot/processor"
 	"github.com/goddeuce1/tg_bot_tz/internal/bot/processor/callback_processor"
 	"github.com/goddeuce1/tg_bot_tz/internal/bot/processor/message_processor"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
 	"github.com/goddeuce1/tg_bot_tz/internal/kafka/producer"
+	"github.com/goddeuce1/tg_bot_tz/internal/rbac"
 	"github.com/goddeuce1/tg_bot_tz/internal/repository"
 	"github.com/goddeuce1/tg_bot_tz/internal/repository/redis"
 	"github.com/goddeuce1/tg_bot_tz/internal/workerpool"
 	"github.com/sirupsen/logrus"
-	"os"
 	"sync"
 )
 
 type Bot struct {
 	botAPI            *tgbotapi.BotAPI
+	repo              repository.Repository
+	presence          redis.PresenceOperator
 	messageProcessor  processor.Processor
 	callbackProcessor processor.Processor
 	workerPool        workerpool.JobRunner
@@ -27,14 +30,24 @@ func NewBot(
 	botAPI *tgbotapi.BotAPI,
 	repo repository.Repository,
 	redisDB redis.StateOperator,
+	presence redis.PresenceOperator,
+	loginGuard redis.LoginGuardOperator,
+	timers redis.TimerOperator,
 	workerPool workerpool.JobRunner,
 	kafkaProducer producer.Producer,
 	logger *logrus.Logger,
 ) (*Bot, error) {
+	// Каждый апдейт проходит проверку прав по матрице ролей
+	authorizer := rbac.NewAuthorizer(repo)
+	messageProcessor := message_processor.NewMessageProcessor(repo, redisDB, presence, loginGuard, kafkaProducer, authorizer, logger)
+	callbackProcessor := callback_processor.NewCallbackProcessor(repo, timers, logger)
+
 	return &Bot{
 		botAPI:            botAPI,
-		messageProcessor:  message_processor.NewMessageProcessor(repo, redisDB, kafkaProducer, logger, os.Getenv("ADMIN_KEY")),
-		callbackProcessor: callback_processor.NewCallbackProcessor(logger),
+		repo:              repo,
+		presence:          presence,
+		messageProcessor:  processor.WithAuthorization(messageProcessor, authorizer, logger),
+		callbackProcessor: processor.WithAuthorization(callbackProcessor, authorizer, logger),
 		workerPool:        workerPool,
 		logger:            logger,
 	}, nil
@@ -58,19 +71,31 @@ func (b *Bot) Start(ctx context.Context, gracefulWg *sync.WaitGroup) {
 			msg := update.Message
 			if msg != nil {
 				b.workerPool.AddJob(func(ctx context.Context) error {
-					err := b.messageProcessor.Process(ctx, msg, b.botAPI)
+					b.touchPresence(ctx, processor.SenderID(msg))
+
+					err := b.messageProcessor.Process(b.withLang(ctx, msg.Chat.ID, msg.From), msg, b.botAPI)
 
+					// Текст не пишем в лог: в нем могут быть одноразовые коды приглашений
 					if err != nil {
-						b.logger.Errorf("Cannot process message ID = %d, Text = %s, Error = %s", msg.MessageID, msg.Text, err)
+						b.logger.Errorf("Cannot process message ID = %d, Chat ID = %d, Error = %s", msg.MessageID, msg.Chat.ID, err)
 					} else {
-						b.logger.Infof("Processed message ID = %d, Text = %s", msg.MessageID, msg.Text)
+						b.logger.Infof("Processed message ID = %d, Chat ID = %d", msg.MessageID, msg.Chat.ID)
 					}
 
 					return nil
 				})
 			} else if update.CallbackQuery != nil {
 				b.workerPool.AddJob(func(ctx context.Context) error {
-					err := b.callbackProcessor.Process(ctx, update.CallbackQuery, b.botAPI)
+					callback := update.CallbackQuery
+					b.touchPresence(ctx, callback.From.ID)
+
+					// У кнопок inline-режима нет сообщения, тогда язык берем по нажавшему
+					chatID := callback.From.ID
+					if callback.Message != nil {
+						chatID = callback.Message.Chat.ID
+					}
+
+					err := b.callbackProcessor.Process(b.withLang(ctx, chatID, callback.From), callback, b.botAPI)
 
 					if err != nil {
 						b.logger.Errorf("Cannot process callback ID = %s, Error = %s", update.CallbackQuery.ID, err)
@@ -87,3 +112,32 @@ func (b *Bot) Start(ctx context.Context, gracefulWg *sync.WaitGroup) {
 		}
 	}
 }
+
+// withLang добавляет в контекст язык чата chatID. Если язык личного чата еще неизвестен,
+// запоминаем язык телеграма пользователя, он действует, пока язык не выбран в /lang.
+// Ошибка кеша не мешает ответить, тогда отвечаем на языке по умолчанию
+func (b *Bot) withLang(ctx context.Context, chatID int64, from *tgbotapi.User) context.Context {
+	lang, err := b.repo.GetLanguage(ctx, chatID)
+	if err != nil {
+		b.logger.Errorf("Cannot get language of chat ID = %d, Error = %s", chatID, err)
+
+		return i18n.WithLang(ctx, i18n.Default)
+	}
+
+	if lang == "" && from != nil && from.ID == chatID && from.LanguageCode != "" {
+		if err = b.repo.DetectLanguage(ctx, chatID, from.LanguageCode); err != nil {
+			b.logger.Errorf("Cannot detect language of chat ID = %d, Error = %s", chatID, err)
+		}
+
+		lang = from.LanguageCode
+	}
+
+	return i18n.WithLang(ctx, i18n.Lang(lang))
+}
+
+// touchPresence продлевает смену админа при любой активности в чате
+func (b *Bot) touchPresence(ctx context.Context, chatID int64) {
+	if err := b.presence.TouchPresence(ctx, chatID); err != nil {
+		b.logger.Errorf("Cannot touch presence of chat ID = %d, Error = %s", chatID, err)
+	}
+}
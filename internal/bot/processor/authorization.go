@@ -0,0 +1,95 @@
+package processor
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/rbac"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const textForbidden = "forbidden"
+
+// AuthorizedProcessor знает, какое право нужно для обработки апдейта
+type AuthorizedProcessor interface {
+	Processor
+	Permission(ctx context.Context, processorData interface{}) (rbac.Request, error)
+}
+
+type authorization struct {
+	next       AuthorizedProcessor
+	authorizer rbac.Authorizer
+	logger     *logrus.Logger
+}
+
+// WithAuthorization пропускает апдейт в next, только если у автора есть нужное право
+func WithAuthorization(next AuthorizedProcessor, authorizer rbac.Authorizer, logger *logrus.Logger) *authorization {
+	return &authorization{
+		next:       next,
+		authorizer: authorizer,
+		logger:     logger,
+	}
+}
+
+func (a *authorization) Process(ctx context.Context, processorData interface{}, botAPI *tgbotapi.BotAPI) error {
+	request, err := a.next.Permission(ctx, processorData)
+	if err != nil {
+		return errors.Wrap(err, "next.Permission")
+	}
+
+	// Права проверяем у автора: в группе чат общий, а права у каждого свои
+	var chatID, userID int64
+
+	switch data := processorData.(type) {
+	case *tgbotapi.Message:
+		chatID, userID = data.Chat.ID, SenderID(data)
+
+	case *tgbotapi.CallbackQuery:
+		chatID, userID = data.From.ID, data.From.ID
+		if data.Message != nil {
+			chatID = data.Message.Chat.ID
+		}
+
+	default:
+		return errors.New("unknown processor data")
+	}
+
+	allowed, err := a.authorizer.Can(ctx, userID, request.Unit, request.Permission)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if allowed {
+		return a.next.Process(ctx, processorData, botAPI)
+	}
+
+	a.logger.Warnf("User %d has no permission %s in unit %q", userID, request.Permission, request.Unit)
+
+	switch data := processorData.(type) {
+	case *tgbotapi.Message:
+		msgToSend := tgbotapi.NewMessage(chatID, i18n.T(i18n.FromContext(ctx), textForbidden))
+		msgToSend.ParseMode = i18n.ParseMode()
+
+		if _, err = botAPI.Send(msgToSend); err != nil {
+			return errors.Wrap(err, "botAPI.Send")
+		}
+
+	case *tgbotapi.CallbackQuery:
+		if _, err = botAPI.Request(tgbotapi.NewCallbackWithAlert(data.ID, i18n.Plain(i18n.FromContext(ctx), textForbidden))); err != nil {
+			return errors.Wrap(err, "botAPI.Request")
+		}
+	}
+
+	return nil
+}
+
+// SenderID - автор сообщения. В личном чате совпадает с чатом, у сообщений
+// от имени группы или канала автора нет, тогда это сам чат
+func SenderID(msg *tgbotapi.Message) int64 {
+	if msg.From == nil {
+		return msg.Chat.ID
+	}
+
+	return msg.From.ID
+}
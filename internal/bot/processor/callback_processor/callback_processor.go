@@ -3,18 +3,42 @@ package callback_processor
 import (
 	"context"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/callbacks"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/rbac"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/redis"
+	"github.com/goddeuce1/tg_bot_tz/internal/tickets"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"strconv"
-	"strings"
+	"time"
+)
+
+const (
+	textStatusChanged      = "callback_status_changed"
+	textStatusNotAllowed   = "callback_status_not_allowed"
+	textStatusChangedAdmin = "callback_status_changed_admin"
+	textReplyPrompt        = "callback_reply_prompt"
+	textTaken              = "callback_taken"
+	textAlreadyTaken       = "callback_already_taken"
+	textReopened           = "callback_reopened"
+	textReopenedAdmin      = "callback_reopened_admin"
+	textCannedSent         = "callback_canned_sent"
+	textTicketClosed       = "callback_ticket_closed"
 )
 
 type callbackProcessor struct {
+	repo   repository.Repository
+	timers redis.TimerOperator
 	logger *logrus.Logger
 }
 
-func NewCallbackProcessor(logger *logrus.Logger) *callbackProcessor {
+func NewCallbackProcessor(repo repository.Repository, timers redis.TimerOperator, logger *logrus.Logger) *callbackProcessor {
 	return &callbackProcessor{
+		repo:   repo,
+		timers: timers,
 		logger: logger,
 	}
 }
@@ -25,20 +49,608 @@ func (cp *callbackProcessor) Process(ctx context.Context, processorData interfac
 		return errors.New("not callback")
 	}
 
-	ss := strings.Split(callback.Message.Text, "#")
-	if len(ss) != 2 {
-		return errors.New("strings.Split failed in callback")
+	// Все кнопки бота висят на его сообщениях, у кнопок inline-режима сообщения нет
+	if callback.Message == nil {
+		return errors.New("callback without message")
+	}
+
+	action, args := callbacks.Parse(callback.Data)
+
+	switch action {
+	case callbacks.ActionStatus:
+		return cp.processStatus(ctx, callback, args, botAPI)
+
+	case callbacks.ActionReply:
+		return cp.processReply(ctx, callback, args, botAPI)
+
+	case callbacks.ActionTake:
+		return cp.processTake(ctx, callback, args, botAPI)
+
+	case callbacks.ActionMyTickets:
+		return cp.processMyTickets(ctx, callback, args, botAPI)
+
+	case callbacks.ActionMyTicket:
+		return cp.processMyTicket(ctx, callback, args, botAPI)
+
+	case callbacks.ActionReopen:
+		return cp.processReopen(ctx, callback, args, botAPI)
+
+	case callbacks.ActionCanned:
+		return cp.processCanned(ctx, callback, args, botAPI)
+
+	case callbacks.ActionCannedPage:
+		return cp.processCannedPage(ctx, callback, args, botAPI)
+
+	case callbacks.ActionAdminView:
+		return cp.processAdminView(ctx, callback, args, botAPI)
+
+	default:
+		return errors.Errorf("unknown callback action %s", action)
+	}
+}
+
+// Permission определяет право, нужное для нажатия: кнопки под уведомлением о тикете
+// требуют права отвечать в подразделении тикета, кнопки клиента доступны всем
+func (cp *callbackProcessor) Permission(ctx context.Context, processorData interface{}) (rbac.Request, error) {
+	callback, ok := processorData.(*tgbotapi.CallbackQuery)
+	if !ok {
+		return rbac.Request{}, errors.New("not callback")
+	}
+
+	action, args := callbacks.Parse(callback.Data)
+
+	switch action {
+	case callbacks.ActionStatus, callbacks.ActionReply, callbacks.ActionTake,
+		callbacks.ActionCanned, callbacks.ActionCannedPage, callbacks.ActionAdminView:
+		if len(args) == 0 {
+			return rbac.Request{}, errors.New("wrong admin callback data")
+		}
+
+		ticketID, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return rbac.Request{}, errors.Wrap(err, "strconv.ParseUint")
+		}
+
+		ticket, err := cp.repo.GetTicket(ctx, ticketID)
+		if err != nil {
+			return rbac.Request{}, errors.Wrap(err, "repo.GetTicket")
+		}
+
+		return rbac.Request{Permission: rbac.PermissionAnswerTickets, Unit: ticket.Unit}, nil
+
+	default:
+		return rbac.Request{}, nil
+	}
+}
+
+// processCanned отправляет клиенту шаблонный ответ
+func (cp *callbackProcessor) processCanned(
+	ctx context.Context,
+	callback *tgbotapi.CallbackQuery,
+	args []string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	if len(args) != 2 {
+		return errors.New("wrong canned callback data")
+	}
+
+	ticketID, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return errors.Wrap(err, "strconv.ParseUint")
+	}
+
+	responseID, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return errors.Wrap(err, "strconv.ParseUint")
+	}
+
+	ticket, err := cp.repo.GetTicket(ctx, ticketID)
+	if err != nil {
+		return errors.Wrap(err, "repo.GetTicket")
+	}
+
+	response, err := cp.repo.GetCannedResponse(ctx, responseID)
+	if err != nil {
+		return errors.Wrap(err, "repo.GetCannedResponse")
+	}
+
+	if response.Unit != ticket.Unit {
+		return errors.Errorf("canned response %d does not belong to unit %s", responseID, ticket.Unit)
+	}
+
+	answer := textCannedSent
+
+	switch {
+	case ticket.Status == models.StatusClosed:
+		answer = textTicketClosed
+
+	case ticket.Assignee != nil && *ticket.Assignee != callback.From.ID:
+		answer = textAlreadyTaken
+	}
+
+	if _, err = botAPI.Request(tgbotapi.NewCallback(callback.ID, i18n.Plain(i18n.FromContext(ctx), answer))); err != nil {
+		return errors.Wrap(err, "botAPI.Request")
+	}
+
+	if answer != textCannedSent {
+		return nil
 	}
 
-	clientChatID, err := strconv.Atoi(ss[1])
+	clientLang, err := tickets.ChatLang(ctx, cp.repo, ticket.ChatID)
+	if err != nil {
+		return errors.Wrap(err, "tickets.ChatLang")
+	}
+
+	text := tickets.RenderCannedResponse(clientLang, response.Text, *ticket)
+
+	data, err := tickets.LoadTicketData(ctx, cp.repo, *ticket)
+	if err != nil {
+		return errors.Wrap(err, "tickets.LoadTicketData")
+	}
+
+	message := models.TicketMessage{
+		TicketID:  ticket.ID,
+		ChatID:    callback.From.ID,
+		FromAdmin: true,
+		Text:      text,
+	}
+
+	if err = cp.repo.SaveTicketMessage(ctx, message); err != nil {
+		return errors.Wrap(err, "repo.SaveTicketMessage")
+	}
+
+	msgToSend := tgbotapi.NewMessage(ticket.ChatID, tickets.BuildAdminReply(clientLang, data, text))
+	msgToSend.ParseMode = i18n.ParseMode()
+
+	if _, err = botAPI.Send(msgToSend); err != nil {
+		return errors.Wrap(err, "botAPI.Send")
+	}
+
+	groupLang, err := tickets.ThreadLang(ctx, cp.repo, *ticket)
+	if err != nil {
+		return errors.Wrap(err, "tickets.ThreadLang")
+	}
+
+	groupText := tickets.BuildAdminReply(groupLang, data, text)
+
+	if _, _, _, err = tickets.MirrorToThread(ctx, cp.repo, botAPI, *ticket, groupText, nil); err != nil {
+		return errors.Wrap(err, "tickets.MirrorToThread")
+	}
+
+	if err = cp.repo.UseCannedResponse(ctx, responseID); err != nil {
+		return errors.Wrap(err, "repo.UseCannedResponse")
+	}
+
+	return nil
+}
+
+// processCannedPage показывает в уведомлении страницу всех шаблонов подразделения
+func (cp *callbackProcessor) processCannedPage(
+	ctx context.Context,
+	callback *tgbotapi.CallbackQuery,
+	args []string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	if len(args) != 2 {
+		return errors.New("wrong canned page callback data")
+	}
+
+	ticketID, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return errors.Wrap(err, "strconv.ParseUint")
+	}
+
+	page, err := strconv.Atoi(args[1])
 	if err != nil {
 		return errors.Wrap(err, "strconv.Atoi")
 	}
 
-	msgToSend := tgbotapi.NewMessage(int64(clientChatID), callback.Data)
+	ticket, err := cp.repo.GetTicket(ctx, ticketID)
+	if err != nil {
+		return errors.Wrap(err, "repo.GetTicket")
+	}
+
+	if _, err = botAPI.Request(tgbotapi.NewCallback(callback.ID, "")); err != nil {
+		return errors.Wrap(err, "botAPI.Request")
+	}
+
+	markup, err := tickets.BuildCannedResponsesMarkup(ctx, cp.repo, i18n.FromContext(ctx), *ticket, page)
+	if err != nil {
+		return errors.Wrap(err, "tickets.BuildCannedResponsesMarkup")
+	}
+
+	editMarkup := tgbotapi.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID, markup)
+	if _, err = botAPI.Send(editMarkup); err != nil {
+		return errors.Wrap(err, "botAPI.Send")
+	}
+
+	return nil
+}
+
+// processAdminView возвращает уведомлению обычные кнопки тикета
+func (cp *callbackProcessor) processAdminView(
+	ctx context.Context,
+	callback *tgbotapi.CallbackQuery,
+	args []string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	if len(args) != 1 {
+		return errors.New("wrong admin view callback data")
+	}
+
+	ticketID, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return errors.Wrap(err, "strconv.ParseUint")
+	}
+
+	ticket, err := cp.repo.GetTicket(ctx, ticketID)
+	if err != nil {
+		return errors.Wrap(err, "repo.GetTicket")
+	}
+
+	responses, err := tickets.GetTopCannedResponses(ctx, cp.repo, ticket.Unit)
+	if err != nil {
+		return errors.Wrap(err, "tickets.GetTopCannedResponses")
+	}
+
+	if _, err = botAPI.Request(tgbotapi.NewCallback(callback.ID, "")); err != nil {
+		return errors.Wrap(err, "botAPI.Request")
+	}
+
+	// Текст уведомления не меняется, данные для него не нужны
+	_, markup := tickets.BuildAdminMessageWithMarkup(i18n.FromContext(ctx), tickets.TicketData{Ticket: *ticket}, callback.Message.Chat.ID, responses)
+
+	editMarkup := tgbotapi.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID, markup)
+	if _, err = botAPI.Send(editMarkup); err != nil {
+		return errors.Wrap(err, "botAPI.Send")
+	}
+
+	return nil
+}
+
+// processTake назначает тикет нажавшему админу и обновляет уведомления у остальных.
+// Исполнитель - нажавший пользователь, а не чат: в группе это не одно и то же
+func (cp *callbackProcessor) processTake(
+	ctx context.Context,
+	callback *tgbotapi.CallbackQuery,
+	args []string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	if len(args) != 1 {
+		return errors.New("wrong take callback data")
+	}
+
+	ticketID, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return errors.Wrap(err, "strconv.ParseUint")
+	}
+
+	ticket, err := cp.repo.AssignTicket(ctx, ticketID, callback.From.ID, callback.From.String())
+	if err != nil {
+		if errors.Is(err, models.ErrAlreadyAssigned) {
+			if _, err = botAPI.Request(tgbotapi.NewCallback(callback.ID, i18n.Plain(i18n.FromContext(ctx), textAlreadyTaken))); err != nil {
+				return errors.Wrap(err, "botAPI.Request")
+			}
+
+			return nil
+		}
+
+		return errors.Wrap(err, "repo.AssignTicket")
+	}
+
+	if _, err = botAPI.Request(tgbotapi.NewCallback(callback.ID, i18n.Plain(i18n.FromContext(ctx), textTaken))); err != nil {
+		return errors.Wrap(err, "botAPI.Request")
+	}
+
+	if err = tickets.UpdateAdminMessages(ctx, cp.repo, botAPI, *ticket); err != nil {
+		return errors.Wrap(err, "tickets.UpdateAdminMessages")
+	}
+
+	return nil
+}
+
+// processReply просит админа написать ответ, ответ приходит как reply на это сообщение
+func (cp *callbackProcessor) processReply(
+	ctx context.Context,
+	callback *tgbotapi.CallbackQuery,
+	args []string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	if len(args) != 1 {
+		return errors.New("wrong reply callback data")
+	}
+
+	ticketID, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return errors.Wrap(err, "strconv.ParseUint")
+	}
+
+	ticket, err := cp.repo.GetTicket(ctx, ticketID)
+	if err != nil {
+		return errors.Wrap(err, "repo.GetTicket")
+	}
+
+	if _, err = botAPI.Request(tgbotapi.NewCallback(callback.ID, "")); err != nil {
+		return errors.Wrap(err, "botAPI.Request")
+	}
+
+	msgToSend := tgbotapi.NewMessage(callback.Message.Chat.ID, i18n.T(i18n.FromContext(ctx), textReplyPrompt, i18n.Args{"ticket": ticket.Reference}))
+	msgToSend.ParseMode = i18n.ParseMode()
+	msgToSend.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true}
+
+	// В группе ответ на уведомление попадает в ту же тему
+	if tickets.IsGroupChat(callback.Message.Chat.ID) {
+		msgToSend.ReplyToMessageID = callback.Message.MessageID
+	}
+
+	if _, err = botAPI.Send(msgToSend); err != nil {
+		return errors.Wrap(err, "botAPI.Send")
+	}
+
+	return nil
+}
+
+// processStatus переводит тикет в новый статус, обновляет уведомления админов
+// и сообщает клиенту о смене статуса
+func (cp *callbackProcessor) processStatus(
+	ctx context.Context,
+	callback *tgbotapi.CallbackQuery,
+	args []string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	if len(args) != 2 {
+		return errors.New("wrong status callback data")
+	}
+
+	ticketID, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return errors.Wrap(err, "strconv.ParseUint")
+	}
+
+	ticket, err := cp.repo.GetTicket(ctx, ticketID)
+	if err != nil {
+		return errors.Wrap(err, "repo.GetTicket")
+	}
+
+	if ticket.Assignee != nil && *ticket.Assignee != callback.From.ID {
+		if _, err = botAPI.Request(tgbotapi.NewCallback(callback.ID, i18n.Plain(i18n.FromContext(ctx), textAlreadyTaken))); err != nil {
+			return errors.Wrap(err, "botAPI.Request")
+		}
+
+		return nil
+	}
+
+	ticket, err = cp.repo.UpdateTicketStatus(ctx, ticketID, args[1])
+	if err != nil {
+		if errors.Is(err, models.ErrStatusTransition) {
+			if _, err = botAPI.Request(tgbotapi.NewCallback(callback.ID, i18n.Plain(i18n.FromContext(ctx), textStatusNotAllowed))); err != nil {
+				return errors.Wrap(err, "botAPI.Request")
+			}
+
+			return nil
+		}
+
+		return errors.Wrap(err, "repo.UpdateTicketStatus")
+	}
+
+	if err = cp.scheduleSLA(ctx, *ticket); err != nil {
+		return errors.Wrap(err, "scheduleSLA")
+	}
+
+	if _, err = botAPI.Request(tgbotapi.NewCallback(callback.ID, i18n.Plain(i18n.FromContext(ctx), textStatusChangedAdmin))); err != nil {
+		return errors.Wrap(err, "botAPI.Request")
+	}
+
+	if err = tickets.UpdateAdminMessages(ctx, cp.repo, botAPI, *ticket); err != nil {
+		return errors.Wrap(err, "tickets.UpdateAdminMessages")
+	}
+
+	clientLang, err := tickets.ChatLang(ctx, cp.repo, ticket.ChatID)
+	if err != nil {
+		return errors.Wrap(err, "tickets.ChatLang")
+	}
+
+	data, err := tickets.LoadTicketData(ctx, cp.repo, *ticket)
+	if err != nil {
+		return errors.Wrap(err, "tickets.LoadTicketData")
+	}
+
+	clientText := i18n.T(clientLang, textStatusChanged, data.Args(i18n.Args{
+		"status": models.StatusName(clientLang, ticket.Status),
+	}))
+
+	msgToSend := tgbotapi.NewMessage(ticket.ChatID, clientText)
+	msgToSend.ParseMode = i18n.ParseMode()
+
 	if _, err = botAPI.Send(msgToSend); err != nil {
 		return errors.Wrap(err, "botAPI.Send")
 	}
 
 	return nil
 }
+
+// processMyTickets листает список тикетов клиента
+func (cp *callbackProcessor) processMyTickets(
+	ctx context.Context,
+	callback *tgbotapi.CallbackQuery,
+	args []string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	if len(args) != 1 {
+		return errors.New("wrong my tickets callback data")
+	}
+
+	page, err := strconv.Atoi(args[0])
+	if err != nil {
+		return errors.Wrap(err, "strconv.Atoi")
+	}
+
+	if _, err = botAPI.Request(tgbotapi.NewCallback(callback.ID, "")); err != nil {
+		return errors.Wrap(err, "botAPI.Request")
+	}
+
+	text, markup, err := tickets.BuildClientTicketsWithMarkup(ctx, cp.repo, i18n.FromContext(ctx), callback.Message.Chat.ID, page)
+	if err != nil {
+		return errors.Wrap(err, "tickets.BuildClientTicketsWithMarkup")
+	}
+
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(callback.Message.Chat.ID, callback.Message.MessageID, text, markup)
+	editMsg.ParseMode = i18n.ParseMode()
+	if _, err = botAPI.Send(editMsg); err != nil {
+		return errors.Wrap(err, "botAPI.Send")
+	}
+
+	return nil
+}
+
+// processMyTicket показывает клиенту карточку его тикета
+func (cp *callbackProcessor) processMyTicket(
+	ctx context.Context,
+	callback *tgbotapi.CallbackQuery,
+	args []string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	ticket, page, err := cp.getClientTicket(ctx, callback, args)
+	if err != nil {
+		return errors.Wrap(err, "getClientTicket")
+	}
+
+	if _, err = botAPI.Request(tgbotapi.NewCallback(callback.ID, "")); err != nil {
+		return errors.Wrap(err, "botAPI.Request")
+	}
+
+	data, err := tickets.LoadTicketData(ctx, cp.repo, *ticket)
+	if err != nil {
+		return errors.Wrap(err, "tickets.LoadTicketData")
+	}
+
+	text, markup := tickets.BuildClientTicketWithMarkup(i18n.FromContext(ctx), data, page)
+
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(callback.Message.Chat.ID, callback.Message.MessageID, text, markup)
+	editMsg.ParseMode = i18n.ParseMode()
+	if _, err = botAPI.Send(editMsg); err != nil {
+		return errors.Wrap(err, "botAPI.Send")
+	}
+
+	return nil
+}
+
+// processReopen переоткрывает решенный тикет по просьбе клиента
+func (cp *callbackProcessor) processReopen(
+	ctx context.Context,
+	callback *tgbotapi.CallbackQuery,
+	args []string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	ticket, page, err := cp.getClientTicket(ctx, callback, args)
+	if err != nil {
+		return errors.Wrap(err, "getClientTicket")
+	}
+
+	ticket, err = cp.repo.UpdateTicketStatus(ctx, ticket.ID, models.StatusOpen)
+	if err != nil {
+		if errors.Is(err, models.ErrStatusTransition) {
+			if _, err = botAPI.Request(tgbotapi.NewCallback(callback.ID, i18n.Plain(i18n.FromContext(ctx), textStatusNotAllowed))); err != nil {
+				return errors.Wrap(err, "botAPI.Request")
+			}
+
+			return nil
+		}
+
+		return errors.Wrap(err, "repo.UpdateTicketStatus")
+	}
+
+	if err = cp.scheduleSLA(ctx, *ticket); err != nil {
+		return errors.Wrap(err, "scheduleSLA")
+	}
+
+	if _, err = botAPI.Request(tgbotapi.NewCallback(callback.ID, i18n.Plain(i18n.FromContext(ctx), textReopened))); err != nil {
+		return errors.Wrap(err, "botAPI.Request")
+	}
+
+	data, err := tickets.LoadTicketData(ctx, cp.repo, *ticket)
+	if err != nil {
+		return errors.Wrap(err, "tickets.LoadTicketData")
+	}
+
+	text, markup := tickets.BuildClientTicketWithMarkup(i18n.FromContext(ctx), data, page)
+
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(callback.Message.Chat.ID, callback.Message.MessageID, text, markup)
+	editMsg.ParseMode = i18n.ParseMode()
+
+	if _, err = botAPI.Send(editMsg); err != nil {
+		return errors.Wrap(err, "botAPI.Send")
+	}
+
+	if err = tickets.UpdateAdminMessages(ctx, cp.repo, botAPI, *ticket); err != nil {
+		return errors.Wrap(err, "tickets.UpdateAdminMessages")
+	}
+
+	adminsMap, err := tickets.TicketAdmins(ctx, cp.repo, *ticket)
+	if err != nil {
+		return errors.Wrap(err, "tickets.TicketAdmins")
+	}
+
+	for k := range adminsMap {
+		lang, errLang := tickets.ChatLang(ctx, cp.repo, k)
+		if errLang != nil {
+			return errors.Wrap(errLang, "tickets.ChatLang")
+		}
+
+		msgToSend := tgbotapi.NewMessage(k, i18n.T(lang, textReopenedAdmin, data.Args(nil)))
+		msgToSend.ParseMode = i18n.ParseMode()
+
+		if _, err = botAPI.Send(msgToSend); err != nil {
+			return errors.Wrap(err, "botAPI.Send")
+		}
+	}
+
+	return nil
+}
+
+// scheduleSLA возвращает тикет под контроль SLA: у решенного тикета планировщик снимает
+// таймер, и без нового переоткрытый тикет больше не эскалировался бы
+func (cp *callbackProcessor) scheduleSLA(ctx context.Context, ticket models.Ticket) error {
+	if ticket.Status == models.StatusResolved || ticket.Status == models.StatusClosed {
+		return nil
+	}
+
+	// Таймер на сейчас: планировщик сам пересчитает сроки и поставит его на ближайший
+	if err := cp.timers.ScheduleSLA(ctx, ticket.ID, time.Now()); err != nil {
+		return errors.Wrap(err, "timers.ScheduleSLA")
+	}
+
+	return nil
+}
+
+// getClientTicket достает тикет из callback data вида id:page и проверяет, что он принадлежит клиенту
+func (cp *callbackProcessor) getClientTicket(
+	ctx context.Context,
+	callback *tgbotapi.CallbackQuery,
+	args []string,
+) (*models.Ticket, int, error) {
+	if len(args) != 2 {
+		return nil, 0, errors.New("wrong client ticket callback data")
+	}
+
+	ticketID, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "strconv.ParseUint")
+	}
+
+	page, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "strconv.Atoi")
+	}
+
+	ticket, err := cp.repo.GetTicket(ctx, ticketID)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "repo.GetTicket")
+	}
+
+	if ticket.ChatID != callback.Message.Chat.ID {
+		return nil, 0, errors.Errorf("ticket %d does not belong to chat %d", ticketID, callback.Message.Chat.ID)
+	}
+
+	return ticket, page, nil
+}
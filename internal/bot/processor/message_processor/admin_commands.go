@@ -0,0 +1,118 @@
+package message_processor
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/rbac"
+	"github.com/goddeuce1/tg_bot_tz/internal/tickets"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// adminCommandHandler обрабатывает команду админа с аргументами args (текст после команды)
+type adminCommandHandler func(mp *messageProcessor, ctx context.Context, msg *tgbotapi.Message, args string, botAPI *tgbotapi.BotAPI) error
+
+// adminCommand - обработчик и право, которое нужно хотя бы в одном подразделении.
+// Право в конкретном подразделении из аргументов проверяет сам обработчик
+type adminCommand struct {
+	handler    adminCommandHandler
+	permission rbac.Permission
+}
+
+// Команды с аргументами, которые не укладываются в опрос fsm
+var adminCommands = map[string]adminCommand{
+	commandTemplates:      {(*messageProcessor).processTemplates, rbac.PermissionViewTemplates},
+	commandTemplateAdd:    {(*messageProcessor).processTemplateAdd, rbac.PermissionManageTemplates},
+	commandTemplateEdit:   {(*messageProcessor).processTemplateEdit, rbac.PermissionManageTemplates},
+	commandTemplateDelete: {(*messageProcessor).processTemplateDelete, rbac.PermissionManageTemplates},
+	commandSupervisor:     {(*messageProcessor).processSupervisor, rbac.PermissionManageAgents},
+	commandInvite:         {(*messageProcessor).processInviteCreate, rbac.PermissionManageAgents},
+	commandAgents:         {(*messageProcessor).processAgents, rbac.PermissionManageAgents},
+	commandReassign:       {(*messageProcessor).processReassign, rbac.PermissionReassignTickets},
+	commandLogout:         {(*messageProcessor).processLogout, rbac.PermissionAnswerTickets},
+	commandLeave:          {(*messageProcessor).processLeave, rbac.PermissionAnswerTickets},
+	commandRemove:         {(*messageProcessor).processRemove, rbac.PermissionManageAgents},
+	commandOnline:         {(*messageProcessor).processOnline, rbac.PermissionAnswerTickets},
+	commandOffline:        {(*messageProcessor).processOffline, rbac.PermissionAnswerTickets},
+	commandUnits:          {(*messageProcessor).processUnits, rbac.PermissionManageUnits},
+	commandUnitAdd:        {(*messageProcessor).processUnitAdd, rbac.PermissionManageUnits},
+	commandUnitRename:     {(*messageProcessor).processUnitRename, rbac.PermissionManageUnits},
+	commandUnitDisable:    {(*messageProcessor).processUnitDisable, rbac.PermissionManageUnits},
+	commandUnitEnable:     {(*messageProcessor).processUnitEnable, rbac.PermissionManageUnits},
+	commandUnitName:       {(*messageProcessor).processUnitName, rbac.PermissionManageUnits},
+	commandHours:          {(*messageProcessor).processHours, rbac.PermissionAnswerTickets},
+	commandHoursSet:       {(*messageProcessor).processHoursSet, rbac.PermissionManageSchedule},
+	commandHolidayAdd:     {(*messageProcessor).processHolidayAdd, rbac.PermissionManageSchedule},
+	commandHolidayDelete:  {(*messageProcessor).processHolidayDelete, rbac.PermissionManageSchedule},
+	commandOffHoursReply:  {(*messageProcessor).processOffHoursReply, rbac.PermissionManageSchedule},
+	commandRouting:        {(*messageProcessor).processRouting, rbac.PermissionManageAgents},
+	commandGroupBind:      {(*messageProcessor).processGroupBind, rbac.PermissionManageAgents},
+	commandGroupUnbind:    {(*messageProcessor).processGroupUnbind, rbac.PermissionManageAgents},
+	commandStats:          {(*messageProcessor).processStats, rbac.PermissionViewStats},
+	commandFields:         {(*messageProcessor).processFields, rbac.PermissionManageUnits},
+	commandFieldAdd:       {(*messageProcessor).processFieldAdd, rbac.PermissionManageUnits},
+	commandFieldDelete:    {(*messageProcessor).processFieldDelete, rbac.PermissionManageUnits},
+}
+
+// parseCommand делит "/command@bot args" на команду и аргументы
+func parseCommand(text string) (string, string) {
+	if !strings.HasPrefix(text, "/") {
+		return "", ""
+	}
+
+	name, args, _ := strings.Cut(text, " ")
+	name, _, _ = strings.Cut(name, "@")
+
+	return name, strings.TrimSpace(args)
+}
+
+// splitArgs делит аргументы команды по "|"
+func splitArgs(args string, count int) ([]string, bool) {
+	ss := strings.SplitN(args, "|", count)
+	if len(ss) != count {
+		return nil, false
+	}
+
+	for i := range ss {
+		ss[i] = strings.TrimSpace(ss[i])
+		if ss[i] == "" {
+			return nil, false
+		}
+	}
+
+	return ss, true
+}
+
+// sendText отправляет text, собранный из текстов i18n.T
+func sendText(botAPI *tgbotapi.BotAPI, chatID int64, text string) error {
+	msgToSend := tgbotapi.NewMessage(chatID, text)
+	msgToSend.ParseMode = i18n.ParseMode()
+
+	if _, err := botAPI.Send(msgToSend); err != nil {
+		return errors.Wrap(err, "botAPI.Send")
+	}
+
+	return nil
+}
+
+// sendChatText отправляет текст key другому чату chatID, на языке этого чата
+func (mp *messageProcessor) sendChatText(
+	ctx context.Context,
+	botAPI *tgbotapi.BotAPI,
+	chatID int64,
+	key string,
+	args ...i18n.Args,
+) error {
+	lang, err := tickets.ChatLang(ctx, mp.repo, chatID)
+	if err != nil {
+		return errors.Wrap(err, "tickets.ChatLang")
+	}
+
+	return sendText(botAPI, chatID, i18n.T(lang, key, args...))
+}
+
+// tr - текст key на языке чата, для которого обрабатывается апдейт
+func tr(ctx context.Context, key string, args ...i18n.Args) string {
+	return i18n.T(i18n.FromContext(ctx), key, args...)
+}
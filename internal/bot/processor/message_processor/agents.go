@@ -0,0 +1,343 @@
+package message_processor
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/bot/processor"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/rbac"
+	rmodels "github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/redis"
+	"github.com/goddeuce1/tg_bot_tz/internal/tickets"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+// processAgents: /agents <подразделение>, список админов подразделения с ролями
+func (mp *messageProcessor) processAgents(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	if args == "" {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textAgentsHelp))
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), args, rbac.PermissionManageAgents)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	admins, err := mp.repo.GetUnitAdmins(ctx, args)
+	if err != nil {
+		return errors.Wrap(err, "repo.GetUnitAdmins")
+	}
+
+	chatIDs := make([]int64, 0, len(admins))
+	for _, v := range admins {
+		chatIDs = append(chatIDs, v.ChatID)
+	}
+
+	online, err := mp.presence.GetOnline(ctx, chatIDs)
+	if err != nil {
+		return errors.Wrap(err, "presence.GetOnline")
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(tr(ctx, textAgents, i18n.Args{"unit": args}))
+
+	lang := i18n.FromContext(ctx)
+
+	for _, v := range admins {
+		status := textStatusOff
+		if online[v.ChatID] {
+			status = textStatusOn
+		}
+
+		sb.WriteString(tr(ctx, textAgent, i18n.Args{
+			"chat":   v.ChatID,
+			"name":   v.Name,
+			"role":   rmodels.RoleName(lang, v.Role),
+			"status": i18n.Plain(lang, status),
+		}))
+	}
+
+	return sendText(botAPI, msg.Chat.ID, sb.String())
+}
+
+// processReassign: /reassign <номер обращения> | <chat id админа>, без админа снимает исполнителя
+func (mp *messageProcessor) processReassign(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	reference, rawChatID, _ := strings.Cut(args, "|")
+	reference = strings.TrimPrefix(strings.TrimSpace(reference), "№")
+	rawChatID = strings.TrimSpace(rawChatID)
+
+	if reference == "" {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textReassignHelp))
+	}
+
+	ticket, err := mp.repo.GetTicketByReference(ctx, reference)
+	if err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textTicketMissing))
+		}
+
+		return errors.Wrap(err, "repo.GetTicketByReference")
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), ticket.Unit, rbac.PermissionReassignTickets)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	var assignee *rmodels.Admin
+
+	if rawChatID != "" {
+		chatID, errParse := strconv.ParseInt(rawChatID, 10, 64)
+		if errParse != nil {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textReassignHelp))
+		}
+
+		admins, errAdmins := mp.repo.GetUnitAdmins(ctx, ticket.Unit)
+		if errAdmins != nil {
+			return errors.Wrap(errAdmins, "repo.GetUnitAdmins")
+		}
+
+		for i := range admins {
+			if admins[i].ChatID == chatID {
+				assignee = &admins[i]
+			}
+		}
+
+		if assignee == nil {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textAgentMissing))
+		}
+	}
+
+	text := tr(ctx, textUnassigned, i18n.Args{"ticket": ticket.Reference})
+
+	if assignee == nil {
+		ticket, err = mp.repo.ReassignTicket(ctx, ticket.ID, nil, "")
+	} else {
+		text = tr(ctx, textReassigned, i18n.Args{"ticket": ticket.Reference, "assignee": assignee.Name})
+		ticket, err = mp.repo.ReassignTicket(ctx, ticket.ID, &assignee.ChatID, assignee.Name)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "repo.ReassignTicket")
+	}
+
+	if err = tickets.UpdateAdminMessages(ctx, mp.repo, botAPI, *ticket); err != nil {
+		return errors.Wrap(err, "tickets.UpdateAdminMessages")
+	}
+
+	// Новый исполнитель мог не получать уведомление о тикете, пишем ему отдельно
+	if assignee != nil {
+		data, errData := tickets.LoadTicketData(ctx, mp.repo, *ticket)
+		if errData != nil {
+			return errors.Wrap(errData, "tickets.LoadTicketData")
+		}
+
+		if err = mp.sendChatText(ctx, botAPI, assignee.ChatID, textReassignedToYou, data.Args(nil)); err != nil {
+			return errors.Wrap(err, "sendChatText")
+		}
+	}
+
+	return sendText(botAPI, msg.Chat.ID, text)
+}
+
+// processLogout: /logout, выход из всех подразделений
+func (mp *messageProcessor) processLogout(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	_ string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	// Выходит автор команды: в группе чат общий, а админ - каждый свой
+	adminID := processor.SenderID(msg)
+
+	admins, err := mp.repo.GetAdminRoles(ctx, adminID)
+	if err != nil {
+		return errors.Wrap(err, "repo.GetAdminRoles")
+	}
+
+	for _, v := range admins {
+		if err = mp.deleteAdmin(ctx, adminID, v.Unit, botAPI); err != nil {
+			return errors.Wrap(err, "deleteAdmin")
+		}
+	}
+
+	if err = mp.stateOperator.SetState(ctx, adminID, redis.ChatData{}); err != nil {
+		return errors.Wrap(err, "stateOperator.SetState")
+	}
+
+	if err = mp.presence.SetOffline(ctx, adminID); err != nil {
+		return errors.Wrap(err, "presence.SetOffline")
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textLoggedOut))
+}
+
+// processLeave: /leave <подразделение>
+func (mp *messageProcessor) processLeave(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	if args == "" {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textLeaveHelp))
+	}
+
+	adminID := processor.SenderID(msg)
+
+	if err := mp.deleteAdmin(ctx, adminID, args, botAPI); err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotUnitAdmin))
+		}
+
+		return errors.Wrap(err, "deleteAdmin")
+	}
+
+	admins, err := mp.repo.GetAdminRoles(ctx, adminID)
+	if err != nil {
+		return errors.Wrap(err, "repo.GetAdminRoles")
+	}
+
+	// Из последнего подразделения вышли - личный чат админа снова клиентский
+	if len(admins) == 0 {
+		if err = mp.stateOperator.SetState(ctx, adminID, redis.ChatData{}); err != nil {
+			return errors.Wrap(err, "stateOperator.SetState")
+		}
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textLeft, i18n.Args{"unit": args}))
+}
+
+// processRemove: /remove <подразделение> | <chat id>. Руководитель удаляет агентов,
+// руководителей и владельцев может удалить только владелец
+func (mp *messageProcessor) processRemove(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	ss, ok := splitArgs(args, 2)
+	if !ok {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textRemoveHelp))
+	}
+
+	chatID, err := strconv.ParseInt(ss[1], 10, 64)
+	if err != nil {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textRemoveHelp))
+	}
+
+	role, err := mp.repo.GetAdminRole(ctx, chatID, ss[0])
+	if err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textAgentMissing))
+		}
+
+		return errors.Wrap(err, "repo.GetAdminRole")
+	}
+
+	permission := rbac.PermissionManageInvites
+	if role == rmodels.RoleAgent {
+		permission = rbac.PermissionManageAgents
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), ss[0], permission)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	if err = mp.deleteAdmin(ctx, chatID, ss[0], botAPI); err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textAgentMissing))
+		}
+
+		return errors.Wrap(err, "deleteAdmin")
+	}
+
+	if err = mp.sendChatText(ctx, botAPI, chatID, textRemovedYou, i18n.Args{"unit": ss[0]}); err != nil {
+		return errors.Wrap(err, "sendChatText")
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textRemoved, i18n.Args{"chat": ss[1], "unit": ss[0]}))
+}
+
+// deleteAdmin удаляет админа из подразделения и сообщает админам подразделения
+// о тикетах, которые освободились после него
+func (mp *messageProcessor) deleteAdmin(ctx context.Context, chatID int64, unit string, botAPI *tgbotapi.BotAPI) error {
+	released, err := mp.repo.DeleteAdmin(ctx, chatID, unit)
+	if err != nil {
+		return errors.Wrap(err, "repo.DeleteAdmin")
+	}
+
+	for _, v := range released {
+		if err = tickets.UpdateAdminMessages(ctx, mp.repo, botAPI, v); err != nil {
+			return errors.Wrap(err, "tickets.UpdateAdminMessages")
+		}
+
+		adminsMap, errAdmins := tickets.TicketAdmins(ctx, mp.repo, v)
+		if errAdmins != nil {
+			return errors.Wrap(errAdmins, "tickets.TicketAdmins")
+		}
+
+		args := i18n.Args{"chat": chatID, "ticket": v.Reference, "name": v.Name}
+
+		for k := range adminsMap {
+			if err = mp.sendChatText(ctx, botAPI, k, textReleased, args); err != nil {
+				return errors.Wrap(err, "sendChatText")
+			}
+		}
+	}
+
+	return nil
+}
+
+// processOnline: /online, админ выходит на смену
+func (mp *messageProcessor) processOnline(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	_ string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	if err := mp.presence.SetOnline(ctx, processor.SenderID(msg)); err != nil {
+		return errors.Wrap(err, "presence.SetOnline")
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textOnline, i18n.Args{"n": int(redis.OnlineTTL.Minutes())}))
+}
+
+// processOffline: /offline, админ уходит со смены
+func (mp *messageProcessor) processOffline(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	_ string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	if err := mp.presence.SetOffline(ctx, processor.SenderID(msg)); err != nil {
+		return errors.Wrap(err, "presence.SetOffline")
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textOffline))
+}
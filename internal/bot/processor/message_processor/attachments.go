@@ -0,0 +1,160 @@
+package message_processor
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/bot/processor"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	rmodels "github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/goddeuce1/tg_bot_tz/internal/tickets/models"
+	"github.com/pkg/errors"
+)
+
+// Альбом закрепляется либо за черновиком, либо за номером тикета
+const mediaGroupDraft = "draft"
+
+// attachmentFromMessage достает вложение из сообщения, у фото берем самый большой размер
+func attachmentFromMessage(msg *tgbotapi.Message) (models.Attachment, bool) {
+	attachment := models.Attachment{
+		MediaGroupID: msg.MediaGroupID,
+		Caption:      msg.Caption,
+	}
+
+	switch {
+	case len(msg.Photo) > 0:
+		photo := msg.Photo[len(msg.Photo)-1]
+
+		attachment.Type = models.AttachmentPhoto
+		attachment.FileID = photo.FileID
+		attachment.FileUniqueID = photo.FileUniqueID
+		attachment.FileSize = photo.FileSize
+
+	case msg.Document != nil:
+		attachment.Type = models.AttachmentDocument
+		attachment.FileID = msg.Document.FileID
+		attachment.FileUniqueID = msg.Document.FileUniqueID
+		attachment.FileName = msg.Document.FileName
+		attachment.MimeType = msg.Document.MimeType
+		attachment.FileSize = msg.Document.FileSize
+
+	case msg.Voice != nil:
+		attachment.Type = models.AttachmentVoice
+		attachment.FileID = msg.Voice.FileID
+		attachment.FileUniqueID = msg.Voice.FileUniqueID
+		attachment.MimeType = msg.Voice.MimeType
+		attachment.FileSize = msg.Voice.FileSize
+
+	case msg.Video != nil:
+		attachment.Type = models.AttachmentVideo
+		attachment.FileID = msg.Video.FileID
+		attachment.FileUniqueID = msg.Video.FileUniqueID
+		attachment.FileName = msg.Video.FileName
+		attachment.MimeType = msg.Video.MimeType
+		attachment.FileSize = msg.Video.FileSize
+
+	default:
+		return models.Attachment{}, false
+	}
+
+	return attachment, true
+}
+
+// claimMediaGroup закрепляет альбом за target, true - сообщение первое в альбоме
+// (одиночное сообщение всегда первое)
+func (mp *messageProcessor) claimMediaGroup(ctx context.Context, msg *tgbotapi.Message, target string) (bool, error) {
+	if msg.MediaGroupID == "" {
+		return true, nil
+	}
+
+	_, first, err := mp.stateOperator.ClaimMediaGroup(ctx, msg.MediaGroupID, target)
+	if err != nil {
+		return false, errors.Wrap(err, "stateOperator.ClaimMediaGroup")
+	}
+
+	return first, nil
+}
+
+// saveTicketAttachment сохраняет вложение из переписки по тикету
+func (mp *messageProcessor) saveTicketAttachment(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	ticket *rmodels.Ticket,
+	attachment models.Attachment,
+) error {
+	dbAttachment := rmodels.Attachment{
+		TicketID:     ticket.ID,
+		ChatID:       processor.SenderID(msg),
+		Type:         attachment.Type,
+		FileID:       attachment.FileID,
+		FileUniqueID: attachment.FileUniqueID,
+		MediaGroupID: attachment.MediaGroupID,
+		FileName:     attachment.FileName,
+		MimeType:     attachment.MimeType,
+		FileSize:     attachment.FileSize,
+		Caption:      attachment.Caption,
+	}
+
+	if err := mp.repo.SaveAttachments(ctx, []rmodels.Attachment{dbAttachment}); err != nil {
+		return errors.Wrap(err, "repo.SaveAttachments")
+	}
+
+	return nil
+}
+
+// processDraftAttachment добавляет вложение к черновику на шаге описания.
+// Подпись к вложению считаем описанием, без подписи ждем описание текстом
+func (mp *messageProcessor) processDraftAttachment(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	attachment models.Attachment,
+	botAPI *tgbotapi.BotAPI,
+) (bool, error) {
+	// Закрепляем альбом до смены состояния, чтобы остальные части альбома
+	// попали в черновик, даже если подпись уже завершила шаг описания
+	first, err := mp.claimMediaGroup(ctx, msg, mediaGroupDraft)
+	if err != nil {
+		return false, errors.Wrap(err, "claimMediaGroup")
+	}
+
+	if _, err = mp.stateOperator.AddDraftAttachment(ctx, msg.Chat.ID, attachment); err != nil {
+		return false, errors.Wrap(err, "stateOperator.AddDraftAttachment")
+	}
+
+	if msg.Caption != "" {
+		return false, nil
+	}
+
+	if first {
+		if err = sendText(botAPI, msg.Chat.ID, tr(ctx, textAttachmentAdded)); err != nil {
+			return false, errors.Wrap(err, "sendText")
+		}
+	}
+
+	return true, nil
+}
+
+// copyAttachment копирует вложение из сообщения в чат chatID, сообщения без вложений пропускает
+func copyAttachment(msg *tgbotapi.Message, chatID int64, botAPI *tgbotapi.BotAPI) error {
+	if _, hasAttachment := attachmentFromMessage(msg); !hasAttachment {
+		return nil
+	}
+
+	if _, err := botAPI.CopyMessage(tgbotapi.NewCopyMessage(chatID, msg.Chat.ID, msg.MessageID)); err != nil {
+		return errors.Wrap(err, "botAPI.CopyMessage")
+	}
+
+	return nil
+}
+
+// threadText - текст сообщения в переписке на языке lang, у вложений это подпись
+func threadText(lang string, msg *tgbotapi.Message) string {
+	if msg.Text != "" {
+		return msg.Text
+	}
+
+	if msg.Caption != "" {
+		return msg.Caption
+	}
+
+	return i18n.Plain(lang, textAttachment)
+}
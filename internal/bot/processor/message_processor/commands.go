@@ -1,186 +1,158 @@
 package message_processor
 
-import (
-	"fmt"
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/goddeuce1/tg_bot_tz/internal/repository/redis"
-)
-
 const (
-	commandStart = "/start"
-	commandNew   = "/new"
-
-	commandUnit        = "unit"
-	commandName        = "name"
-	commandDescription = "description"
-	commandDone        = "done"
-	commandUnknown     = "unknown"
-
-	commandAdmin         = "/admin"
-	commandAdminKey      = "admin_key"
-	commandAdminLoggedIn = "admin_logged_in"
-	commandAdminWrong    = "admin_wrong"
-
-	textHello       = "Приветствую! Что вы бы вы хотели сделать?"
-	textSelectUnit  = "Выберете подразделение"
-	textName        = "Напишите заголовок обращения"
-	textDescription = "Введите описание обращения"
-	textSubmit      = `
-Отлично! Ваша заявка:
-
-Подразделение: %s
-Название: %s
-Описание: %s
-
-Отправить администратору?`
-	textSubmitYes     = "Отправить"
-	textSubmitNo      = "Не отправлять"
-	textSubmitSuccess = "Ваша заявка отправлена! Ожидайте, с вами скоро свяжутся"
-	textSubmitFailure = "Если вы ошиблись при создании заявки, вы можете создать её снова"
-	textUnknown       = "Я вас не понимаю :("
-
-	textAdminKey      = "Введите подразделение (Поддержка, IT или Billing) и ключ через пробел"
-	textAdminWrongKey = "Неправильно, в доступе отказано"
-	textAdminWelcome  = "Добро пожаловать! Ожидайте обращений"
-
-	unitSupport = "Поддержка"
-	unitIT      = "IT"
-	unitBilling = "Billing"
+	commandTemplates      = "/templates"
+	commandTemplateAdd    = "/template_add"
+	commandTemplateEdit   = "/template_edit"
+	commandTemplateDelete = "/template_delete"
+	commandSupervisor     = "/supervisor"
+
+	commandInvite   = "/invite"
+	commandAgents   = "/agents"
+	commandReassign = "/reassign"
+	commandLogout   = "/logout"
+	commandLeave    = "/leave"
+	commandRemove   = "/remove"
+	commandOnline   = "/online"
+	commandOffline  = "/offline"
+
+	commandUnits       = "/units"
+	commandUnitAdd     = "/unit_add"
+	commandUnitRename  = "/unit_rename"
+	commandUnitDisable = "/unit_disable"
+	commandUnitEnable  = "/unit_enable"
+	commandUnitName    = "/unit_name"
+
+	commandHours         = "/hours"
+	commandHoursSet      = "/hours_set"
+	commandHolidayAdd    = "/holiday_add"
+	commandHolidayDelete = "/holiday_delete"
+	commandOffHoursReply = "/offhours_reply"
+	commandRouting       = "/routing"
+	commandGroupBind     = "/group_bind"
+	commandGroupUnbind   = "/group_unbind"
+	commandStats         = "/stats"
+	commandFields        = "/fields"
+	commandFieldAdd      = "/field_add"
+	commandFieldDelete   = "/field_delete"
+	commandLang          = "/lang"
+
+	textUnknown      = "unknown"
+	textDraftExpired = "draft_expired"
+
+	textLanguages       = "languages"
+	textLanguage        = "language"
+	textLanguageSaved   = "language_saved"
+	textLanguageUnknown = "language_unknown"
+
+	textAdminWrongKey   = "admin_wrong_key"
+	textAdminLocked     = "admin_locked"
+	textAdminLockedNext = "admin_locked_next"
+	textLoginSpike      = "login_spike"
+	textAdminWelcome    = "admin_welcome"
+
+	textReplySent     = "reply_sent"
+	textFollowUpSaved = "follow_up_saved"
+	textTicketClosed  = "ticket_closed"
+	textTicketTaken   = "ticket_taken"
+
+	textAttachmentAdded = "attachment_added"
+	textAttachment      = "attachment"
+
+	textNotAdmin         = "not_admin"
+	textTemplates        = "templates"
+	textTemplate         = "template"
+	textTemplateSaved    = "template_saved"
+	textTemplateDeleted  = "template_deleted"
+	textTemplateNotFound = "template_not_found"
+	textTemplatesHelp    = "templates_help"
+
+	textSupervisorHelp  = "supervisor_help"
+	textSupervisorSaved = "supervisor_saved"
+
+	textInviteHelp = "invite_help"
+	textInvite     = "invite"
+
+	textAgents          = "agents"
+	textAgent           = "agent"
+	textAgentsHelp      = "agents_help"
+	textReassignHelp    = "reassign_help"
+	textReassigned      = "reassigned"
+	textUnassigned      = "unassigned"
+	textReassignedToYou = "reassigned_to_you"
+	textTicketMissing   = "ticket_missing"
+	textAgentMissing    = "agent_missing"
+
+	textLeaveHelp    = "leave_help"
+	textRemoveHelp   = "remove_help"
+	textLeft         = "left"
+	textLoggedOut    = "logged_out"
+	textRemoved      = "removed"
+	textRemovedYou   = "removed_you"
+	textNotUnitAdmin = "not_unit_admin"
+	textReleased     = "released"
+
+	textOnline    = "online"
+	textOffline   = "offline"
+	textStatusOn  = "shift_on"
+	textStatusOff = "shift_off"
+
+	textUnits        = "units"
+	textUnit         = "unit"
+	textUnitDisabled = "unit_disabled"
+	textUnitSaved    = "unit_saved"
+	textUnitRenamed  = "unit_renamed"
+	textUnitDisable  = "unit_disable"
+	textUnitEnable   = "unit_enable"
+	textUnitNotFound = "unit_not_found"
+	textUnitName     = "unit_name"
+	textUnitNameDrop = "unit_name_drop"
+	textUnitNames    = "unit_names"
+	textUnitExists   = "unit_exists"
+	textUnitsHelp    = "units_help"
+
+	textHours             = "hours"
+	textHoursOpen         = "hours_open"
+	textHoursClosed       = "hours_closed"
+	textHoursNoHolidays   = "hours_no_holidays"
+	textHoursDefaultReply = "hours_default_reply"
+	textHoursSaved        = "hours_saved"
+	textHoursWrongZone    = "hours_wrong_zone"
+	textHolidaySaved      = "holiday_saved"
+	textHolidayDeleted    = "holiday_deleted"
+	textHolidayNotFound   = "holiday_not_found"
+	textOffHoursSaved     = "offhours_saved"
+	textHoursHelp         = "hours_help"
+
+	textRouting      = "routing"
+	textRoutingSaved = "routing_saved"
+	textRoutingHelp  = "routing_help"
+
+	textGroupBound       = "group_bound"
+	textGroupBoundTopics = "group_bound_topics"
+	textGroupUnbound     = "group_unbound"
+	textGroupHelp        = "group_help"
+
+	textStatsTitle         = "stats_title"
+	textStatsStatuses      = "stats_statuses"
+	textStatsTotal         = "stats_total"
+	textStatsDaily         = "stats_daily"
+	textStatsFirstResponse = "stats_first_response"
+	textStatsResolution    = "stats_resolution"
+	textStatsTopAgents     = "stats_top_agents"
+	textStatsNoData        = "stats_no_data"
+	textStatsHelp          = "stats_help"
+
+	textDurationDays    = "duration_days"
+	textDurationHours   = "duration_hours"
+	textDurationMinutes = "duration_minutes"
+
+	textFields        = "fields"
+	textField         = "field"
+	textFieldsEmpty   = "fields_empty"
+	textFieldSaved    = "field_saved"
+	textFieldDeleted  = "field_deleted"
+	textFieldExists   = "field_exists"
+	textFieldNotFound = "field_not_found"
+	textFieldsHelp    = "fields_help"
 )
-
-var units = map[string]bool{
-	unitSupport: true,
-	unitIT:      true,
-	unitBilling: true,
-}
-
-type command struct {
-	MessageText    string
-	HasKeyboard    bool
-	KeyboardButton tgbotapi.ReplyKeyboardMarkup
-}
-
-func getCommand(state redis.ChatData, text string) command {
-	if state.State == "" {
-		return command{}
-	}
-
-	switch state.State {
-	case commandStart:
-		if text != commandStart {
-			return command{
-				MessageText: textUnknown,
-			}
-		}
-
-		return command{
-			MessageText: textHello,
-			HasKeyboard: true,
-			KeyboardButton: tgbotapi.NewReplyKeyboard(
-				tgbotapi.NewKeyboardButtonRow(
-					tgbotapi.NewKeyboardButton(commandNew),
-					tgbotapi.NewKeyboardButton(commandAdmin),
-				),
-			),
-		}
-
-	case commandNew:
-		if text != commandNew {
-			return command{
-				MessageText: textUnknown,
-			}
-		}
-
-		return command{
-			MessageText: textSelectUnit,
-			HasKeyboard: true,
-			KeyboardButton: tgbotapi.NewReplyKeyboard(
-				tgbotapi.NewKeyboardButtonRow(
-					tgbotapi.NewKeyboardButton(unitSupport),
-					tgbotapi.NewKeyboardButton(unitIT),
-					tgbotapi.NewKeyboardButton(unitBilling),
-				),
-			),
-		}
-
-	case commandAdmin:
-		if text != commandAdmin {
-			return command{
-				MessageText: textUnknown,
-			}
-		}
-
-		return command{
-			MessageText: textAdminKey,
-		}
-
-	case commandAdminLoggedIn:
-		return command{
-			MessageText: textAdminWelcome,
-		}
-
-	case commandAdminWrong:
-		return command{
-			MessageText: textAdminWrongKey,
-		}
-
-	case commandUnit:
-		if _, exists := units[text]; !exists {
-			return command{
-				MessageText: textUnknown,
-			}
-		}
-
-		return command{
-			MessageText: textName,
-		}
-
-	case commandName:
-		return command{
-			MessageText: textDescription,
-		}
-
-	case commandDescription:
-		data := state.Data
-
-		return command{
-			MessageText: fmt.Sprintf(textSubmit, data.Unit, data.Name, data.Description),
-			HasKeyboard: true,
-			KeyboardButton: tgbotapi.NewReplyKeyboard(
-				tgbotapi.NewKeyboardButtonRow(
-					tgbotapi.NewKeyboardButton(textSubmitYes),
-					tgbotapi.NewKeyboardButton(textSubmitNo),
-				),
-			),
-		}
-
-	case commandDone:
-		switch text {
-		case textSubmitYes:
-			return command{
-				MessageText: textSubmitSuccess,
-			}
-
-		case textSubmitNo:
-			return command{
-				MessageText: textSubmitFailure,
-				HasKeyboard: true,
-				KeyboardButton: tgbotapi.NewReplyKeyboard(
-					tgbotapi.NewKeyboardButtonRow(
-						tgbotapi.NewKeyboardButton(commandNew),
-					),
-				),
-			}
-
-		default:
-			return command{
-				MessageText: textUnknown,
-			}
-		}
-
-	default:
-		return command{
-			MessageText: textUnknown,
-		}
-	}
-}
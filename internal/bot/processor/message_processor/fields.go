@@ -0,0 +1,272 @@
+package message_processor
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/bot/processor"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/rbac"
+	rmodels "github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/pkg/errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Обязательность поля в /field_add, по умолчанию поле обязательное
+const (
+	fieldRequired = "required"
+	fieldOptional = "optional"
+)
+
+// Ключ поля - в ответах тикета, поэтому только латиница, цифры и подчеркивание
+var fieldKeyRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// processFields: /fields <подразделение> показывает дополнительные поля опроса
+func (mp *messageProcessor) processFields(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	unit := strings.TrimSpace(args)
+	if unit == "" {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textFieldsHelp))
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), unit, rbac.PermissionManageUnits)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	if _, err = mp.repo.GetUnit(ctx, unit); err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitNotFound))
+		}
+
+		return errors.Wrap(err, "repo.GetUnit")
+	}
+
+	fields, err := mp.repo.GetUnitFields(ctx, unit)
+	if err != nil {
+		return errors.Wrap(err, "repo.GetUnitFields")
+	}
+
+	if len(fields) == 0 {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textFieldsEmpty, i18n.Args{"unit": unit})+tr(ctx, textFieldsHelp))
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString(tr(ctx, textFields, i18n.Args{"unit": unit}))
+
+	for _, v := range fields {
+		required := fieldRequired
+		if !v.Required {
+			required = fieldOptional
+		}
+
+		sb.WriteString(tr(ctx, textField, i18n.Args{
+			"key":      v.Key,
+			"label":    v.Label,
+			"type":     rmodels.FieldTypeName(i18n.FromContext(ctx), v.Type),
+			"required": required,
+			"rule":     fieldRule(v),
+		}))
+	}
+
+	return sendText(botAPI, msg.Chat.ID, sb.String()+tr(ctx, textFieldsHelp))
+}
+
+// processFieldAdd: /field_add <подразделение> | <ключ> | <вопрос> | <тип> | <обязательное> | <правило>,
+// два последних аргумента необязательные
+func (mp *messageProcessor) processFieldAdd(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	ss := strings.Split(args, "|")
+	for i := range ss {
+		ss[i] = strings.TrimSpace(ss[i])
+	}
+
+	if len(ss) < 4 || len(ss) > 6 || ss[0] == "" || ss[2] == "" || !fieldKeyRegexp.MatchString(ss[1]) {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textFieldsHelp))
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), ss[0], rbac.PermissionManageUnits)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	field := rmodels.UnitField{
+		Unit:     ss[0],
+		Key:      ss[1],
+		Label:    ss[2],
+		Type:     strings.ToLower(ss[3]),
+		Required: true,
+	}
+
+	if len(ss) > 4 && ss[4] != "" {
+		switch strings.ToLower(ss[4]) {
+		case fieldRequired:
+		case fieldOptional:
+			field.Required = false
+		default:
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textFieldsHelp))
+		}
+	}
+
+	rule := ""
+	if len(ss) > 5 {
+		rule = ss[5]
+	}
+
+	if !parseFieldRule(&field, rule) {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textFieldsHelp))
+	}
+
+	if err = mp.repo.SaveUnitField(ctx, field); err != nil {
+		switch {
+		case errors.Is(err, rmodels.ErrNotFound):
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitNotFound))
+		case errors.Is(err, rmodels.ErrAlreadyExists):
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textFieldExists))
+		}
+
+		return errors.Wrap(err, "repo.SaveUnitField")
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textFieldSaved, i18n.Args{"label": field.Label, "unit": field.Unit}))
+}
+
+// processFieldDelete: /field_delete <подразделение> | <ключ>
+func (mp *messageProcessor) processFieldDelete(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	ss, ok := splitArgs(args, 2)
+	if !ok {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textFieldsHelp))
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), ss[0], rbac.PermissionManageUnits)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	if err = mp.repo.DeleteUnitField(ctx, ss[0], ss[1]); err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textFieldNotFound))
+		}
+
+		return errors.Wrap(err, "repo.DeleteUnitField")
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textFieldDeleted, i18n.Args{"key": ss[1], "unit": ss[0]}))
+}
+
+// parseFieldRule разбирает правило поля: варианты через запятую для choice,
+// границы "мин..макс" для number и длины text, /выражение/ для text
+func parseFieldRule(field *rmodels.UnitField, rule string) bool {
+	switch field.Type {
+	case rmodels.FieldChoice:
+		for _, v := range strings.Split(rule, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				field.Options = append(field.Options, v)
+			}
+		}
+
+		return len(field.Options) > 0
+
+	case rmodels.FieldDate:
+		return rule == ""
+
+	case rmodels.FieldText:
+		if len(rule) > 1 && strings.HasPrefix(rule, "/") && strings.HasSuffix(rule, "/") {
+			field.Pattern = rule[1 : len(rule)-1]
+			_, err := regexp.Compile(field.Pattern)
+
+			return err == nil
+		}
+
+		fallthrough
+
+	case rmodels.FieldNumber:
+		if rule == "" {
+			return true
+		}
+
+		from, to, found := strings.Cut(rule, "..")
+		if !found {
+			return false
+		}
+
+		var ok bool
+		if field.Min, ok = parseBound(from); !ok {
+			return false
+		}
+
+		if field.Max, ok = parseBound(to); !ok {
+			return false
+		}
+
+		return field.Min == nil || field.Max == nil || *field.Min <= *field.Max
+
+	default:
+		return false
+	}
+}
+
+// parseBound - граница правила, пустая строка - без границы
+func parseBound(s string) (*float64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, true
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	return &v, true
+}
+
+// fieldRule - правило поля в записи /field_add
+func fieldRule(field rmodels.UnitField) string {
+	switch {
+	case len(field.Options) > 0:
+		return strings.Join(field.Options, ", ")
+	case field.Pattern != "":
+		return "/" + field.Pattern + "/"
+	case field.Min != nil || field.Max != nil:
+		var from, to string
+		if field.Min != nil {
+			from = strconv.FormatFloat(*field.Min, 'f', -1, 64)
+		}
+
+		if field.Max != nil {
+			to = strconv.FormatFloat(*field.Max, 'f', -1, 64)
+		}
+
+		return from + ".." + to
+	default:
+		return "-"
+	}
+}
@@ -0,0 +1,210 @@
+package message_processor
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/bot/processor"
+	"github.com/goddeuce1/tg_bot_tz/internal/forum"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/rbac"
+	rmodels "github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/goddeuce1/tg_bot_tz/internal/tickets"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Значение второго аргумента /group_bind, включающее темы форума
+const groupTopics = "topics"
+
+// processGroupMessage обрабатывает сообщение в группе подразделения. Бот отвечает
+// клиенту, только если админ пишет в тему тикета или отвечает (reply) на сообщение о тикете,
+// остальная переписка в группе его не касается
+func (mp *messageProcessor) processGroupMessage(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	if msg.ReplyToMessage == nil || msg.From == nil || msg.From.IsBot {
+		return nil
+	}
+
+	ticket, err := mp.groupTicket(ctx, msg)
+	if err != nil {
+		return errors.Wrap(err, "groupTicket")
+	}
+
+	if ticket == nil {
+		return nil
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, msg.From.ID, ticket.Unit, rbac.PermissionAnswerTickets)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		if _, err = botAPI.Send(replyMessage(msg, tr(ctx, textNotAdmin))); err != nil {
+			return errors.Wrap(err, "botAPI.Send")
+		}
+
+		return nil
+	}
+
+	return mp.processAdminReply(ctx, msg, ticket, botAPI)
+}
+
+// groupTicket ищет тикет, к которому относится сообщение в группе. Сообщения в теме
+// приходят ответом на служебное сообщение о создании темы, его id - id темы.
+// nil - сообщение не относится ни к одному тикету
+func (mp *messageProcessor) groupTicket(ctx context.Context, msg *tgbotapi.Message) (*rmodels.Ticket, error) {
+	ticket, err := mp.repo.GetTopicTicket(ctx, msg.Chat.ID, msg.ReplyToMessage.MessageID)
+	if err == nil {
+		return ticket, nil
+	}
+
+	if !errors.Is(err, rmodels.ErrNotFound) {
+		return nil, errors.Wrap(err, "repo.GetTopicTicket")
+	}
+
+	reference, ok := tickets.ParseTicketReference(msg.ReplyToMessage.Text)
+	if !ok {
+		return nil, nil
+	}
+
+	ticket, err = mp.repo.GetTicketByReference(ctx, reference)
+	if err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return nil, nil
+		}
+
+		return nil, errors.Wrap(err, "repo.GetTicketByReference")
+	}
+
+	return ticket, nil
+}
+
+// mirrorToGroup дублирует сообщение переписки в группу подразделения: text с markup -
+// для первой части сообщения, вложение копируется из исходного сообщения.
+// false - подразделение работает через личные чаты админов
+func (mp *messageProcessor) mirrorToGroup(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	ticket rmodels.Ticket,
+	text string,
+	markup interface{},
+	first bool,
+	botAPI *tgbotapi.BotAPI,
+) (bool, error) {
+	chatID, threadID, ok, err := tickets.TicketThread(ctx, mp.repo, ticket)
+	if err != nil {
+		return false, errors.Wrap(err, "tickets.TicketThread")
+	}
+
+	if !ok {
+		return false, nil
+	}
+
+	if first {
+		if _, err = forum.SendMessage(botAPI, chatID, threadID, text, markup); err != nil {
+			return false, errors.Wrap(err, "forum.SendMessage")
+		}
+	}
+
+	if _, hasAttachment := attachmentFromMessage(msg); hasAttachment {
+		if err = forum.CopyMessage(botAPI, chatID, threadID, msg.Chat.ID, msg.MessageID); err != nil {
+			return false, errors.Wrap(err, "forum.CopyMessage")
+		}
+	}
+
+	return true, nil
+}
+
+// processGroupBind: /group_bind <подразделение> | topics, отправляется в самой группе.
+// С topics на каждый тикет создается тема форума, бот должен быть админом с правом управлять темами
+func (mp *messageProcessor) processGroupBind(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	unit, mode, _ := strings.Cut(args, "|")
+	unit, mode = strings.TrimSpace(unit), strings.TrimSpace(mode)
+
+	if unit == "" || (mode != "" && mode != groupTopics) || !tickets.IsGroupChat(msg.Chat.ID) {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textGroupHelp))
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), unit, rbac.PermissionManageAgents)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	chatID := msg.Chat.ID
+	group := rmodels.UnitGroup{
+		Unit:   unit,
+		ChatID: &chatID,
+		Topics: mode == groupTopics,
+	}
+
+	if err = mp.repo.SetUnitGroup(ctx, group); err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitNotFound))
+		}
+
+		return errors.Wrap(err, "repo.SetUnitGroup")
+	}
+
+	text := textGroupBound
+	if group.Topics {
+		text = textGroupBoundTopics
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, text, i18n.Args{"unit": unit}))
+}
+
+// processGroupUnbind: /group_unbind <подразделение>, тикеты снова уходят в личные чаты админов
+func (mp *messageProcessor) processGroupUnbind(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	if args == "" {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textGroupHelp))
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), args, rbac.PermissionManageAgents)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	if err = mp.repo.SetUnitGroup(ctx, rmodels.UnitGroup{Unit: args}); err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitNotFound))
+		}
+
+		return errors.Wrap(err, "repo.SetUnitGroup")
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textGroupUnbound, i18n.Args{"unit": args}))
+}
+
+// replyMessage отвечает на msg. В группе ответ (reply) попадает в ту же тему, что и msg
+func replyMessage(msg *tgbotapi.Message, text string) tgbotapi.MessageConfig {
+	msgToSend := tgbotapi.NewMessage(msg.Chat.ID, text)
+	msgToSend.ParseMode = i18n.ParseMode()
+
+	if tickets.IsGroupChat(msg.Chat.ID) {
+		msgToSend.ReplyToMessageID = msg.MessageID
+	}
+
+	return msgToSend
+}
@@ -0,0 +1,74 @@
+package message_processor
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/bot/processor"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/invites"
+	"github.com/goddeuce1/tg_bot_tz/internal/rbac"
+	rmodels "github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// processInviteCreate: /invite <подразделение> | <роль>.
+// Агентов приглашает руководитель подразделения, руководителей и владельцев - владелец
+func (mp *messageProcessor) processInviteCreate(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	unit, role, _ := strings.Cut(args, "|")
+	unit = strings.TrimSpace(unit)
+	role = strings.TrimSpace(role)
+
+	if role == "" {
+		role = rmodels.RoleAgent
+	}
+
+	if unit == "" || (role != rmodels.RoleAgent && role != rmodels.RoleSupervisor && role != rmodels.RoleOwner) {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textInviteHelp))
+	}
+
+	permission := rbac.PermissionManageInvites
+	if role == rmodels.RoleAgent {
+		permission = rbac.PermissionManageAgents
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), unit, permission)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	if _, err = mp.repo.GetUnit(ctx, unit); err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitNotFound))
+		}
+
+		return errors.Wrap(err, "repo.GetUnit")
+	}
+
+	createdBy := processor.SenderID(msg)
+
+	token, err := invites.Create(ctx, mp.repo, unit, role, &createdBy)
+	if err != nil {
+		return errors.Wrap(err, "invites.Create")
+	}
+
+	text := tr(ctx, textInvite, i18n.Args{
+		"unit":    unit,
+		"role":    rmodels.RoleName(i18n.FromContext(ctx), role),
+		"expires": time.Now().Add(invites.TTL).Format("02.01.2006 15:04"),
+		"link":    invites.Link(botAPI.Self.UserName, token),
+		"code":    token,
+	})
+
+	return sendText(botAPI, msg.Chat.ID, text)
+}
@@ -0,0 +1,61 @@
+package message_processor
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/tickets"
+	"github.com/pkg/errors"
+	"slices"
+	"strings"
+)
+
+// Аргумент /lang, который возвращает язык телеграма
+const langAuto = "auto"
+
+// processLang: /lang показывает языки, /lang <код> выбирает язык чата,
+// /lang auto - снова язык из настроек телеграма
+func (mp *messageProcessor) processLang(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	code := strings.ToLower(strings.TrimSpace(args))
+
+	switch {
+	case code == "":
+		var sb strings.Builder
+		for _, v := range i18n.Supported() {
+			sb.WriteString(tr(ctx, textLanguage, i18n.Args{"code": v, "name": i18n.Name(v)}))
+		}
+
+		current := i18n.FromContext(ctx)
+
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textLanguages, i18n.Args{
+			"current":   i18n.Name(current),
+			"languages": i18n.Safe(sb.String()),
+		}))
+
+	case code == langAuto:
+		if err := mp.repo.SetLanguage(ctx, msg.Chat.ID, ""); err != nil {
+			return errors.Wrap(err, "repo.SetLanguage")
+		}
+
+	case slices.Contains(i18n.Supported(), code):
+		if err := mp.repo.SetLanguage(ctx, msg.Chat.ID, code); err != nil {
+			return errors.Wrap(err, "repo.SetLanguage")
+		}
+
+	default:
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textLanguageUnknown))
+	}
+
+	// Отвечаем уже на новом языке
+	lang, err := tickets.ChatLang(ctx, mp.repo, msg.Chat.ID)
+	if err != nil {
+		return errors.Wrap(err, "tickets.ChatLang")
+	}
+
+	return sendText(botAPI, msg.Chat.ID, i18n.T(lang, textLanguageSaved, i18n.Args{"name": i18n.Name(lang)}))
+}
@@ -0,0 +1,57 @@
+package message_processor
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/redis"
+	"github.com/pkg/errors"
+	"math"
+	"time"
+)
+
+// registerLoginFailure считает неудачную попытку входа и при всплеске попыток
+// со всех чатов предупреждает руководителей подразделений
+func (mp *messageProcessor) registerLoginFailure(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	botAPI *tgbotapi.BotAPI,
+) (redis.LoginFailure, error) {
+	failure, err := mp.loginGuard.RegisterLoginFailure(ctx, msg.Chat.ID)
+	if err != nil {
+		return redis.LoginFailure{}, errors.Wrap(err, "loginGuard.RegisterLoginFailure")
+	}
+
+	mp.logger.Warnf("Failed admin login from chat %d (%s), chat failures = %d, global failures = %d",
+		msg.Chat.ID, userName(msg.From), failure.ChatFailures, failure.GlobalFailures)
+
+	if !failure.Spike {
+		return failure, nil
+	}
+
+	chatIDs, err := mp.repo.GetSupervisorChats(ctx)
+	if err != nil {
+		return redis.LoginFailure{}, errors.Wrap(err, "repo.GetSupervisorChats")
+	}
+
+	args := i18n.Args{
+		"failures": failure.GlobalFailures,
+		"minutes":  int(redis.LoginGlobalWindow.Minutes()),
+		"chat":     msg.Chat.ID,
+		"user":     userName(msg.From),
+	}
+
+	// Предупреждение не должно мешать ответу пользователю, ошибки только логируем
+	for _, v := range chatIDs {
+		if errSend := mp.sendChatText(ctx, botAPI, v, textLoginSpike, args); errSend != nil {
+			mp.logger.Errorf("Cannot send login spike alert to chat %d, Error = %s", v, errSend)
+		}
+	}
+
+	return failure, nil
+}
+
+// waitMinutes округляет время блокировки вверх до минут
+func waitMinutes(d time.Duration) int {
+	return int(math.Ceil(d.Minutes()))
+}
@@ -3,10 +3,16 @@ package message_processor
 import (
 	"context"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/bot/processor"
+	"github.com/goddeuce1/tg_bot_tz/internal/fsm"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/invites"
 	"github.com/goddeuce1/tg_bot_tz/internal/kafka/producer"
+	"github.com/goddeuce1/tg_bot_tz/internal/rbac"
 	"github.com/goddeuce1/tg_bot_tz/internal/repository"
+	rmodels "github.com/goddeuce1/tg_bot_tz/internal/repository/models"
 	"github.com/goddeuce1/tg_bot_tz/internal/repository/redis"
-	"github.com/goddeuce1/tg_bot_tz/internal/tickets/models"
+	"github.com/goddeuce1/tg_bot_tz/internal/tickets"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"strings"
@@ -15,24 +21,32 @@ import (
 type messageProcessor struct {
 	repo          repository.Repository
 	stateOperator redis.StateOperator
+	presence      redis.PresenceOperator
+	loginGuard    redis.LoginGuardOperator
 	kafkaProducer producer.Producer
+	authorizer    rbac.Authorizer
+	wizard        *fsm.Machine
 	logger        *logrus.Logger
-	adminKey      string
 }
 
 func NewMessageProcessor(
 	repo repository.Repository,
 	redisDB redis.StateOperator,
+	presence redis.PresenceOperator,
+	loginGuard redis.LoginGuardOperator,
 	kafkaProducer producer.Producer,
+	authorizer rbac.Authorizer,
 	logger *logrus.Logger,
-	adminKey string,
 ) *messageProcessor {
 	return &messageProcessor{
 		repo:          repo,
 		stateOperator: redisDB,
+		presence:      presence,
+		loginGuard:    loginGuard,
 		kafkaProducer: kafkaProducer,
+		authorizer:    authorizer,
+		wizard:        fsm.NewTicketWizard(),
 		logger:        logger,
-		adminKey:      adminKey,
 	}
 }
 
@@ -42,179 +56,434 @@ func (mp *messageProcessor) Process(ctx context.Context, processorData interface
 		return errors.New("not message")
 	}
 
-	switch msg.Text {
-	case commandStart:
-		if err := mp.stateOperator.SetState(ctx, msg.Chat.ID, redis.ChatData{}); err != nil {
-			return errors.Wrap(err, "stateOperator.SetState")
-		}
+	name, args := parseCommand(msg.Text)
+	if cmd, exists := adminCommands[name]; exists {
+		return cmd.handler(mp, ctx, msg, args, botAPI)
+	}
 
-		data := redis.ChatData{
-			State: commandStart,
-		}
+	// Язык выбирают и клиенты, и админы, в группе - язык уведомлений группы
+	if name == commandLang {
+		return mp.processLang(ctx, msg, args, botAPI)
+	}
 
-		cmd := getCommand(data, msg.Text)
+	// В группах опрос клиентов не ведется, там только переписка админов по тикетам
+	if msg.Chat.IsGroup() || msg.Chat.IsSuperGroup() {
+		return mp.processGroupMessage(ctx, msg, botAPI)
+	}
 
-		msgToSend := tgbotapi.NewMessage(msg.Chat.ID, cmd.MessageText)
-		if cmd.HasKeyboard {
-			msgToSend.ReplyMarkup = cmd.KeyboardButton
-		}
+	// Deep link приглашения: t.me/<bot>?start=<код>
+	if name == fsm.CommandStart && args != "" {
+		return mp.processInvite(ctx, msg, args, botAPI)
+	}
 
-		if _, err := botAPI.Send(msgToSend); err != nil {
-			return errors.Wrap(err, "botAPI.Send")
+	if msg.Text == fsm.CommandMyTickets {
+		return mp.processMyTickets(ctx, msg, botAPI)
+	}
+
+	if !mp.wizard.IsCommand(msg.Text) {
+		// Ответ (reply) на сообщение бота о тикете - переписка по тикету
+		if msg.ReplyToMessage != nil {
+			if reference, ok := tickets.ParseTicketReference(msg.ReplyToMessage.Text); ok {
+				return mp.processTicketMessage(ctx, msg, reference, botAPI)
+			}
 		}
 
-	case commandNew:
-		data := redis.ChatData{
-			State: commandNew,
+		// Остальные части уже закрепленного альбома идут туда же, куда и первая
+		if attachment, hasAttachment := attachmentFromMessage(msg); hasAttachment && msg.MediaGroupID != "" {
+			target, err := mp.stateOperator.GetMediaGroup(ctx, msg.MediaGroupID)
+			if err != nil {
+				return errors.Wrap(err, "stateOperator.GetMediaGroup")
+			}
+
+			if target == mediaGroupDraft {
+				if _, err = mp.stateOperator.AddDraftAttachment(ctx, msg.Chat.ID, attachment); err != nil {
+					return errors.Wrap(err, "stateOperator.AddDraftAttachment")
+				}
+
+				return nil
+			}
+
+			if target != "" {
+				return mp.processTicketMessage(ctx, msg, target, botAPI)
+			}
 		}
+	}
 
-		cmd := getCommand(data, msg.Text)
+	return mp.processWizard(ctx, msg, botAPI)
+}
+
+// processMyTickets показывает клиенту его заявки
+func (mp *messageProcessor) processMyTickets(ctx context.Context, msg *tgbotapi.Message, botAPI *tgbotapi.BotAPI) error {
+	text, markup, err := tickets.BuildClientTicketsWithMarkup(ctx, mp.repo, i18n.FromContext(ctx), msg.Chat.ID, 0)
+	if err != nil {
+		return errors.Wrap(err, "tickets.BuildClientTicketsWithMarkup")
+	}
+
+	msgToSend := tgbotapi.NewMessage(msg.Chat.ID, text)
+	msgToSend.ParseMode = i18n.ParseMode()
+
+	if len(markup.InlineKeyboard) > 0 {
+		msgToSend.ReplyMarkup = markup
+	}
+
+	if _, err = botAPI.Send(msgToSend); err != nil {
+		return errors.Wrap(err, "botAPI.Send")
+	}
 
-		data.State = commandUnit
+	return nil
+}
 
-		if err := mp.stateOperator.SetState(ctx, msg.Chat.ID, data); err != nil {
-			return errors.Wrap(err, "stateOperator.SetState")
+// Permission определяет право, нужное для сообщения: команды админов - по реестру,
+// ответ (reply) на чужой тикет - право отвечать в подразделении тикета
+func (mp *messageProcessor) Permission(ctx context.Context, processorData interface{}) (rbac.Request, error) {
+	msg, ok := processorData.(*tgbotapi.Message)
+	if !ok {
+		return rbac.Request{}, errors.New("not message")
+	}
+
+	name, _ := parseCommand(msg.Text)
+	if cmd, exists := adminCommands[name]; exists {
+		return rbac.Request{Permission: cmd.permission}, nil
+	}
+
+	if msg.ReplyToMessage == nil {
+		return rbac.Request{}, nil
+	}
+
+	reference, ok := tickets.ParseTicketReference(msg.ReplyToMessage.Text)
+	if !ok {
+		return rbac.Request{}, nil
+	}
+
+	ticket, err := mp.repo.GetTicketByReference(ctx, reference)
+	if err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return rbac.Request{}, nil
 		}
 
-		msgToSend := tgbotapi.NewMessage(msg.Chat.ID, cmd.MessageText)
+		return rbac.Request{}, errors.Wrap(err, "repo.GetTicketByReference")
+	}
+
+	if ticket.ChatID == msg.Chat.ID {
+		return rbac.Request{}, nil
+	}
+
+	return rbac.Request{Permission: rbac.PermissionAnswerTickets, Unit: ticket.Unit}, nil
+}
+
+// processAdmin принимает код приглашения, введенный после /admin
+func (mp *messageProcessor) processAdmin(ctx context.Context, msg *tgbotapi.Message, botAPI *tgbotapi.BotAPI) error {
+	return mp.processInvite(ctx, msg, strings.TrimSpace(msg.Text), botAPI)
+}
+
+// processInvite гасит приглашение token и добавляет чат в админы подразделения.
+// Неверный код в админы не пускает: чат добавляет только RedeemInvite, и только по живому приглашению
+func (mp *messageProcessor) processInvite(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	token string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	// Во время блокировки код не проверяем вовсе, иначе перебор продолжится
+	locked, err := mp.loginGuard.GetLoginLock(ctx, msg.Chat.ID)
+	if err != nil {
+		return errors.Wrap(err, "loginGuard.GetLoginLock")
+	}
+
+	if locked > 0 {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textAdminLocked, i18n.Args{"n": waitMinutes(locked)}))
+	}
+
+	data := redis.ChatData{
+		State: fsm.StateAdminLoggedIn,
+	}
+
+	invite, err := mp.repo.RedeemInvite(ctx, invites.Hash(token), msg.Chat.ID, userName(msg.From))
+	if err != nil && !errors.Is(err, rmodels.ErrNotFound) {
+		return errors.Wrap(err, "repo.RedeemInvite")
+	}
+
+	attempt := rmodels.LoginAttempt{
+		ChatID:   msg.Chat.ID,
+		UserName: userName(msg.From),
+		Success:  invite != nil,
+	}
 
-		if cmd.HasKeyboard {
-			msgToSend.ReplyMarkup = cmd.KeyboardButton
+	if err = mp.repo.SaveLoginAttempt(ctx, attempt); err != nil {
+		return errors.Wrap(err, "repo.SaveLoginAttempt")
+	}
+
+	text := tr(ctx, textAdminWrongKey)
+	if invite != nil {
+		text = tr(ctx, textAdminWelcome, i18n.Args{"unit": invite.Unit, "role": rmodels.RoleName(i18n.FromContext(ctx), invite.Role)})
+
+		if err = mp.loginGuard.ResetLoginFailures(ctx, msg.Chat.ID); err != nil {
+			return errors.Wrap(err, "loginGuard.ResetLoginFailures")
 		}
 
-		if _, err := botAPI.Send(msgToSend); err != nil {
-			return errors.Wrap(err, "botAPI.Send")
+		// Только что вошедший админ сразу на смене
+		if err = mp.presence.SetOnline(ctx, msg.Chat.ID); err != nil {
+			return errors.Wrap(err, "presence.SetOnline")
 		}
+	} else {
+		data.State = fsm.StateAdminWrong
 
-	case commandAdmin:
-		data := redis.ChatData{
-			State: commandAdmin,
+		failure, errFailure := mp.registerLoginFailure(ctx, msg, botAPI)
+		if errFailure != nil {
+			return errors.Wrap(errFailure, "registerLoginFailure")
 		}
 
-		cmd := getCommand(data, msg.Text)
+		if failure.LockedFor > 0 {
+			text += tr(ctx, textAdminLockedNext, i18n.Args{"n": waitMinutes(failure.LockedFor)})
+		}
+	}
 
-		data.State = commandAdminKey
+	if err = mp.stateOperator.SetState(ctx, msg.Chat.ID, data); err != nil {
+		return errors.Wrap(err, "stateOperator.SetState")
+	}
 
-		if err := mp.stateOperator.SetState(ctx, msg.Chat.ID, data); err != nil {
-			return errors.Wrap(err, "stateOperator.SetState")
-		}
+	msgToSend := tgbotapi.NewMessage(msg.Chat.ID, text)
+	msgToSend.ParseMode = i18n.ParseMode()
+	msgToSend.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
 
-		msgToSend := tgbotapi.NewMessage(msg.Chat.ID, cmd.MessageText)
-		msgToSend.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+	if _, err = botAPI.Send(msgToSend); err != nil {
+		return errors.Wrap(err, "botAPI.Send")
+	}
 
-		if _, err := botAPI.Send(msgToSend); err != nil {
-			return errors.Wrap(err, "botAPI.Send")
+	return nil
+}
+
+// processTicketMessage определяет, кто пишет по тикету: клиент или админ подразделения
+func (mp *messageProcessor) processTicketMessage(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	reference string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	ticket, err := mp.repo.GetTicketByReference(ctx, reference)
+	if err != nil && !errors.Is(err, rmodels.ErrNotFound) {
+		return errors.Wrap(err, "repo.GetTicketByReference")
+	}
+
+	if ticket != nil {
+		if ticket.ChatID == msg.Chat.ID {
+			return mp.processClientMessage(ctx, msg, ticket, botAPI)
 		}
 
-		// Обработка ввода пользователя
-	default:
-		state, err := mp.stateOperator.GetState(ctx, msg.Chat.ID)
-		if err != nil {
-			return errors.Wrap(err, "stateOperator.GetState")
+		allowed, errAllowed := mp.authorizer.Can(ctx, processor.SenderID(msg), ticket.Unit, rbac.PermissionAnswerTickets)
+		if errAllowed != nil {
+			return errors.Wrap(errAllowed, "authorizer.Can")
 		}
 
-		// Состояние пользователя при опросе
-		chatData := redis.ChatData{
-			State: commandUnknown,
-			Data:  state.Data,
+		if allowed {
+			return mp.processAdminReply(ctx, msg, ticket, botAPI)
 		}
+	}
 
-		switch state.State {
-		case commandUnit:
-			chatData.State = commandName
-			chatData.Data.Unit = msg.Text
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnknown))
+}
 
-		case commandName:
-			chatData.State = commandDescription
-			chatData.Data.Name = msg.Text
+// processClientMessage сохраняет сообщение клиента в переписку и пересылает его админам
+func (mp *messageProcessor) processClientMessage(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	ticket *rmodels.Ticket,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	if ticket.Status == rmodels.StatusClosed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textTicketClosed, i18n.Args{"ticket": ticket.Reference}))
+	}
 
-		case commandDescription:
-			chatData.State = commandDone
-			chatData.Data.Description = msg.Text
+	first, err := mp.saveThreadMessage(ctx, msg, ticket, false)
+	if err != nil {
+		return errors.Wrap(err, "saveThreadMessage")
+	}
 
-		case commandAdminKey:
-			return mp.processAdmin(ctx, msg, botAPI)
+	adminsMap, err := tickets.TicketAdmins(ctx, mp.repo, *ticket)
+	if err != nil {
+		return errors.Wrap(err, "tickets.TicketAdmins")
+	}
 
-		case commandAdminLoggedIn:
-			return nil
+	groupLang, err := tickets.ThreadLang(ctx, mp.repo, *ticket)
+	if err != nil {
+		return errors.Wrap(err, "tickets.ThreadLang")
+	}
 
-		default:
-			chatData.State = commandUnknown
-		}
+	data, err := tickets.LoadTicketData(ctx, mp.repo, *ticket)
+	if err != nil {
+		return errors.Wrap(err, "tickets.LoadTicketData")
+	}
 
-		state.Data = chatData.Data
+	groupText, groupMarkup := tickets.BuildClientMessageWithMarkup(groupLang, data, threadText(groupLang, msg))
 
-		// Отправка сообщения в чат
-		textData := getCommand(*state, msg.Text)
-		if textData.MessageText != "" {
-			msgToSend := tgbotapi.NewMessage(msg.Chat.ID, textUnknown)
+	inGroup, err := mp.mirrorToGroup(ctx, msg, *ticket, groupText, groupMarkup, first, botAPI)
+	if err != nil {
+		return errors.Wrap(err, "mirrorToGroup")
+	}
 
-			msgToSend.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
-			msgToSend.Text = textData.MessageText
+	// Не взятый тикет в группе и так видят все админы, лично пишем только исполнителю
+	if inGroup && ticket.Assignee == nil {
+		adminsMap = nil
+	}
 
-			if textData.HasKeyboard {
-				msgToSend.ReplyMarkup = textData.KeyboardButton
+	for k := range adminsMap {
+		if first {
+			lang, errLang := tickets.ChatLang(ctx, mp.repo, k)
+			if errLang != nil {
+				return errors.Wrap(errLang, "tickets.ChatLang")
 			}
 
+			text, markup := tickets.BuildClientMessageWithMarkup(lang, data, threadText(lang, msg))
+
+			msgToSend := tgbotapi.NewMessage(k, text)
+			msgToSend.ParseMode = i18n.ParseMode()
+			msgToSend.ReplyMarkup = markup
+
 			if _, err = botAPI.Send(msgToSend); err != nil {
 				return errors.Wrap(err, "botAPI.Send")
 			}
 		}
 
-		// Состояние пользователя при опросе, сейвим в кеш с ттл
-		if textData.MessageText != textUnknown && state.State != commandDone {
-			if err = mp.stateOperator.SetState(ctx, msg.Chat.ID, chatData); err != nil {
-				return errors.Wrap(err, "stateOperator.SetState")
-			}
+		if err = copyAttachment(msg, k, botAPI); err != nil {
+			return errors.Wrap(err, "copyAttachment")
 		}
+	}
 
-		// Здесь логика с отправкой админу
-		// Шлем тут в кафку (для контроля нагрузки)
-		// Кафка в отдельном месте читает и записывает в постгрес
-		// Затем шлет обращение в чат админа
-		// Kafka UI на 8090 порту
-		if msg.Text == textSubmitYes && state.State == commandDone {
-			data := models.Ticket{
-				ChatID:      msg.Chat.ID,
-				Unit:        state.Data.Unit,
-				Name:        state.Data.Name,
-				Description: state.Data.Description,
-			}
+	if !first {
+		return nil
+	}
 
-			if err = mp.kafkaProducer.SendMessage(ctx, "tickets", data); err != nil {
-				return errors.Wrap(err, "kafkaProducer.SendMessage")
-			}
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textFollowUpSaved, i18n.Args{"ticket": ticket.Reference}))
+}
+
+// processAdminReply сохраняет ответ админа в переписку и отправляет его клиенту
+func (mp *messageProcessor) processAdminReply(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	ticket *rmodels.Ticket,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	if ticket.Status == rmodels.StatusClosed {
+		msgToSend := replyMessage(msg, tr(ctx, textTicketClosed, i18n.Args{"ticket": ticket.Reference}))
+
+		if _, err := botAPI.Send(msgToSend); err != nil {
+			return errors.Wrap(err, "botAPI.Send")
 		}
+
+		return nil
 	}
 
-	return nil
-}
+	if ticket.Assignee != nil && *ticket.Assignee != processor.SenderID(msg) {
+		msgToSend := replyMessage(msg, tr(ctx, textTicketTaken, i18n.Args{"ticket": ticket.Reference, "assignee": ticket.AssigneeName}))
 
-func (mp *messageProcessor) processAdmin(ctx context.Context, msg *tgbotapi.Message, botAPI *tgbotapi.BotAPI) error {
-	data := redis.ChatData{
-		State: commandAdminLoggedIn,
+		if _, err := botAPI.Send(msgToSend); err != nil {
+			return errors.Wrap(err, "botAPI.Send")
+		}
+
+		return nil
 	}
 
-	ss := strings.Split(msg.Text, " ")
-	if _, exists := units[ss[0]]; !(exists && ss[1] == mp.adminKey) {
-		data.State = commandAdminWrong
+	first, err := mp.saveThreadMessage(ctx, msg, ticket, true)
+	if err != nil {
+		return errors.Wrap(err, "saveThreadMessage")
 	}
 
-	cmd := getCommand(data, msg.Text)
+	data, err := tickets.LoadTicketData(ctx, mp.repo, *ticket)
+	if err != nil {
+		return errors.Wrap(err, "tickets.LoadTicketData")
+	}
 
-	if err := mp.stateOperator.SetState(ctx, msg.Chat.ID, data); err != nil {
-		return errors.Wrap(err, "stateOperator.SetState")
+	if first {
+		lang, errLang := tickets.ChatLang(ctx, mp.repo, ticket.ChatID)
+		if errLang != nil {
+			return errors.Wrap(errLang, "tickets.ChatLang")
+		}
+
+		msgToSend := tgbotapi.NewMessage(ticket.ChatID, tickets.BuildAdminReply(lang, data, threadText(lang, msg)))
+		msgToSend.ParseMode = i18n.ParseMode()
+
+		if _, err = botAPI.Send(msgToSend); err != nil {
+			return errors.Wrap(err, "botAPI.Send")
+		}
+	}
+
+	if err = copyAttachment(msg, ticket.ChatID, botAPI); err != nil {
+		return errors.Wrap(err, "copyAttachment")
 	}
 
-	msgToSend := tgbotapi.NewMessage(msg.Chat.ID, cmd.MessageText)
+	// Ответ из личного чата дублируем в группу подразделения, ответ из группы там уже виден
+	if !tickets.IsGroupChat(msg.Chat.ID) {
+		groupLang, errLang := tickets.ThreadLang(ctx, mp.repo, *ticket)
+		if errLang != nil {
+			return errors.Wrap(errLang, "tickets.ThreadLang")
+		}
 
-	if _, err := botAPI.Send(msgToSend); err != nil {
-		return errors.Wrap(err, "botAPI.Send")
+		groupText := tickets.BuildAdminReply(groupLang, data, threadText(groupLang, msg))
+
+		if _, err = mp.mirrorToGroup(ctx, msg, *ticket, groupText, nil, first, botAPI); err != nil {
+			return errors.Wrap(err, "mirrorToGroup")
+		}
 	}
 
-	if err := mp.repo.SaveAdmins(ctx, []int64{msg.Chat.ID}, ss[0]); err != nil {
-		return errors.Wrap(err, "repo.SaveAdmins")
+	if !first {
+		return nil
+	}
+
+	msgToSend := replyMessage(msg, tr(ctx, textReplySent, i18n.Args{"ticket": ticket.Reference}))
+
+	if _, err = botAPI.Send(msgToSend); err != nil {
+		return errors.Wrap(err, "botAPI.Send")
 	}
 
 	return nil
 }
+
+// saveThreadMessage сохраняет текст и вложение сообщения в переписку по тикету.
+// Возвращает false для не первых частей альбома, по ним не шлем заголовок и подтверждение
+func (mp *messageProcessor) saveThreadMessage(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	ticket *rmodels.Ticket,
+	fromAdmin bool,
+) (bool, error) {
+	attachment, hasAttachment := attachmentFromMessage(msg)
+	if !hasAttachment {
+		message := rmodels.TicketMessage{
+			TicketID:  ticket.ID,
+			ChatID:    processor.SenderID(msg),
+			FromAdmin: fromAdmin,
+			Text:      msg.Text,
+		}
+
+		if err := mp.repo.SaveTicketMessage(ctx, message); err != nil {
+			return false, errors.Wrap(err, "repo.SaveTicketMessage")
+		}
+
+		return true, nil
+	}
+
+	first, err := mp.claimMediaGroup(ctx, msg, ticket.Reference)
+	if err != nil {
+		return false, errors.Wrap(err, "claimMediaGroup")
+	}
+
+	if err = mp.saveTicketAttachment(ctx, msg, ticket, attachment); err != nil {
+		return false, errors.Wrap(err, "saveTicketAttachment")
+	}
+
+	return first, nil
+}
+
+// userName - имя пользователя для подстановки в шаблоны ответов
+func userName(user *tgbotapi.User) string {
+	if user == nil {
+		return ""
+	}
+
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		return user.UserName
+	}
+
+	return name
+}
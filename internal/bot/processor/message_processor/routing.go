@@ -0,0 +1,90 @@
+package message_processor
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/bot/processor"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/rbac"
+	rmodels "github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+// processRouting: /routing <подразделение> показывает распределение тикетов,
+// /routing <подразделение> | <стратегия> | <минут на взятие тикета> меняет его
+func (mp *messageProcessor) processRouting(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	unit, rest, _ := strings.Cut(args, "|")
+	unit = strings.TrimSpace(unit)
+
+	if unit == "" {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textRoutingHelp))
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), unit, rbac.PermissionManageAgents)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	if strings.TrimSpace(rest) == "" {
+		routing, errRouting := mp.repo.GetUnitRouting(ctx, unit)
+		if errRouting != nil {
+			if errors.Is(errRouting, rmodels.ErrNotFound) {
+				return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitNotFound))
+			}
+
+			return errors.Wrap(errRouting, "repo.GetUnitRouting")
+		}
+
+		text := tr(ctx, textRouting, i18n.Args{
+			"unit":     routing.Unit,
+			"strategy": rmodels.RoutingName(i18n.FromContext(ctx), routing.Strategy),
+			"n":        routing.ClaimTimeout,
+		})
+
+		return sendText(botAPI, msg.Chat.ID, text+tr(ctx, textRoutingHelp))
+	}
+
+	ss, ok := splitArgs(rest, 2)
+	if !ok {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textRoutingHelp))
+	}
+
+	if ss[0] != rmodels.RoutingBroadcast && ss[0] != rmodels.RoutingRoundRobin && ss[0] != rmodels.RoutingLeastLoaded {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textRoutingHelp))
+	}
+
+	timeout, err := strconv.Atoi(ss[1])
+	if err != nil || timeout <= 0 {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textRoutingHelp))
+	}
+
+	routing := rmodels.UnitRouting{
+		Unit:         unit,
+		Strategy:     ss[0],
+		ClaimTimeout: timeout,
+	}
+
+	if err = mp.repo.SetUnitRouting(ctx, routing); err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitNotFound))
+		}
+
+		return errors.Wrap(err, "repo.SetUnitRouting")
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textRoutingSaved, i18n.Args{
+		"unit":     unit,
+		"strategy": rmodels.RoutingName(i18n.FromContext(ctx), routing.Strategy),
+	}))
+}
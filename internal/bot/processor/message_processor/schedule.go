@@ -0,0 +1,220 @@
+package message_processor
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/bot/processor"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/rbac"
+	rmodels "github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/goddeuce1/tg_bot_tz/internal/schedule"
+	"github.com/goddeuce1/tg_bot_tz/internal/tickets"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// processHours: /hours <подразделение>, расписание, праздники и автоответ подразделения
+func (mp *messageProcessor) processHours(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	if args == "" {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textHoursHelp))
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), args, rbac.PermissionAnswerTickets)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	s, unitSchedule, err := tickets.UnitSchedule(ctx, mp.repo, args)
+	if err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitNotFound))
+		}
+
+		return errors.Wrap(err, "tickets.UnitSchedule")
+	}
+
+	status := textHoursClosed
+	if s.IsOpen(time.Now()) {
+		status = textHoursOpen
+	}
+
+	holidays := i18n.Plain(i18n.FromContext(ctx), textHoursNoHolidays)
+	if len(unitSchedule.Holidays) > 0 {
+		holidays = strings.Join(unitSchedule.Holidays, ", ")
+	}
+
+	reply := unitSchedule.OffHoursReply
+	if reply == "" {
+		reply = i18n.Plain(i18n.FromContext(ctx), textHoursDefaultReply)
+	}
+
+	text := tr(ctx, textHours, i18n.Args{
+		"unit":     unitSchedule.Unit,
+		"timezone": unitSchedule.Timezone,
+		"status":   i18n.Plain(i18n.FromContext(ctx), status),
+		"hours":    i18n.Safe(schedule.FormatHours(i18n.FromContext(ctx), s)),
+		"holidays": holidays,
+		"reply":    reply,
+	})
+
+	return sendText(botAPI, msg.Chat.ID, text+tr(ctx, textHoursHelp))
+}
+
+// processHoursSet: /hours_set <подразделение> | <часовой пояс> | <расписание>
+func (mp *messageProcessor) processHoursSet(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	ss, ok := splitArgs(args, 3)
+	if !ok {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textHoursHelp))
+	}
+
+	if _, err := time.LoadLocation(ss[1]); err != nil {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textHoursWrongZone))
+	}
+
+	hours, err := schedule.ParseHours(ss[2])
+	if err != nil {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textHoursHelp))
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), ss[0], rbac.PermissionManageSchedule)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	if err = mp.repo.SetUnitHours(ctx, ss[0], ss[1], hours); err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitNotFound))
+		}
+
+		return errors.Wrap(err, "repo.SetUnitHours")
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textHoursSaved, i18n.Args{"unit": ss[0]}))
+}
+
+// processHolidayAdd: /holiday_add <подразделение> | <дата ГГГГ-ММ-ДД>
+func (mp *messageProcessor) processHolidayAdd(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	ss, ok := splitArgs(args, 2)
+	if !ok {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textHoursHelp))
+	}
+
+	day, err := schedule.ParseDate(ss[1])
+	if err != nil {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textHoursHelp))
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), ss[0], rbac.PermissionManageSchedule)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	if err = mp.repo.SaveHoliday(ctx, ss[0], day); err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitNotFound))
+		}
+
+		return errors.Wrap(err, "repo.SaveHoliday")
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textHolidaySaved, i18n.Args{"day": day, "unit": ss[0]}))
+}
+
+// processHolidayDelete: /holiday_delete <подразделение> | <дата ГГГГ-ММ-ДД>
+func (mp *messageProcessor) processHolidayDelete(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	ss, ok := splitArgs(args, 2)
+	if !ok {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textHoursHelp))
+	}
+
+	day, err := schedule.ParseDate(ss[1])
+	if err != nil {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textHoursHelp))
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), ss[0], rbac.PermissionManageSchedule)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	if err = mp.repo.DeleteHoliday(ctx, ss[0], day); err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textHolidayNotFound))
+		}
+
+		return errors.Wrap(err, "repo.DeleteHoliday")
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textHolidayDeleted, i18n.Args{"day": day, "unit": ss[0]}))
+}
+
+// processOffHoursReply: /offhours_reply <подразделение> | <текст>, без текста - автоответ по умолчанию
+func (mp *messageProcessor) processOffHoursReply(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	unit, text, ok := strings.Cut(args, "|")
+	unit, text = strings.TrimSpace(unit), strings.TrimSpace(text)
+
+	if !ok || unit == "" {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textHoursHelp))
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), unit, rbac.PermissionManageSchedule)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	if err = mp.repo.SetOffHoursReply(ctx, unit, text); err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitNotFound))
+		}
+
+		return errors.Wrap(err, "repo.SetOffHoursReply")
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textOffHoursSaved, i18n.Args{"unit": unit}))
+}
@@ -0,0 +1,37 @@
+package message_processor
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/bot/processor"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/rbac"
+	"github.com/pkg/errors"
+)
+
+// processSupervisor: /supervisor <подразделение>, эскалации SLA подразделения будут приходить в текущий чат
+func (mp *messageProcessor) processSupervisor(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	if args == "" {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textSupervisorHelp))
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), args, rbac.PermissionManageAgents)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	if err = mp.repo.SetUnitSupervisor(ctx, args, msg.Chat.ID); err != nil {
+		return errors.Wrap(err, "repo.SetUnitSupervisor")
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textSupervisorSaved, i18n.Args{"unit": args}))
+}
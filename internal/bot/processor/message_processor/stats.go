@@ -0,0 +1,222 @@
+package message_processor
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/bot/processor"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/rbac"
+	rmodels "github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Период статистики по умолчанию
+	statsDefaultPeriod = "7d"
+	statsPeriodToday   = "today"
+	statsMaxDays       = 365
+
+	// Сколько последних дней показывать в разбивке по дням, чтобы таблица влезла в сообщение
+	statsMaxDailyRows = 14
+	// Ширина колонки названий в таблице
+	statsNameWidth = 22
+)
+
+// processStats: /stats [подразделение] [период] показывает статистику обращений.
+// Без подразделения - по всем подразделениям, где у админа есть право смотреть статистику
+func (mp *messageProcessor) processStats(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	unit, period := splitStatsArgs(args)
+
+	now := time.Now()
+
+	since, ok := statsSince(period, now)
+	if !ok {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textStatsHelp))
+	}
+
+	var units []string
+
+	if unit != "" {
+		allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), unit, rbac.PermissionViewStats)
+		if err != nil {
+			return errors.Wrap(err, "authorizer.Can")
+		}
+
+		if !allowed {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+		}
+
+		if _, err = mp.repo.GetUnit(ctx, unit); err != nil {
+			if errors.Is(err, rmodels.ErrNotFound) {
+				return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitNotFound))
+			}
+
+			return errors.Wrap(err, "repo.GetUnit")
+		}
+
+		units = []string{unit}
+	} else {
+		var err error
+
+		units, err = mp.authorizer.Units(ctx, processor.SenderID(msg), rbac.PermissionViewStats)
+		if err != nil {
+			return errors.Wrap(err, "authorizer.Units")
+		}
+
+		if len(units) == 0 {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+		}
+	}
+
+	stats, err := mp.repo.GetStats(ctx, rmodels.StatsFilter{
+		Units:  units,
+		Since:  since,
+		Period: period,
+	})
+	if err != nil {
+		return errors.Wrap(err, "repo.GetStats")
+	}
+
+	msgToSend := tgbotapi.NewMessage(msg.Chat.ID, formatStats(i18n.FromContext(ctx), stats, units, period, since))
+	msgToSend.ParseMode = i18n.ParseMode()
+
+	if _, err = botAPI.Send(msgToSend); err != nil {
+		return errors.Wrap(err, "botAPI.Send")
+	}
+
+	return nil
+}
+
+// splitStatsArgs отделяет период - последнее слово аргументов, если оно на него похоже.
+// Остальное - название подразделения, в нем могут быть пробелы
+func splitStatsArgs(args string) (string, string) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return "", statsDefaultPeriod
+	}
+
+	last := strings.ToLower(fields[len(fields)-1])
+	if isStatsPeriod(last) {
+		return strings.Join(fields[:len(fields)-1], " "), last
+	}
+
+	return strings.Join(fields, " "), statsDefaultPeriod
+}
+
+// isStatsPeriod проверяет, что s записано как период: today или <число>d
+func isStatsPeriod(s string) bool {
+	if s == statsPeriodToday {
+		return true
+	}
+
+	days, ok := strings.CutSuffix(s, "d")
+	if !ok {
+		return false
+	}
+
+	_, err := strconv.Atoi(days)
+
+	return err == nil
+}
+
+// statsSince возвращает начало периода: today - с полуночи, Nd - последние N суток
+func statsSince(period string, now time.Time) (time.Time, bool) {
+	if period == statsPeriodToday {
+		year, month, day := now.Date()
+
+		return time.Date(year, month, day, 0, 0, 0, 0, now.Location()), true
+	}
+
+	days, err := strconv.Atoi(strings.TrimSuffix(period, "d"))
+	if err != nil || days <= 0 || days > statsMaxDays {
+		return time.Time{}, false
+	}
+
+	return now.Add(-time.Duration(days) * 24 * time.Hour), true
+}
+
+// formatStats собирает компактную таблицу статистики на языке lang.
+// Таблица моноширинная, поэтому тексты берутся без разметки и экранируются целиком
+func formatStats(lang string, stats *rmodels.Stats, units []string, period string, since time.Time) string {
+	var sb strings.Builder
+
+	sb.WriteString(i18n.Plain(lang, textStatsTitle, i18n.Args{
+		"units":  strings.Join(units, ", "),
+		"period": period,
+		"since":  since.Format("02.01.2006 15:04"),
+	}))
+
+	total := 0
+	sb.WriteString("\n" + i18n.Plain(lang, textStatsStatuses) + "\n")
+
+	for _, v := range stats.Statuses {
+		total += v.Count
+		sb.WriteString(statsRow(rmodels.StatusName(lang, v.Status), v.Count))
+	}
+
+	sb.WriteString(statsRow(i18n.Plain(lang, textStatsTotal), total))
+
+	if len(stats.Daily) > 0 {
+		daily := stats.Daily
+		if len(daily) > statsMaxDailyRows {
+			daily = daily[len(daily)-statsMaxDailyRows:]
+		}
+
+		sb.WriteString("\n" + i18n.Plain(lang, textStatsDaily) + "\n")
+
+		for _, v := range daily {
+			sb.WriteString(statsRow(v.Day, v.Count))
+		}
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(i18n.Plain(lang, textStatsFirstResponse, i18n.Args{"median": formatMedian(lang, stats.MedianFirstResponse)}))
+	sb.WriteString(i18n.Plain(lang, textStatsResolution, i18n.Args{"median": formatMedian(lang, stats.MedianResolution)}))
+
+	if len(stats.TopAgents) > 0 {
+		sb.WriteString("\n" + i18n.Plain(lang, textStatsTopAgents) + "\n")
+
+		for _, v := range stats.TopAgents {
+			sb.WriteString(statsRow(v.Name, v.Resolved))
+		}
+	}
+
+	return i18n.Pre(sb.String())
+}
+
+// statsRow - строка таблицы: название, выровненное по ширине колонки, и число
+func statsRow(name string, count int) string {
+	runes := []rune(name)
+	if len(runes) > statsNameWidth {
+		runes = append(runes[:statsNameWidth-1], '…')
+	}
+
+	return fmt.Sprintf("%s%s %5d\n", string(runes), strings.Repeat(" ", statsNameWidth-len(runes)), count)
+}
+
+// formatMedian переводит медиану в секундах в "2 д 3 ч", "1 ч 05 мин" или "12 мин"
+func formatMedian(lang string, seconds *float64) string {
+	if seconds == nil {
+		return i18n.Plain(lang, textStatsNoData)
+	}
+
+	minutes := int(*seconds / 60)
+
+	switch {
+	case minutes >= 24*60:
+		return i18n.Plain(lang, textDurationDays, i18n.Args{"days": minutes / (24 * 60), "hours": minutes % (24 * 60) / 60})
+	case minutes >= 60:
+		return i18n.Plain(lang, textDurationHours, i18n.Args{"hours": minutes / 60, "minutes": fmt.Sprintf("%02d", minutes%60)})
+	default:
+		return i18n.Plain(lang, textDurationMinutes, i18n.Args{"minutes": minutes})
+	}
+}
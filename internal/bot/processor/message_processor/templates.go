@@ -0,0 +1,164 @@
+package message_processor
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/bot/processor"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/rbac"
+	rmodels "github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+// Все шаблоны подразделения помещаются в одно сообщение
+const maxUnitTemplates = 100
+
+// processTemplates показывает шаблоны ответов всех подразделений админа
+func (mp *messageProcessor) processTemplates(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	_ string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	adminUnits, err := mp.authorizer.Units(ctx, processor.SenderID(msg), rbac.PermissionViewTemplates)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Units")
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(tr(ctx, textTemplates))
+
+	for _, unit := range adminUnits {
+		responses, errResponses := mp.repo.GetCannedResponses(ctx, unit, 0, maxUnitTemplates)
+		if errResponses != nil {
+			return errors.Wrap(errResponses, "repo.GetCannedResponses")
+		}
+
+		for _, v := range responses {
+			sb.WriteString(tr(ctx, textTemplate, i18n.Args{"id": v.ID, "unit": v.Unit, "title": v.Title, "text": v.Text}))
+		}
+	}
+
+	sb.WriteString(tr(ctx, textTemplatesHelp))
+
+	return sendText(botAPI, msg.Chat.ID, sb.String())
+}
+
+// processTemplateAdd: /template_add <подразделение> | <название> | <текст>
+func (mp *messageProcessor) processTemplateAdd(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	ss, ok := splitArgs(args, 3)
+	if !ok {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textTemplatesHelp))
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), ss[0], rbac.PermissionManageTemplates)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	response := rmodels.CannedResponse{
+		Unit:  ss[0],
+		Title: ss[1],
+		Text:  ss[2],
+	}
+
+	id, err := mp.repo.SaveCannedResponse(ctx, response)
+	if err != nil {
+		return errors.Wrap(err, "repo.SaveCannedResponse")
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textTemplateSaved, i18n.Args{"id": id}))
+}
+
+// processTemplateEdit: /template_edit <id> | <название> | <текст>
+func (mp *messageProcessor) processTemplateEdit(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	ss, ok := splitArgs(args, 3)
+	if !ok {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textTemplatesHelp))
+	}
+
+	response, err := mp.getUnitTemplate(ctx, processor.SenderID(msg), ss[0])
+	if err != nil {
+		return errors.Wrap(err, "getUnitTemplate")
+	}
+
+	if response == nil {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textTemplateNotFound))
+	}
+
+	response.Title = ss[1]
+	response.Text = ss[2]
+
+	if err = mp.repo.UpdateCannedResponse(ctx, *response); err != nil {
+		return errors.Wrap(err, "repo.UpdateCannedResponse")
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textTemplateSaved, i18n.Args{"id": response.ID}))
+}
+
+// processTemplateDelete: /template_delete <id>
+func (mp *messageProcessor) processTemplateDelete(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	response, err := mp.getUnitTemplate(ctx, processor.SenderID(msg), args)
+	if err != nil {
+		return errors.Wrap(err, "getUnitTemplate")
+	}
+
+	if response == nil {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textTemplateNotFound))
+	}
+
+	if err = mp.repo.DeleteCannedResponse(ctx, response.ID); err != nil {
+		return errors.Wrap(err, "repo.DeleteCannedResponse")
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textTemplateDeleted, i18n.Args{"id": response.ID}))
+}
+
+// getUnitTemplate возвращает шаблон по id, если админ может управлять шаблонами его подразделения, иначе nil
+func (mp *messageProcessor) getUnitTemplate(ctx context.Context, chatID int64, rawID string) (*rmodels.CannedResponse, error) {
+	id, err := strconv.ParseUint(rawID, 10, 64)
+	if err != nil {
+		return nil, nil
+	}
+
+	response, err := mp.repo.GetCannedResponse(ctx, id)
+	if err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return nil, nil
+		}
+
+		return nil, errors.Wrap(err, "repo.GetCannedResponse")
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, chatID, response.Unit, rbac.PermissionManageTemplates)
+	if err != nil {
+		return nil, errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return nil, nil
+	}
+
+	return response, nil
+}
@@ -0,0 +1,260 @@
+package message_processor
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/bot/processor"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/rbac"
+	rmodels "github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/pkg/errors"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Префикс попадает в номер тикета, по нему же номер ищется в ответах (tickets.ParseTicketReference)
+var unitPrefixRegexp = regexp.MustCompile(`^[A-Z0-9]{1,10}$`)
+
+// Вместо перевода в /unit_name: пустой аргумент splitArgs не пропускает
+const unitNameDrop = "-"
+
+// processUnits показывает все подразделения, включая скрытые
+func (mp *messageProcessor) processUnits(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	_ string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	units, err := mp.repo.GetUnits(ctx, false)
+	if err != nil {
+		return errors.Wrap(err, "repo.GetUnits")
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(tr(ctx, textUnits))
+
+	for i, v := range units {
+		disabled := ""
+		if !v.Active {
+			disabled = i18n.Plain(i18n.FromContext(ctx), textUnitDisabled)
+		}
+
+		sb.WriteString(tr(ctx, textUnit, i18n.Args{
+			"n":           i + 1,
+			"name":        v.Name,
+			"prefix":      v.Prefix,
+			"disabled":    disabled,
+			"description": v.Description,
+		}))
+
+		if len(v.Names) > 0 {
+			sb.WriteString(tr(ctx, textUnitNames, i18n.Args{"names": unitNames(v.Names)}))
+		}
+	}
+
+	sb.WriteString(tr(ctx, textUnitsHelp))
+
+	return sendText(botAPI, msg.Chat.ID, sb.String())
+}
+
+// processUnitAdd: /unit_add <название> | <префикс> | <описание>.
+// Добавивший владелец сразу становится админом нового подразделения и получает его тикеты
+func (mp *messageProcessor) processUnitAdd(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	ss, ok := splitArgs(args, 3)
+	if !ok || !unitPrefixRegexp.MatchString(ss[1]) || strings.HasPrefix(ss[0], "/") {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitsHelp))
+	}
+
+	unit := rmodels.Unit{
+		Name:        ss[0],
+		Prefix:      ss[1],
+		Description: ss[2],
+	}
+
+	if err := mp.repo.SaveUnit(ctx, unit); err != nil {
+		if errors.Is(err, rmodels.ErrAlreadyExists) {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitExists))
+		}
+
+		return errors.Wrap(err, "repo.SaveUnit")
+	}
+
+	// Владелец - тот, кто создал подразделение, а не чат, в котором прозвучала команда
+	owner := processor.SenderID(msg)
+
+	if err := mp.repo.SaveAdmins(ctx, []int64{owner}, unit.Name); err != nil {
+		return errors.Wrap(err, "repo.SaveAdmins")
+	}
+
+	if err := mp.repo.SetAdminRole(ctx, owner, unit.Name, rmodels.RoleOwner); err != nil {
+		return errors.Wrap(err, "repo.SetAdminRole")
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitSaved, i18n.Args{"unit": unit.Name}))
+}
+
+// processUnitRename: /unit_rename <название> | <новое название>
+func (mp *messageProcessor) processUnitRename(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	ss, ok := splitArgs(args, 2)
+	if !ok || strings.HasPrefix(ss[1], "/") {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitsHelp))
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), ss[0], rbac.PermissionManageUnits)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	if err = mp.repo.RenameUnit(ctx, ss[0], ss[1]); err != nil {
+		switch {
+		case errors.Is(err, rmodels.ErrNotFound):
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitNotFound))
+
+		case errors.Is(err, rmodels.ErrAlreadyExists):
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitExists))
+
+		default:
+			return errors.Wrap(err, "repo.RenameUnit")
+		}
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitRenamed, i18n.Args{"unit": ss[0], "name": ss[1]}))
+}
+
+// processUnitDisable: /unit_disable <название>
+func (mp *messageProcessor) processUnitDisable(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	return mp.setUnitActive(ctx, msg, args, false, botAPI)
+}
+
+// processUnitEnable: /unit_enable <название>
+func (mp *messageProcessor) processUnitEnable(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	return mp.setUnitActive(ctx, msg, args, true, botAPI)
+}
+
+// processUnitName: /unit_name <название> | <язык> | <название для клиентов, "-" - убрать>.
+// Клиенты видят перевод в выборе подразделения и в тикете, ключом остается название
+func (mp *messageProcessor) processUnitName(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	args string,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	ss, ok := splitArgs(args, 3)
+	if !ok || strings.HasPrefix(ss[2], "/") {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitsHelp))
+	}
+
+	unit, lang, name := ss[0], strings.ToLower(ss[1]), ss[2]
+	if !slices.Contains(i18n.Supported(), lang) {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textLanguageUnknown))
+	}
+
+	if name == unitNameDrop {
+		name = ""
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), unit, rbac.PermissionManageUnits)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	if err = mp.repo.SetUnitName(ctx, unit, lang, name); err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitNotFound))
+		}
+
+		return errors.Wrap(err, "repo.SetUnitName")
+	}
+
+	if name == "" {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitNameDrop, i18n.Args{"unit": unit, "language": lang}))
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitName, i18n.Args{
+		"unit":     unit,
+		"language": lang,
+		"name":     name,
+	}))
+}
+
+// unitNames - переводы названия подразделения по языкам: "en: Support, ru: Поддержка"
+func unitNames(names rmodels.UnitNames) string {
+	langs := make([]string, 0, len(names))
+	for k := range names {
+		langs = append(langs, k)
+	}
+
+	sort.Strings(langs)
+
+	for i, v := range langs {
+		langs[i] = v + ": " + names[v]
+	}
+
+	return strings.Join(langs, ", ")
+}
+
+func (mp *messageProcessor) setUnitActive(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	unit string,
+	active bool,
+	botAPI *tgbotapi.BotAPI,
+) error {
+	if unit == "" {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitsHelp))
+	}
+
+	allowed, err := mp.authorizer.Can(ctx, processor.SenderID(msg), unit, rbac.PermissionManageUnits)
+	if err != nil {
+		return errors.Wrap(err, "authorizer.Can")
+	}
+
+	if !allowed {
+		return sendText(botAPI, msg.Chat.ID, tr(ctx, textNotAdmin))
+	}
+
+	if err = mp.repo.SetUnitActive(ctx, unit, active); err != nil {
+		if errors.Is(err, rmodels.ErrNotFound) {
+			return sendText(botAPI, msg.Chat.ID, tr(ctx, textUnitNotFound))
+		}
+
+		return errors.Wrap(err, "repo.SetUnitActive")
+	}
+
+	text := textUnitDisable
+	if active {
+		text = textUnitEnable
+	}
+
+	return sendText(botAPI, msg.Chat.ID, tr(ctx, text, i18n.Args{"unit": unit}))
+}
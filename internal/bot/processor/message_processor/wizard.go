@@ -0,0 +1,322 @@
+package message_processor
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/fsm"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	rmodels "github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/redis"
+	"github.com/goddeuce1/tg_bot_tz/internal/tickets"
+	"github.com/goddeuce1/tg_bot_tz/internal/tickets/models"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// processWizard ведет опрос: шаги и переходы объявлены в fsm,
+// здесь только состояние чата, действия переходов и отправка ответов
+func (mp *messageProcessor) processWizard(ctx context.Context, msg *tgbotapi.Message, botAPI *tgbotapi.BotAPI) error {
+	state, err := mp.stateOperator.GetState(ctx, msg.Chat.ID)
+	if err != nil {
+		return errors.Wrap(err, "stateOperator.GetState")
+	}
+
+	attachment, hasAttachment := attachmentFromMessage(msg)
+
+	input := fsm.Input{
+		Text:          msg.Text,
+		HasAttachment: hasAttachment,
+	}
+
+	if hasAttachment {
+		input.Text = msg.Caption
+	}
+
+	env := mp.wizardEnv(ctx)
+
+	// Состояние истекло, а черновик остался - сначала предлагаем вернуться к нему
+	if state.State == "" && !mp.wizard.IsCommand(input.Text) {
+		offered, errOffer := mp.offerDraft(ctx, msg.Chat.ID, env, botAPI)
+		if errOffer != nil {
+			return errors.Wrap(errOffer, "offerDraft")
+		}
+
+		if offered {
+			return nil
+		}
+	}
+
+	result, err := mp.wizard.Handle(state.State, state.Data, input, env)
+	if err != nil {
+		return errors.Wrap(err, "wizard.Handle")
+	}
+
+	if !result.Handled {
+		return mp.processFreeText(ctx, msg, botAPI)
+	}
+
+	if result.Reply != nil {
+		return sendReply(botAPI, msg.Chat.ID, *result.Reply)
+	}
+
+	data := result.Data
+
+	// Автоответ вместо обычного подтверждения, если подразделение сейчас не работает
+	var offHoursReply string
+
+	switch result.Action {
+	case fsm.ActionClearDraft:
+		if err = mp.clearDraft(ctx, msg.Chat.ID); err != nil {
+			return errors.Wrap(err, "clearDraft")
+		}
+
+	case fsm.ActionAttach:
+		if hasAttachment {
+			handled, errAttachment := mp.processDraftAttachment(ctx, msg, attachment, botAPI)
+			if errAttachment != nil {
+				return errors.Wrap(errAttachment, "processDraftAttachment")
+			}
+
+			if handled {
+				return nil
+			}
+		}
+
+	case fsm.ActionCancel:
+		if err = mp.stateOperator.ClearState(ctx, msg.Chat.ID); err != nil {
+			return errors.Wrap(err, "stateOperator.ClearState")
+		}
+
+		if err = mp.clearDraft(ctx, msg.Chat.ID); err != nil {
+			return errors.Wrap(err, "clearDraft")
+		}
+
+	case fsm.ActionResume:
+		draft, errDraft := mp.stateOperator.GetDraft(ctx, msg.Chat.ID)
+		if errDraft != nil {
+			return errors.Wrap(errDraft, "stateOperator.GetDraft")
+		}
+
+		// Черновик успел истечь, пока клиент думал
+		if draft.State == "" {
+			draft.State = fsm.StateDiscarded
+		}
+
+		if result, err = mp.wizard.Resume(draft.State, draft.Data, env); err != nil {
+			return errors.Wrap(err, "wizard.Resume")
+		}
+
+		data = result.Data
+
+	case fsm.ActionSubmit:
+		if offHoursReply, err = mp.submitTicket(ctx, msg, state.State, &data); err != nil {
+			return errors.Wrap(err, "submitTicket")
+		}
+
+	case fsm.ActionLogin:
+		return mp.processAdmin(ctx, msg, botAPI)
+	}
+
+	// Действие при входе в шаг, на него попадают и переходом, и кнопкой "Назад"
+	if result.Enter == fsm.ActionCountAttachments {
+		attachments, errAttachments := mp.stateOperator.GetDraftAttachments(ctx, msg.Chat.ID)
+		if errAttachments != nil {
+			return errors.Wrap(errAttachments, "stateOperator.GetDraftAttachments")
+		}
+
+		data.Attachments = int64(len(attachments))
+	}
+
+	// Состояние пользователя при опросе, сейвим в кеш с ттл
+	if !result.Keep {
+		if err = mp.stateOperator.SetState(ctx, msg.Chat.ID, redis.ChatData{State: result.To, Data: data}); err != nil {
+			return errors.Wrap(err, "stateOperator.SetState")
+		}
+
+		// Черновик живет дольше состояния, с него клиент продолжит после перерыва
+		if mp.wizard.IsDraft(result.To) {
+			if err = mp.stateOperator.SaveDraft(ctx, msg.Chat.ID, redis.ChatData{State: result.To, Data: data}); err != nil {
+				return errors.Wrap(err, "stateOperator.SaveDraft")
+			}
+		}
+	}
+
+	reply, err := mp.wizard.Prompt(result.To, data, env)
+	if err != nil {
+		return errors.Wrap(err, "wizard.Prompt")
+	}
+
+	if offHoursReply != "" {
+		reply = fsm.Reply{Text: offHoursReply}
+	}
+
+	if reply.Text == "" {
+		return nil
+	}
+
+	return sendReply(botAPI, msg.Chat.ID, reply)
+}
+
+// submitTicket отправляет заявку из черновика data в кафку, оттуда она попадет в постгрес и к админам.
+// Возвращает автоответ, если подразделение сейчас не работает
+func (mp *messageProcessor) submitTicket(
+	ctx context.Context,
+	msg *tgbotapi.Message,
+	state string,
+	data *redis.Data,
+) (string, error) {
+	// Номер выдаем один раз на заявку: если отправка не удалась, клиент остается
+	// на подтверждении, и повторное нажатие "Отправить" уйдет с тем же номером без дубля
+	if data.Reference == "" {
+		reference, err := mp.repo.NextTicketReference(ctx, data.Unit)
+		if err != nil {
+			return "", errors.Wrap(err, "repo.NextTicketReference")
+		}
+
+		data.Reference = reference
+
+		if err = mp.stateOperator.SetState(ctx, msg.Chat.ID, redis.ChatData{State: state, Data: *data}); err != nil {
+			return "", errors.Wrap(err, "stateOperator.SetState")
+		}
+	}
+
+	attachments, err := mp.stateOperator.GetDraftAttachments(ctx, msg.Chat.ID)
+	if err != nil {
+		return "", errors.Wrap(err, "stateOperator.GetDraftAttachments")
+	}
+
+	ticket := models.Ticket{
+		Reference:   data.Reference,
+		ChatID:      msg.Chat.ID,
+		ClientName:  userName(msg.From),
+		Unit:        data.Unit,
+		Name:        data.Name,
+		Description: data.Description,
+		Fields:      data.Fields,
+		Attachments: attachments,
+	}
+
+	// Kafka UI на 8090 порту
+	if err = mp.kafkaProducer.SendMessage(ctx, "tickets", ticket); err != nil {
+		return "", errors.Wrap(err, "kafkaProducer.SendMessage")
+	}
+
+	// Заявка ушла, черновик больше не нужен. Вложения остаются до следующего /new
+	if err = mp.stateOperator.DeleteDraft(ctx, msg.Chat.ID); err != nil {
+		return "", errors.Wrap(err, "stateOperator.DeleteDraft")
+	}
+
+	reply, closed, err := tickets.OffHoursReply(ctx, mp.repo, i18n.FromContext(ctx), data.Unit, data.Reference, time.Now())
+	if err != nil {
+		return "", errors.Wrap(err, "tickets.OffHoursReply")
+	}
+
+	if !closed {
+		return "", nil
+	}
+
+	return reply, nil
+}
+
+// offerDraft предлагает продолжить сохраненный черновик или удалить его.
+// false - черновика нет
+func (mp *messageProcessor) offerDraft(ctx context.Context, chatID int64, env fsm.Env, botAPI *tgbotapi.BotAPI) (bool, error) {
+	draft, err := mp.stateOperator.GetDraft(ctx, chatID)
+	if err != nil {
+		return false, errors.Wrap(err, "stateOperator.GetDraft")
+	}
+
+	if draft.State == "" {
+		return false, nil
+	}
+
+	if err = mp.stateOperator.SetState(ctx, chatID, redis.ChatData{State: fsm.StateResume, Data: draft.Data}); err != nil {
+		return false, errors.Wrap(err, "stateOperator.SetState")
+	}
+
+	reply, err := mp.wizard.Prompt(fsm.StateResume, draft.Data, env)
+	if err != nil {
+		return false, errors.Wrap(err, "wizard.Prompt")
+	}
+
+	reply.Text = tr(ctx, textDraftExpired) + reply.Text
+
+	return true, sendReply(botAPI, chatID, reply)
+}
+
+// clearDraft удаляет черновик заявки вместе с вложениями
+func (mp *messageProcessor) clearDraft(ctx context.Context, chatID int64) error {
+	if err := mp.stateOperator.DeleteDraft(ctx, chatID); err != nil {
+		return errors.Wrap(err, "stateOperator.DeleteDraft")
+	}
+
+	if err := mp.stateOperator.ClearDraftAttachments(ctx, chatID); err != nil {
+		return errors.Wrap(err, "stateOperator.ClearDraftAttachments")
+	}
+
+	return nil
+}
+
+// processFreeText - ввод вне опроса: сообщение по открытому тикету клиента
+func (mp *messageProcessor) processFreeText(ctx context.Context, msg *tgbotapi.Message, botAPI *tgbotapi.BotAPI) error {
+	ticket, err := mp.repo.GetActiveTicket(ctx, msg.Chat.ID)
+	if err == nil {
+		return mp.processClientMessage(ctx, msg, ticket, botAPI)
+	}
+
+	if !errors.Is(err, rmodels.ErrNotFound) {
+		return errors.Wrap(err, "repo.GetActiveTicket")
+	}
+
+	return sendReply(botAPI, msg.Chat.ID, fsm.Reply{Text: tr(ctx, textUnknown)})
+}
+
+// wizardEnv - данные для шагов опроса, читаются только если шагу они нужны
+func (mp *messageProcessor) wizardEnv(ctx context.Context) fsm.Env {
+	return fsm.Env{
+		Lang: i18n.FromContext(ctx),
+		Units: func() ([]rmodels.Unit, error) {
+			units, err := mp.repo.GetUnits(ctx, true)
+			if err != nil {
+				return nil, errors.Wrap(err, "repo.GetUnits")
+			}
+
+			return units, nil
+		},
+		Fields: func(unit string) ([]rmodels.UnitField, error) {
+			fields, err := mp.repo.GetUnitFields(ctx, unit)
+			if err != nil {
+				return nil, errors.Wrap(err, "repo.GetUnitFields")
+			}
+
+			return fields, nil
+		},
+	}
+}
+
+// sendReply отправляет ответ опроса, без кнопок клавиатура убирается
+func sendReply(botAPI *tgbotapi.BotAPI, chatID int64, reply fsm.Reply) error {
+	msgToSend := tgbotapi.NewMessage(chatID, reply.Text)
+	msgToSend.ParseMode = i18n.ParseMode()
+	msgToSend.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+
+	if len(reply.Keyboard) > 0 {
+		rows := make([][]tgbotapi.KeyboardButton, 0, len(reply.Keyboard))
+		for _, v := range reply.Keyboard {
+			row := make([]tgbotapi.KeyboardButton, 0, len(v))
+			for _, button := range v {
+				row = append(row, tgbotapi.NewKeyboardButton(button))
+			}
+
+			rows = append(rows, row)
+		}
+
+		msgToSend.ReplyMarkup = tgbotapi.NewReplyKeyboard(rows...)
+	}
+
+	if _, err := botAPI.Send(msgToSend); err != nil {
+		return errors.Wrap(err, "botAPI.Send")
+	}
+
+	return nil
+}
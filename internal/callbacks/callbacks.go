@@ -0,0 +1,31 @@
+package callbacks
+
+import "strings"
+
+// Telegram ограничивает callback data 64 байтами, поэтому формат компактный:
+// action:arg1:arg2
+const (
+	ActionStatus = "status"
+	ActionReply  = "reply"
+	ActionTake   = "take"
+
+	ActionCanned     = "canned"
+	ActionCannedPage = "cpage"
+	ActionAdminView  = "view"
+
+	ActionMyTickets = "my"
+	ActionMyTicket  = "ticket"
+	ActionReopen    = "reopen"
+
+	separator = ":"
+)
+
+func Build(action string, args ...string) string {
+	return strings.Join(append([]string{action}, args...), separator)
+}
+
+func Parse(data string) (string, []string) {
+	ss := strings.Split(data, separator)
+
+	return ss[0], ss[1:]
+}
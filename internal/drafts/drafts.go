@@ -0,0 +1,171 @@
+package drafts
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/fsm"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository"
+	rmodels "github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/redis"
+	"github.com/goddeuce1/tg_bot_tz/internal/tickets"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+const (
+	pollInterval = time.Minute
+
+	textReminder       = "draft_reminder"
+	textReminderActive = "draft_reminder_active"
+	textHours          = "draft_hours"
+	textMinutes        = "draft_minutes"
+)
+
+type reminder struct {
+	repo   repository.Repository
+	states redis.StateOperator
+	wizard *fsm.Machine
+	botAPI *tgbotapi.BotAPI
+	logger *logrus.Logger
+}
+
+func NewReminder(
+	repo repository.Repository,
+	states redis.StateOperator,
+	botAPI *tgbotapi.BotAPI,
+	logger *logrus.Logger,
+) *reminder {
+	return &reminder{
+		repo:   repo,
+		states: states,
+		wizard: fsm.NewTicketWizard(),
+		botAPI: botAPI,
+		logger: logger,
+	}
+}
+
+// Start напоминает клиентам о черновиках незадолго до их удаления
+func (r *reminder) Start(ctx context.Context, gracefulWg *sync.WaitGroup) {
+	defer func() {
+		r.logger.Info("Shutting down draft reminder")
+
+		gracefulWg.Done()
+	}()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case now := <-ticker.C:
+			chatIDs, err := r.states.PopDueDraftReminders(ctx, now)
+			if err != nil {
+				r.logger.Errorf("Cannot pop draft reminders, Error = %s", err)
+
+				continue
+			}
+
+			for _, v := range chatIDs {
+				if err = r.remind(ctx, v); err != nil {
+					r.logger.Errorf("Cannot remind of draft in chat ID = %d, Error = %s", v, err)
+				}
+			}
+		}
+	}
+}
+
+// remind предлагает продолжить или удалить черновик. Если чат чем-то занят (идет опрос,
+// админ вошел, заявка только что отправлена), только напоминает о сроке, чтобы не сбить шаг
+func (r *reminder) remind(ctx context.Context, chatID int64) error {
+	draft, err := r.states.GetDraft(ctx, chatID)
+	if err != nil {
+		return errors.Wrap(err, "states.GetDraft")
+	}
+
+	if draft.State == "" {
+		return nil
+	}
+
+	state, err := r.states.GetState(ctx, chatID)
+	if err != nil {
+		return errors.Wrap(err, "states.GetState")
+	}
+
+	lang, err := tickets.ChatLang(ctx, r.repo, chatID)
+	if err != nil {
+		return errors.Wrap(err, "tickets.ChatLang")
+	}
+
+	expires := i18n.Args{"expires": formatDuration(lang, draft.ExpiresIn)}
+
+	if r.wizard.IsDraft(state.State) {
+		return r.send(tgbotapi.NewMessage(chatID, i18n.T(lang, textReminderActive, expires)))
+	}
+
+	if state.State != "" {
+		return r.send(tgbotapi.NewMessage(chatID, i18n.T(lang, textReminder, expires)))
+	}
+
+	// Кнопки напоминания разбирает шаг продолжения черновика
+	if err = r.states.SetState(ctx, chatID, redis.ChatData{State: fsm.StateResume, Data: draft.Data}); err != nil {
+		return errors.Wrap(err, "states.SetState")
+	}
+
+	env := fsm.Env{
+		Lang: lang,
+		Units: func() ([]rmodels.Unit, error) {
+			units, errUnits := r.repo.GetUnits(ctx, true)
+			if errUnits != nil {
+				return nil, errors.Wrap(errUnits, "repo.GetUnits")
+			}
+
+			return units, nil
+		},
+	}
+
+	reply, err := r.wizard.Prompt(fsm.StateResume, draft.Data, env)
+	if err != nil {
+		return errors.Wrap(err, "wizard.Prompt")
+	}
+
+	msgToSend := tgbotapi.NewMessage(chatID, i18n.T(lang, textReminder, expires)+reply.Text)
+
+	rows := make([][]tgbotapi.KeyboardButton, 0, len(reply.Keyboard))
+	for _, v := range reply.Keyboard {
+		row := make([]tgbotapi.KeyboardButton, 0, len(v))
+		for _, button := range v {
+			row = append(row, tgbotapi.NewKeyboardButton(button))
+		}
+
+		rows = append(rows, row)
+	}
+
+	msgToSend.ReplyMarkup = tgbotapi.NewReplyKeyboard(rows...)
+
+	return r.send(msgToSend)
+}
+
+func (r *reminder) send(msg tgbotapi.MessageConfig) error {
+	msg.ParseMode = i18n.ParseMode()
+
+	if _, err := r.botAPI.Send(msg); err != nil {
+		return errors.Wrap(err, "botAPI.Send")
+	}
+
+	return nil
+}
+
+// formatDuration - оставшийся срок целыми часами или минутами, с округлением вверх
+func formatDuration(lang string, d time.Duration) string {
+	if d >= time.Hour {
+		return i18n.Plain(lang, textHours, i18n.Args{"n": int((d + time.Hour - 1) / time.Hour)})
+	}
+
+	return i18n.Plain(lang, textMinutes, i18n.Args{"n": max(int((d+time.Minute-1)/time.Minute), 1)})
+}
@@ -0,0 +1,120 @@
+package forum
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	hmodels "github.com/goddeuce1/tg_bot_tz/internal/tickets/models"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+)
+
+// Библиотека telegram-bot-api v5.5.1 не знает о темах форума (Bot API 6.3),
+// поэтому темы создаем и пишем в них запросами к API напрямую
+
+// Ограничение телеграма на длину названия темы
+const maxTopicName = 128
+
+// CreateTopic создает тему в супергруппе с включенными темами и возвращает ее message_thread_id
+func CreateTopic(botAPI *tgbotapi.BotAPI, chatID int64, name string) (int, error) {
+	if runes := []rune(name); len(runes) > maxTopicName {
+		name = string(runes[:maxTopicName])
+	}
+
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", chatID)
+	params.AddNonEmpty("name", name)
+
+	resp, err := botAPI.MakeRequest("createForumTopic", params)
+	if err != nil {
+		return 0, errors.Wrap(err, "botAPI.MakeRequest")
+	}
+
+	var topic struct {
+		MessageThreadID int `json:"message_thread_id"`
+	}
+
+	if err = jsoniter.Unmarshal(resp.Result, &topic); err != nil {
+		return 0, errors.Wrap(err, "jsoniter.Unmarshal")
+	}
+
+	return topic.MessageThreadID, nil
+}
+
+// SendMessage отправляет текст в тему threadID, 0 - в общий чат группы. Текст - в разметке
+// сообщений бота, markup - клавиатура или nil, возвращает id отправленного сообщения
+func SendMessage(botAPI *tgbotapi.BotAPI, chatID int64, threadID int, text string, markup interface{}) (int, error) {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", chatID)
+	params.AddNonZero("message_thread_id", threadID)
+	params.AddNonEmpty("text", text)
+	params.AddNonEmpty("parse_mode", i18n.ParseMode())
+
+	if err := params.AddInterface("reply_markup", markup); err != nil {
+		return 0, errors.Wrap(err, "params.AddInterface")
+	}
+
+	return request(botAPI, "sendMessage", params)
+}
+
+// CopyMessage копирует сообщение (например, вложение клиента) в тему threadID
+func CopyMessage(botAPI *tgbotapi.BotAPI, chatID int64, threadID int, fromChatID int64, messageID int) error {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", chatID)
+	params.AddNonZero("message_thread_id", threadID)
+	params.AddNonZero64("from_chat_id", fromChatID)
+	params.AddNonZero("message_id", messageID)
+
+	if _, err := request(botAPI, "copyMessage", params); err != nil {
+		return errors.Wrap(err, "request")
+	}
+
+	return nil
+}
+
+// SendAttachments отправляет вложения тикета в тему threadID по одному,
+// медиагруппы в темы без поддержки библиотеки не собираем
+func SendAttachments(botAPI *tgbotapi.BotAPI, chatID int64, threadID int, attachments []hmodels.Attachment) error {
+	for _, v := range attachments {
+		method, field := "sendDocument", "document"
+
+		switch v.Type {
+		case hmodels.AttachmentPhoto:
+			method, field = "sendPhoto", "photo"
+
+		case hmodels.AttachmentVoice:
+			method, field = "sendVoice", "voice"
+
+		case hmodels.AttachmentVideo:
+			method, field = "sendVideo", "video"
+		}
+
+		params := tgbotapi.Params{}
+		params.AddNonZero64("chat_id", chatID)
+		params.AddNonZero("message_thread_id", threadID)
+		params.AddNonEmpty(field, v.FileID)
+		params.AddNonEmpty("caption", v.Caption)
+
+		if _, err := request(botAPI, method, params); err != nil {
+			return errors.Wrap(err, "request")
+		}
+	}
+
+	return nil
+}
+
+func request(botAPI *tgbotapi.BotAPI, method string, params tgbotapi.Params) (int, error) {
+	resp, err := botAPI.MakeRequest(method, params)
+	if err != nil {
+		return 0, errors.Wrap(err, "botAPI.MakeRequest")
+	}
+
+	var msg struct {
+		MessageID int `json:"message_id"`
+	}
+
+	if err = jsoniter.Unmarshal(resp.Result, &msg); err != nil {
+		return 0, errors.Wrap(err, "jsoniter.Unmarshal")
+	}
+
+	return msg.MessageID, nil
+}
@@ -0,0 +1,290 @@
+package fsm
+
+import (
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	rmodels "github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/redis"
+	"github.com/goddeuce1/tg_bot_tz/internal/tickets/models"
+	"github.com/pkg/errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	textFieldNumber   = "field_number"
+	textFieldDate     = "field_date"
+	textFieldChoice   = "field_choice"
+	textFieldOptional = "field_optional"
+	textFieldSkip     = "field_skip"
+
+	textFieldLength     = "field_length"
+	textFieldPattern    = "field_pattern"
+	textFieldNotNumber  = "field_not_number"
+	textFieldRange      = "field_range"
+	textFieldNotDate    = "field_not_date"
+	textFieldNotChoice  = "field_not_choice"
+	textFieldBoundsFrom = "field_bounds_from"
+	textFieldBoundsTo   = "field_bounds_to"
+	textFieldBounds     = "field_bounds"
+	textFieldAnswer     = "field_answer"
+)
+
+// Формат дат в ответах на поля
+const fieldDateLayout = "02.01.2006"
+
+// Кнопок вариантов в одном ряду клавиатуры
+const optionsPerRow = 2
+
+// Длина текстового ответа, если у поля не задана своя граница
+const fieldMaxLength = 200
+
+// currentField возвращает поле, которое спрашиваем сейчас, nil - поля кончились
+func currentField(data redis.Data, env Env) (*rmodels.UnitField, error) {
+	fields, err := env.Fields(data.Unit)
+	if err != nil {
+		return nil, errors.Wrap(err, "Fields")
+	}
+
+	if data.Field >= len(fields) {
+		return nil, nil
+	}
+
+	return &fields[data.Field], nil
+}
+
+func skipField(data redis.Data, env Env) (bool, error) {
+	field, err := currentField(data, env)
+	if err != nil {
+		return false, errors.Wrap(err, "currentField")
+	}
+
+	return field == nil, nil
+}
+
+func promptField(data redis.Data, env Env) (Reply, error) {
+	field, err := currentField(data, env)
+	if err != nil {
+		return Reply{}, errors.Wrap(err, "currentField")
+	}
+
+	if field == nil {
+		return Reply{}, nil
+	}
+
+	var reply Reply
+
+	label := i18n.Args{"label": field.Label}
+
+	switch field.Type {
+	case rmodels.FieldNumber:
+		reply.Text = i18n.T(env.Lang, textFieldNumber, label)
+	case rmodels.FieldDate:
+		reply.Text = i18n.T(env.Lang, textFieldDate, label)
+	case rmodels.FieldChoice:
+		reply.Text = i18n.T(env.Lang, textFieldChoice, label)
+
+		for i := 0; i < len(field.Options); i += optionsPerRow {
+			reply.Keyboard = append(reply.Keyboard, field.Options[i:min(i+optionsPerRow, len(field.Options))])
+		}
+	default:
+		reply.Text = i18n.Escape(field.Label)
+	}
+
+	if !field.Required {
+		reply.Text += i18n.T(env.Lang, textFieldOptional)
+		reply.Keyboard = append(reply.Keyboard, []string{i18n.Plain(env.Lang, textFieldSkip)})
+	}
+
+	return reply, nil
+}
+
+func validateField(data redis.Data, input Input, env Env) (string, error) {
+	field, err := currentField(data, env)
+	if err != nil {
+		return "", errors.Wrap(err, "currentField")
+	}
+
+	if field == nil || (!field.Required && i18n.Is(textFieldSkip, input.Text)) {
+		return "", nil
+	}
+
+	if reason := check(env.Lang, strings.TrimSpace(input.Text), NotEmpty(), NotCommand()); reason != "" {
+		return reason, nil
+	}
+
+	_, reason := fieldValue(env.Lang, *field, input.Text)
+
+	return reason, nil
+}
+
+// applyField сохраняет ответ на текущее поле и переходит к следующему
+func applyField(data *redis.Data, input Input, env Env) error {
+	field, err := currentField(*data, env)
+	if err != nil {
+		return errors.Wrap(err, "currentField")
+	}
+
+	data.Field++
+
+	if field == nil {
+		return nil
+	}
+
+	// После "Назад" на поле уже может быть ответ, его заменяем на месте
+	answers := make([]models.FieldAnswer, 0, len(data.Fields)+1)
+	for _, v := range data.Fields {
+		if v.Key != field.Key {
+			answers = append(answers, v)
+		}
+	}
+
+	if field.Required || !i18n.Is(textFieldSkip, input.Text) {
+		value, _ := fieldValue(env.Lang, *field, input.Text)
+
+		answer := models.FieldAnswer{
+			Key:   field.Key,
+			Label: field.Label,
+			Value: value,
+		}
+
+		index := answerIndex(data.Fields, field.Key)
+		if index < 0 || index > len(answers) {
+			index = len(answers)
+		}
+
+		answers = append(answers[:index], append([]models.FieldAnswer{answer}, answers[index:]...)...)
+	}
+
+	data.Fields = answers
+
+	return nil
+}
+
+// currentAnswer - прежний ответ на текущее поле
+func currentAnswer(data redis.Data, env Env) (string, error) {
+	field, err := currentField(data, env)
+	if err != nil {
+		return "", errors.Wrap(err, "currentField")
+	}
+
+	if field == nil {
+		return "", nil
+	}
+
+	if index := answerIndex(data.Fields, field.Key); index >= 0 {
+		return data.Fields[index].Value, nil
+	}
+
+	return "", nil
+}
+
+// revisitField - "Назад" на шаг полей возвращает к предыдущему полю
+func revisitField(data *redis.Data) {
+	if data.Field > 0 {
+		data.Field--
+	}
+}
+
+func answerIndex(answers []models.FieldAnswer, key string) int {
+	for i, v := range answers {
+		if v.Key == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// fieldValue проверяет ответ text на поле и приводит его к виду для хранения.
+// Непустая причина - ответ не принят, ее текст на языке lang видит клиент
+func fieldValue(lang string, field rmodels.UnitField, text string) (string, string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", i18n.T(lang, textRuleEmpty)
+	}
+
+	switch field.Type {
+	case rmodels.FieldNumber:
+		number, err := strconv.ParseFloat(strings.ReplaceAll(text, ",", "."), 64)
+		if err != nil {
+			return "", i18n.T(lang, textFieldNotNumber)
+		}
+
+		if outOfBounds(number, field.Min, field.Max) {
+			return "", i18n.T(lang, textFieldRange, i18n.Args{"bounds": bounds(lang, field.Min, field.Max)})
+		}
+
+		return strconv.FormatFloat(number, 'f', -1, 64), ""
+
+	case rmodels.FieldDate:
+		date, err := time.Parse(fieldDateLayout, text)
+		if err != nil {
+			return "", i18n.T(lang, textFieldNotDate)
+		}
+
+		return date.Format(fieldDateLayout), ""
+
+	case rmodels.FieldChoice:
+		for _, v := range field.Options {
+			if strings.EqualFold(v, text) {
+				return v, ""
+			}
+		}
+
+		return "", i18n.T(lang, textFieldNotChoice)
+
+	default:
+		if outOfBounds(float64(utf8.RuneCountInString(text)), field.Min, field.Max) {
+			return "", i18n.T(lang, textFieldLength, i18n.Args{"bounds": bounds(lang, field.Min, field.Max)})
+		}
+
+		if field.Max == nil {
+			if reason := MaxLength(fieldMaxLength)(lang, text); reason != "" {
+				return "", reason
+			}
+		}
+
+		// Выражение проверяется при добавлении поля, сломанное считаем несовпадением
+		if field.Pattern != "" {
+			if matched, err := regexp.MatchString(field.Pattern, text); err != nil || !matched {
+				return "", i18n.T(lang, textFieldPattern)
+			}
+		}
+
+		return text, ""
+	}
+}
+
+func outOfBounds(value float64, from *float64, to *float64) bool {
+	return (from != nil && value < *from) || (to != nil && value > *to)
+}
+
+// bounds описывает границы словами: "от 1 до 5", "не меньше 1", "не больше 5"
+func bounds(lang string, from *float64, to *float64) string {
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	switch {
+	case from != nil && to != nil:
+		return i18n.Plain(lang, textFieldBounds, i18n.Args{"from": format(*from), "to": format(*to)})
+	case from != nil:
+		return i18n.Plain(lang, textFieldBoundsFrom, i18n.Args{"from": format(*from)})
+	default:
+		return i18n.Plain(lang, textFieldBoundsTo, i18n.Args{"to": format(*to)})
+	}
+}
+
+// formatAnswers - ответы на поля строками "Название: ответ" для подтверждения заявки
+func formatAnswers(lang string, answers []models.FieldAnswer) string {
+	var sb strings.Builder
+
+	for _, v := range answers {
+		sb.WriteString(i18n.T(lang, textFieldAnswer, i18n.Args{"label": v.Label, "value": v.Value}))
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,412 @@
+package fsm
+
+import (
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	rmodels "github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/redis"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Action - побочное действие, которое драйвер выполняет при переходе:
+// все, что требует Telegram, кафки или хранилищ, автомат не делает сам
+type Action string
+
+const (
+	ActionNone Action = ""
+	// ActionClearDraft - начать новый черновик, вложения прошлого удаляются
+	ActionClearDraft Action = "clear_draft"
+	// ActionAttach - добавить вложение к черновику
+	ActionAttach Action = "attach"
+	// ActionCountAttachments - пересчитать вложения черновика для показа
+	ActionCountAttachments Action = "count_attachments"
+	// ActionCancel - удалить черновик и состояние опроса
+	ActionCancel Action = "cancel"
+	// ActionSubmit - отправить заявку
+	ActionSubmit Action = "submit"
+	// ActionLogin - проверить код приглашения, состояние и ответ задает вход
+	ActionLogin Action = "login"
+	// ActionResume - продолжить опрос с сохраненного черновика, шаг и данные берутся из него
+	ActionResume Action = "resume"
+)
+
+// Input - ввод пользователя, у вложения Text - подпись
+type Input struct {
+	Text          string
+	HasAttachment bool
+}
+
+// Env - внешние данные, нужные шагам. Загружаются лениво, только если шагу они нужны
+type Env struct {
+	// Units возвращает подразделения, принимающие заявки
+	Units func() ([]rmodels.Unit, error)
+	// Fields возвращает дополнительные поля опроса подразделения
+	Fields func(unit string) ([]rmodels.UnitField, error)
+	// Lang - язык чата, на нем шаги пишут вопросы и кнопки
+	Lang string
+}
+
+// Reply - ответ бота: текст и ряды кнопок клавиатуры, без кнопок клавиатура убирается.
+// Пустой текст - ничего не отправлять
+type Reply struct {
+	Text     string
+	Keyboard [][]string
+}
+
+// Transition - переход в шаг To
+type Transition struct {
+	To     string
+	Action Action
+	// Reset - начать опрос заново с пустыми данными
+	Reset bool
+	// Keep - переход не сохраняется, следующий ввод снова обработает текущий шаг
+	Keep bool
+	// Return - правка ответа: после ответа на шаге To вернуться в текущий шаг.
+	// Переходы правки не попадают в историю кнопки "Назад"
+	Return bool
+}
+
+// Step - шаг опроса: что бот пишет при входе в шаг и как принимает ввод на нем
+type Step struct {
+	Prompt func(data redis.Data, env Env) (Reply, error)
+	// Validate проверяет ввод перед переходом Next. Непустой результат - ввод не принят,
+	// пользователь видит этот текст и вопрос шага еще раз, шаг не меняется
+	Validate func(data redis.Data, input Input, env Env) (string, error)
+	// Apply сохраняет принятый ввод в данные опроса
+	Apply func(data *redis.Data, input Input, env Env) error
+	// Skip - шаг сейчас не нужен, вместо него переходим в SkipTo
+	Skip   func(data redis.Data, env Env) (bool, error)
+	SkipTo string
+	// On - переходы по кнопкам, ключ - текст кнопки в каталоге i18n.
+	// Ввод кнопки не проверяется и не сохраняется
+	On map[string]Transition
+	// Next - переход по остальному вводу, nil - шаг такой ввод не обрабатывает
+	Next *Transition
+	// NoAttachments - вложения на шаге не принимаются
+	NoAttachments bool
+	// Current - прежний ответ на шаге. Показывается в вопросе, кнопка "Оставить как есть" повторяет его
+	Current func(data redis.Data, env Env) (string, error)
+	// Back - на шаге есть кнопка "Назад" к предыдущему шагу
+	Back bool
+	// Revisit вызывается при возврате на шаг кнопкой "Назад"
+	Revisit func(data *redis.Data)
+	// Enter - действие драйвера при каждом входе в шаг
+	Enter Action
+	// Draft - шаг заполняет заявку, состояние на нем драйвер сохраняет и как черновик
+	Draft bool
+}
+
+// Result - итог обработки ввода
+type Result struct {
+	// Handled - ввод обработан опросом, иначе драйвер разбирает его сам
+	Handled bool
+	Transition
+	Data redis.Data
+	// Enter - действие входа в шаг To, драйвер выполняет его после действия перехода
+	Enter Action
+	// Reply - ответ на отклоненный ввод, при переходе ответ дает Prompt шага To
+	Reply *Reply
+}
+
+// Сколько пройденных шагов помнит кнопка "Назад"
+const historyLimit = 20
+
+// Сколько символов прежнего ответа показывать в вопросе
+const previewLength = 200
+
+const (
+	textBack    = "wizard_back"
+	textKeep    = "wizard_keep"
+	textCurrent = "wizard_current"
+)
+
+type Machine struct {
+	steps    map[string]Step
+	commands map[string]Transition
+}
+
+// New собирает автомат из шагов и команд. Команды работают на любом шаге и вне опроса
+func New(steps map[string]Step, commands map[string]Transition) (*Machine, error) {
+	for k, v := range commands {
+		if _, exists := steps[v.To]; !exists {
+			return nil, errors.Errorf("command %s: unknown step %q", k, v.To)
+		}
+	}
+
+	for k, v := range steps {
+		transitions := make([]Transition, 0, len(v.On)+1)
+		for _, t := range v.On {
+			transitions = append(transitions, t)
+		}
+
+		if v.Next != nil {
+			transitions = append(transitions, *v.Next)
+		}
+
+		if v.Skip != nil {
+			transitions = append(transitions, Transition{To: v.SkipTo})
+		}
+
+		for _, t := range transitions {
+			if _, exists := steps[t.To]; !exists {
+				return nil, errors.Errorf("step %s: unknown step %q", k, t.To)
+			}
+		}
+	}
+
+	return &Machine{
+		steps:    steps,
+		commands: commands,
+	}, nil
+}
+
+// MustNew - New для автоматов, объявленных в коде: ошибка объявления - ошибка программы
+func MustNew(steps map[string]Step, commands map[string]Transition) *Machine {
+	m, err := New(steps, commands)
+	if err != nil {
+		panic(err)
+	}
+
+	return m
+}
+
+// IsCommand проверяет, что text - команда опроса
+func (m *Machine) IsCommand(text string) bool {
+	_, exists := m.commands[text]
+
+	return exists
+}
+
+// IsDraft проверяет, что на шаге state заполняется черновик заявки
+func (m *Machine) IsDraft(state string) bool {
+	return m.steps[state].Draft
+}
+
+// Resume - переход на шаг state без ввода, с данными data: так опрос продолжается с черновика
+func (m *Machine) Resume(state string, data redis.Data, env Env) (Result, error) {
+	if _, exists := m.steps[state]; !exists {
+		return Result{}, errors.Errorf("unknown step %q", state)
+	}
+
+	to, err := m.skip(state, data, env)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "skip")
+	}
+
+	return Result{
+		Handled:    true,
+		Transition: Transition{To: to},
+		Data:       data,
+		Enter:      m.steps[to].Enter,
+	}, nil
+}
+
+// Handle обрабатывает ввод на шаге state с данными опроса data
+func (m *Machine) Handle(state string, data redis.Data, input Input, env Env) (Result, error) {
+	transition, ok := m.commands[input.Text]
+	if !ok {
+		step, exists := m.steps[state]
+		if !exists {
+			return Result{}, nil
+		}
+
+		if i18n.Is(textBack, input.Text) && step.Back && (len(data.History) > 0 || data.Return != "") {
+			return m.back(data), nil
+		}
+
+		if input.HasAttachment && step.NoAttachments {
+			return Result{Handled: true, Reply: &Reply{Text: i18n.T(env.Lang, textAttachmentNotHere)}}, nil
+		}
+
+		if transition, ok = on(step, input.Text); ok {
+			if transition.Return {
+				data.Return = state
+			}
+		} else {
+			if step.Next == nil {
+				return Result{}, nil
+			}
+
+			// "Оставить как есть" - тот же ответ, что и в прошлый раз, он проходит обычную проверку
+			if i18n.Is(textKeep, input.Text) && step.Current != nil {
+				current, err := step.Current(data, env)
+				if err != nil {
+					return Result{}, errors.Wrap(err, "Current")
+				}
+
+				if current != "" {
+					input = Input{Text: current}
+				}
+			}
+
+			if step.Validate != nil {
+				reason, err := step.Validate(data, input, env)
+				if err != nil {
+					return Result{}, errors.Wrap(err, "Validate")
+				}
+
+				if reason != "" {
+					reply, errPrompt := m.Prompt(state, data, env)
+					if errPrompt != nil {
+						return Result{}, errors.Wrap(errPrompt, "Prompt")
+					}
+
+					reply.Text = strings.TrimSpace(reason + "\n\n" + reply.Text)
+
+					return Result{Handled: true, Reply: &reply}, nil
+				}
+			}
+
+			transition = *step.Next
+
+			if step.Apply != nil {
+				if err := step.Apply(&data, input, env); err != nil {
+					return Result{}, errors.Wrap(err, "Apply")
+				}
+			}
+
+			if data.Return != "" {
+				transition.To = data.Return
+				transition.Return = true
+				data.Return = ""
+			}
+		}
+	}
+
+	switch {
+	case transition.Reset:
+		data = redis.Data{}
+	// Правка ответа - отступление от порядка опроса, в историю для "Назад" ее не пишем
+	case !transition.Keep && !transition.Return && state != "":
+		data.History = append(data.History, state)
+		if len(data.History) > historyLimit {
+			data.History = data.History[len(data.History)-historyLimit:]
+		}
+	}
+
+	to, err := m.skip(transition.To, data, env)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "skip")
+	}
+
+	transition.To = to
+
+	return Result{
+		Handled:    true,
+		Transition: transition,
+		Data:       data,
+		Enter:      m.steps[to].Enter,
+	}, nil
+}
+
+// back возвращает на предыдущий шаг, прежние ответы остаются в данных опроса.
+// При правке ответа "Назад" отменяет правку и возвращает туда, откуда она начата
+func (m *Machine) back(data redis.Data) Result {
+	if data.Return != "" {
+		to := data.Return
+		data.Return = ""
+
+		return Result{
+			Handled:    true,
+			Transition: Transition{To: to},
+			Data:       data,
+			Enter:      m.steps[to].Enter,
+		}
+	}
+
+	last := len(data.History) - 1
+	to := data.History[last]
+
+	data.History = data.History[:last]
+
+	step := m.steps[to]
+	if step.Revisit != nil {
+		step.Revisit(&data)
+	}
+
+	return Result{
+		Handled:    true,
+		Transition: Transition{To: to},
+		Data:       data,
+		Enter:      step.Enter,
+	}
+}
+
+// skip пропускает ненужные сейчас шаги, начиная с state
+func (m *Machine) skip(state string, data redis.Data, env Env) (string, error) {
+	for i := 0; i <= len(m.steps); i++ {
+		step := m.steps[state]
+		if step.Skip == nil {
+			return state, nil
+		}
+
+		skip, err := step.Skip(data, env)
+		if err != nil {
+			return "", errors.Wrap(err, "Skip")
+		}
+
+		if !skip {
+			return state, nil
+		}
+
+		state = step.SkipTo
+	}
+
+	return "", errors.Errorf("step %s: skip loop", state)
+}
+
+// on ищет переход по кнопке с текстом text на любом языке
+func on(step Step, text string) (Transition, bool) {
+	for k, v := range step.On {
+		if i18n.Is(k, text) {
+			return v, true
+		}
+	}
+
+	return Transition{}, false
+}
+
+// preview - начало прежнего ответа для показа в вопросе
+func preview(text string) string {
+	runes := []rune(text)
+	if len(runes) <= previewLength {
+		return text
+	}
+
+	return string(runes[:previewLength]) + "…"
+}
+
+// Prompt возвращает сообщение при входе в шаг state
+func (m *Machine) Prompt(state string, data redis.Data, env Env) (Reply, error) {
+	step, exists := m.steps[state]
+	if !exists || step.Prompt == nil {
+		return Reply{}, nil
+	}
+
+	reply, err := step.Prompt(data, env)
+	if err != nil {
+		return Reply{}, errors.Wrap(err, "Prompt")
+	}
+
+	if reply.Text == "" {
+		return reply, nil
+	}
+
+	if step.Current != nil {
+		current, errCurrent := step.Current(data, env)
+		if errCurrent != nil {
+			return Reply{}, errors.Wrap(errCurrent, "Current")
+		}
+
+		if current != "" {
+			reply.Text += i18n.T(env.Lang, textCurrent, i18n.Args{"answer": preview(current)})
+			reply.Keyboard = append(reply.Keyboard, []string{i18n.Plain(env.Lang, textKeep)})
+		}
+	}
+
+	if step.Back && (len(data.History) > 0 || data.Return != "") {
+		reply.Keyboard = append(reply.Keyboard, []string{i18n.Plain(env.Lang, textBack)})
+	}
+
+	return reply, nil
+}
@@ -0,0 +1,544 @@
+package fsm
+
+import (
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	rmodels "github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/redis"
+	"github.com/goddeuce1/tg_bot_tz/internal/tickets/models"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testUnit       = "Бухгалтерия"
+	testOther      = "IT"
+	testTranslated = "Billing"
+	// testTitle - название testTranslated на языке по умолчанию
+	testTitle = "Счета и оплата"
+)
+
+// testEnv - Env с постоянным списком подразделений, у любого подразделения поля fields
+func testEnv(fields ...rmodels.UnitField) Env {
+	return Env{
+		Lang: i18n.Default,
+		Units: func() ([]rmodels.Unit, error) {
+			return []rmodels.Unit{
+				{Name: testUnit},
+				{Name: testOther},
+				{Name: testTranslated, Names: rmodels.UnitNames{i18n.Default: testTitle}},
+			}, nil
+		},
+		Fields: func(_ string) ([]rmodels.UnitField, error) {
+			return fields, nil
+		},
+	}
+}
+
+func tr(key string, args ...i18n.Args) string {
+	return i18n.T(i18n.Default, key, args...)
+}
+
+func button(key string) string {
+	return i18n.Plain(i18n.Default, key)
+}
+
+func TestHandle(t *testing.T) {
+	optional := rmodels.UnitField{Key: "contract", Label: "Номер договора", Type: rmodels.FieldText}
+	number := rmodels.UnitField{Key: "floor", Label: "Этаж", Type: rmodels.FieldNumber, Required: true}
+
+	filled := redis.Data{
+		Unit:        testUnit,
+		Name:        "Не работает принтер",
+		Description: "Принтер на втором этаже не печатает",
+		History:     []string{StateUnit, StateName, StateDescription},
+	}
+
+	tests := []struct {
+		name   string
+		state  string
+		data   redis.Data
+		input  Input
+		fields []rmodels.UnitField
+
+		handled bool
+		want    Transition
+		// reply - начало ответа на отклоненный ввод, пусто - ввод принят
+		reply string
+		// check проверяет данные опроса после перехода
+		check func(t *testing.T, data redis.Data)
+	}{
+		{
+			name:    "new starts over with empty data",
+			state:   StateName,
+			data:    filled,
+			input:   Input{Text: CommandNew},
+			handled: true,
+			want:    Transition{To: StateUnit, Reset: true, Action: ActionClearDraft},
+			check: func(t *testing.T, data redis.Data) {
+				if !reflect.DeepEqual(data, redis.Data{}) {
+					t.Errorf("data = %+v, want empty", data)
+				}
+			},
+		},
+		{
+			name:    "cancel works on any step",
+			state:   StateDescription,
+			data:    filled,
+			input:   Input{Text: CommandCancel},
+			handled: true,
+			want:    Transition{To: StateDiscarded, Action: ActionCancel, Keep: true},
+		},
+		{
+			name:    "cancel works outside the wizard",
+			input:   Input{Text: CommandCancel},
+			handled: true,
+			want:    Transition{To: StateDiscarded, Action: ActionCancel, Keep: true},
+		},
+		{
+			name:    "admin works outside the wizard",
+			input:   Input{Text: CommandAdmin},
+			handled: true,
+			want:    Transition{To: StateAdminKey, Reset: true},
+		},
+		{
+			name:  "text outside the wizard is not handled",
+			input: Input{Text: "Здравствуйте"},
+		},
+		{
+			name:    "valid unit",
+			state:   StateUnit,
+			input:   Input{Text: testUnit},
+			handled: true,
+			want:    Transition{To: StateName},
+			check: func(t *testing.T, data redis.Data) {
+				if data.Unit != testUnit {
+					t.Errorf("Unit = %q, want %q", data.Unit, testUnit)
+				}
+
+				if !reflect.DeepEqual(data.History, []string{StateUnit}) {
+					t.Errorf("History = %v, want [%s]", data.History, StateUnit)
+				}
+			},
+		},
+		{
+			name:    "unit chosen by its translated name keeps the key",
+			state:   StateUnit,
+			input:   Input{Text: testTitle},
+			handled: true,
+			want:    Transition{To: StateName},
+			check: func(t *testing.T, data redis.Data) {
+				if data.Unit != testTranslated {
+					t.Errorf("Unit = %q, want %q", data.Unit, testTranslated)
+				}
+			},
+		},
+		{
+			name:    "unknown unit",
+			state:   StateUnit,
+			input:   Input{Text: "Склад"},
+			handled: true,
+			reply:   tr(textUnknown),
+		},
+		{
+			name:    "attachment on a step without attachments",
+			state:   StateName,
+			input:   Input{Text: "Скриншот ошибки", HasAttachment: true},
+			handled: true,
+			reply:   tr(textAttachmentNotHere),
+		},
+		{
+			name:    "attachment with description",
+			state:   StateDescription,
+			data:    redis.Data{Unit: testUnit, Name: "Не работает принтер"},
+			input:   Input{HasAttachment: true},
+			handled: true,
+			want:    Transition{To: StateDone, Action: ActionAttach},
+		},
+		{
+			name:    "name without fields skips the fields step",
+			state:   StateName,
+			data:    redis.Data{Unit: testUnit, History: []string{StateUnit}},
+			input:   Input{Text: "  Не работает принтер  "},
+			handled: true,
+			want:    Transition{To: StateDescription},
+			check: func(t *testing.T, data redis.Data) {
+				if data.Name != "Не работает принтер" {
+					t.Errorf("Name = %q, want trimmed answer", data.Name)
+				}
+			},
+		},
+		{
+			name:    "name with fields goes to the first field",
+			state:   StateName,
+			data:    redis.Data{Unit: testUnit},
+			input:   Input{Text: "Не работает принтер"},
+			fields:  []rmodels.UnitField{number},
+			handled: true,
+			want:    Transition{To: StateField},
+		},
+		{
+			name:    "back returns to the previous step",
+			state:   StateName,
+			data:    redis.Data{Unit: testUnit, History: []string{StateUnit}},
+			input:   Input{Text: button(textBack)},
+			handled: true,
+			want:    Transition{To: StateUnit},
+			check: func(t *testing.T, data redis.Data) {
+				if len(data.History) != 0 || data.Unit != testUnit {
+					t.Errorf("data = %+v, want empty history and unit kept", data)
+				}
+			},
+		},
+		{
+			name:    "back on fields returns to the previous field",
+			state:   StateField,
+			data:    redis.Data{Unit: testUnit, Field: 1, History: []string{StateName, StateField}},
+			input:   Input{Text: button(textBack)},
+			fields:  []rmodels.UnitField{number, optional},
+			handled: true,
+			want:    Transition{To: StateField},
+			check: func(t *testing.T, data redis.Data) {
+				if data.Field != 0 {
+					t.Errorf("Field = %d, want 0", data.Field)
+				}
+			},
+		},
+		{
+			name:    "edit from the summary",
+			state:   StateDone,
+			data:    filled,
+			input:   Input{Text: button(textEditName)},
+			handled: true,
+			want:    Transition{To: StateName, Return: true},
+			check: func(t *testing.T, data redis.Data) {
+				if data.Return != StateDone {
+					t.Errorf("Return = %q, want %q", data.Return, StateDone)
+				}
+
+				if len(data.History) != len(filled.History) {
+					t.Errorf("History = %v, edit must not be recorded", data.History)
+				}
+			},
+		},
+		{
+			name:    "answer after edit returns to the summary",
+			state:   StateName,
+			data:    redis.Data{Unit: testUnit, Name: "Старый заголовок", Return: StateDone},
+			input:   Input{Text: "Новый заголовок"},
+			handled: true,
+			want:    Transition{To: StateDone, Return: true},
+			check: func(t *testing.T, data redis.Data) {
+				if data.Name != "Новый заголовок" || data.Return != "" || len(data.History) != 0 {
+					t.Errorf("data = %+v, want new name, no return and no history", data)
+				}
+			},
+		},
+		{
+			name:    "back during edit cancels the edit",
+			state:   StateName,
+			data:    redis.Data{Unit: testUnit, Name: "Старый заголовок", Return: StateDone, History: []string{StateUnit}},
+			input:   Input{Text: button(textBack)},
+			handled: true,
+			want:    Transition{To: StateDone},
+			check: func(t *testing.T, data redis.Data) {
+				if data.Return != "" || data.Name != "Старый заголовок" {
+					t.Errorf("data = %+v, want old name and no return", data)
+				}
+			},
+		},
+		{
+			name:    "unit change during edit continues through new fields",
+			state:   StateUnit,
+			data:    redis.Data{Unit: testUnit, Fields: []models.FieldAnswer{{Key: "floor", Value: "2"}}, Field: 1, Return: StateDone},
+			input:   Input{Text: testOther},
+			fields:  []rmodels.UnitField{number},
+			handled: true,
+			want:    Transition{To: StateName},
+			check: func(t *testing.T, data redis.Data) {
+				if data.Fields != nil || data.Field != 0 || data.Return != "" {
+					t.Errorf("data = %+v, want answers reset", data)
+				}
+			},
+		},
+		{
+			name:    "keep as is repeats the previous answer",
+			state:   StateName,
+			data:    redis.Data{Unit: testUnit, Name: "Старый заголовок", Return: StateDone},
+			input:   Input{Text: button(textKeep)},
+			handled: true,
+			want:    Transition{To: StateDone, Return: true},
+			check: func(t *testing.T, data redis.Data) {
+				if data.Name != "Старый заголовок" {
+					t.Errorf("Name = %q, want previous answer", data.Name)
+				}
+			},
+		},
+		{
+			name:    "keep as is on a field",
+			state:   StateField,
+			data:    redis.Data{Unit: testUnit, Fields: []models.FieldAnswer{{Key: "floor", Label: "Этаж", Value: "2"}}},
+			input:   Input{Text: button(textKeep)},
+			fields:  []rmodels.UnitField{number},
+			handled: true,
+			want:    Transition{To: StateDescription},
+			check: func(t *testing.T, data redis.Data) {
+				want := []models.FieldAnswer{{Key: "floor", Label: "Этаж", Value: "2"}}
+				if !reflect.DeepEqual(data.Fields, want) {
+					t.Errorf("Fields = %+v, want %+v", data.Fields, want)
+				}
+			},
+		},
+		{
+			name:    "number field answer",
+			state:   StateField,
+			data:    redis.Data{Unit: testUnit},
+			input:   Input{Text: "2"},
+			fields:  []rmodels.UnitField{number, optional},
+			handled: true,
+			want:    Transition{To: StateField},
+			check: func(t *testing.T, data redis.Data) {
+				want := []models.FieldAnswer{{Key: "floor", Label: "Этаж", Value: "2"}}
+				if !reflect.DeepEqual(data.Fields, want) || data.Field != 1 {
+					t.Errorf("data = %+v, want answer %+v and next field", data, want)
+				}
+			},
+		},
+		{
+			name:    "optional field is skipped",
+			state:   StateField,
+			data:    redis.Data{Unit: testUnit},
+			input:   Input{Text: button(textFieldSkip)},
+			fields:  []rmodels.UnitField{optional},
+			handled: true,
+			want:    Transition{To: StateDescription},
+			check: func(t *testing.T, data redis.Data) {
+				if len(data.Fields) != 0 || data.Field != 1 {
+					t.Errorf("data = %+v, want no answers and next field", data)
+				}
+			},
+		},
+		{
+			name:    "number field rejects text",
+			state:   StateField,
+			data:    redis.Data{Unit: testUnit},
+			input:   Input{Text: "второй"},
+			fields:  []rmodels.UnitField{number},
+			handled: true,
+			reply:   tr(textFieldNotNumber),
+		},
+		{
+			name:    "name runs the validator chain",
+			state:   StateName,
+			data:    redis.Data{Unit: testUnit},
+			input:   Input{Text: "ок"},
+			handled: true,
+			reply:   tr(textRuleTooShort, i18n.Args{"n": nameMinLength}),
+		},
+		{
+			// Отправленная заявка уводит из шага подтверждения, иначе правка
+			// ушла бы с прежним номером и потерялась
+			name:    "submit leaves the summary",
+			state:   StateDone,
+			data:    filled,
+			input:   Input{Text: button(textSubmitYes)},
+			handled: true,
+			want:    Transition{To: StateSubmitted, Action: ActionSubmit},
+		},
+		{
+			name:  "edit after submit is not handled",
+			state: StateSubmitted,
+			data:  redis.Data{Unit: testUnit, Reference: "BUH-1"},
+			input: Input{Text: button(textEditName)},
+		},
+		{
+			name:  "do not submit after submit is not handled",
+			state: StateSubmitted,
+			data:  redis.Data{Unit: testUnit, Reference: "BUH-1"},
+			input: Input{Text: button(textSubmitNo)},
+		},
+		{
+			name:    "do not submit",
+			state:   StateDone,
+			data:    filled,
+			input:   Input{Text: button(textSubmitNo)},
+			handled: true,
+			want:    Transition{To: StateCancelled, Action: ActionCancel, Keep: true},
+		},
+		{
+			name:    "text on the summary is not handled",
+			state:   StateDone,
+			data:    filled,
+			input:   Input{Text: "Добавлю, что принтер новый"},
+			handled: false,
+		},
+		{
+			name:    "invite code is checked by the driver",
+			state:   StateAdminKey,
+			input:   Input{Text: "code"},
+			handled: true,
+			want:    Transition{To: StateAdminKey, Action: ActionLogin, Keep: true},
+		},
+	}
+
+	m := NewTicketWizard()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := m.Handle(tt.state, tt.data, tt.input, testEnv(tt.fields...))
+			if err != nil {
+				t.Fatalf("Handle() error = %v", err)
+			}
+
+			if result.Handled != tt.handled {
+				t.Fatalf("Handled = %v, want %v", result.Handled, tt.handled)
+			}
+
+			if tt.reply != "" {
+				if result.Reply == nil || !strings.HasPrefix(result.Reply.Text, tt.reply) {
+					t.Fatalf("Reply = %+v, want text starting with %q", result.Reply, tt.reply)
+				}
+
+				return
+			}
+
+			if result.Reply != nil {
+				t.Fatalf("Reply = %q, want transition", result.Reply.Text)
+			}
+
+			if result.Transition != tt.want {
+				t.Errorf("Transition = %+v, want %+v", result.Transition, tt.want)
+			}
+
+			if tt.check != nil {
+				tt.check(t, result.Data)
+			}
+		})
+	}
+}
+
+func TestResume(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   string
+		fields  []rmodels.UnitField
+		want    string
+		enter   Action
+		wantErr bool
+	}{
+		{name: "same step", state: StateName, want: StateName},
+		{name: "fields are over", state: StateField, want: StateDescription},
+		{name: "summary counts attachments", state: StateDone, want: StateDone, enter: ActionCountAttachments},
+		{name: "unknown step", state: "unknown", wantErr: true},
+	}
+
+	m := NewTicketWizard()
+	data := redis.Data{Unit: testUnit, Name: "Не работает принтер"}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := m.Resume(tt.state, data, testEnv(tt.fields...))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resume() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if !result.Handled || result.To != tt.want || result.Enter != tt.enter {
+				t.Errorf("Resume() = %+v, want step %s with enter %q", result, tt.want, tt.enter)
+			}
+
+			if !reflect.DeepEqual(result.Data, data) {
+				t.Errorf("Data = %+v, want draft data %+v", result.Data, data)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	steps := func(step Step) map[string]Step {
+		return map[string]Step{StateMenu: {}, StateName: step}
+	}
+
+	tests := []struct {
+		name     string
+		steps    map[string]Step
+		commands map[string]Transition
+		wantErr  bool
+	}{
+		{
+			name:     "valid",
+			steps:    steps(Step{Next: &Transition{To: StateMenu}, On: map[string]Transition{textBack: {To: StateName}}}),
+			commands: map[string]Transition{CommandStart: {To: StateMenu}},
+		},
+		{
+			name:     "command to unknown step",
+			steps:    steps(Step{}),
+			commands: map[string]Transition{CommandStart: {To: StateUnit}},
+			wantErr:  true,
+		},
+		{
+			name:    "button to unknown step",
+			steps:   steps(Step{On: map[string]Transition{textBack: {To: StateUnit}}}),
+			wantErr: true,
+		},
+		{
+			name:    "next to unknown step",
+			steps:   steps(Step{Next: &Transition{To: StateUnit}}),
+			wantErr: true,
+		},
+		{
+			name:    "skip to unknown step",
+			steps:   steps(Step{Skip: func(redis.Data, Env) (bool, error) { return true, nil }, SkipTo: StateUnit}),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.steps, tt.commands); (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	rules := Validate(NotEmpty(), NotCommand(), HasText(), SingleLine(), MinLength(3), MaxLength(10))
+
+	tests := []struct {
+		name  string
+		input Input
+		want  string
+	}{
+		{name: "valid", input: Input{Text: "Принтер"}},
+		{name: "spaces are trimmed", input: Input{Text: "  абв  "}},
+		{name: "empty", input: Input{Text: "   "}, want: tr(textRuleEmpty)},
+		{name: "command", input: Input{Text: "/help"}, want: tr(textRuleCommand)},
+		{name: "command with bot name", input: Input{Text: "/start@bot"}, want: tr(textRuleCommand)},
+		{name: "slash inside text", input: Input{Text: "1/2 этажа"}},
+		{name: "only emoji", input: Input{Text: "👍👍👍"}, want: tr(textRuleNoText)},
+		{name: "multiline", input: Input{Text: "абв\nгде"}, want: tr(textRuleMultiline)},
+		{name: "too short", input: Input{Text: "аб"}, want: tr(textRuleTooShort, i18n.Args{"n": 3})},
+		// Эмодзи в UTF-16 занимают по два символа
+		{name: "too long in utf-16", input: Input{Text: "абвгдежзи👍"}, want: tr(textRuleTooLong, i18n.Args{"n": 10, "length": 11})},
+		{name: "first broken rule wins", input: Input{Text: "/a"}, want: tr(textRuleCommand)},
+		{name: "attachment without caption", input: Input{HasAttachment: true}},
+		{name: "attachment caption is checked", input: Input{Text: "аб", HasAttachment: true}, want: tr(textRuleTooShort, i18n.Args{"n": 3})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rules(redis.Data{}, tt.input, testEnv())
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("Validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
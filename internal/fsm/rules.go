@@ -0,0 +1,112 @@
+package fsm
+
+import (
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/redis"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	textRuleEmpty     = "rule_empty"
+	textRuleTooShort  = "rule_too_short"
+	textRuleTooLong   = "rule_too_long"
+	textRuleCommand   = "rule_command"
+	textRuleNoText    = "rule_no_text"
+	textRuleMultiline = "rule_multiline"
+)
+
+// Rule проверяет текст ввода, непустой результат - ввод не принят, этот текст на языке lang видит пользователь
+type Rule func(lang string, text string) string
+
+// Validate - проверка шага по правилам, первое нарушенное правило дает ответ.
+// Текст проверяется без пробелов по краям. Вложение без подписи правила пропускают,
+// его принимает действие шага
+func Validate(rules ...Rule) func(redis.Data, Input, Env) (string, error) {
+	return func(_ redis.Data, input Input, env Env) (string, error) {
+		if input.HasAttachment && strings.TrimSpace(input.Text) == "" {
+			return "", nil
+		}
+
+		return check(env.Lang, strings.TrimSpace(input.Text), rules...), nil
+	}
+}
+
+// check применяет правила к text по порядку
+func check(lang string, text string, rules ...Rule) string {
+	for _, rule := range rules {
+		if reason := rule(lang, text); reason != "" {
+			return reason
+		}
+	}
+
+	return ""
+}
+
+func NotEmpty() Rule {
+	return func(lang string, text string) string {
+		if text == "" {
+			return i18n.T(lang, textRuleEmpty)
+		}
+
+		return ""
+	}
+}
+
+func MinLength(n int) Rule {
+	return func(lang string, text string) string {
+		if utf8.RuneCountInString(text) < n {
+			return i18n.T(lang, textRuleTooShort, i18n.Args{"n": n})
+		}
+
+		return ""
+	}
+}
+
+// MaxLength считает длину как телеграм, в UTF-16: эмодзи занимают по два символа,
+// так ответ гарантированно влезет в сообщения, где он повторяется
+func MaxLength(n int) Rule {
+	return func(lang string, text string) string {
+		if length := len(utf16.Encode([]rune(text))); length > n {
+			return i18n.T(lang, textRuleTooLong, i18n.Args{"n": n, "length": length})
+		}
+
+		return ""
+	}
+}
+
+// NotCommand отклоняет команду, набранную вместо ответа: "/help", "/start@bot"
+func NotCommand() Rule {
+	return NotMatch(regexp.MustCompile(`^/[A-Za-z0-9_@]+(\s|$)`), textRuleCommand)
+}
+
+// HasText требует хотя бы одну букву или цифру, отклоняет одни эмодзи и знаки
+func HasText() Rule {
+	return func(lang string, text string) string {
+		for _, r := range text {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return ""
+			}
+		}
+
+		return i18n.T(lang, textRuleNoText)
+	}
+}
+
+func SingleLine() Rule {
+	return NotMatch(regexp.MustCompile(`\n`), textRuleMultiline)
+}
+
+// NotMatch отклоняет текст, в котором нашлось запрещенное выражение re, message - ключ текста отказа
+func NotMatch(re *regexp.Regexp, message string) Rule {
+	return func(lang string, text string) string {
+		if re.MatchString(text) {
+			return i18n.T(lang, message)
+		}
+
+		return ""
+	}
+}
@@ -0,0 +1,367 @@
+package fsm
+
+import (
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	rmodels "github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/redis"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Команды клиента, с которых начинается опрос
+const (
+	CommandStart     = "/start"
+	CommandNew       = "/new"
+	CommandMyTickets = "/mytickets"
+	CommandAdmin     = "/admin"
+	CommandCancel    = "/cancel"
+)
+
+// Шаги опроса, имя шага - состояние чата в redis
+const (
+	StateMenu        = "menu"
+	StateUnit        = "unit"
+	StateName        = "name"
+	StateField       = "field"
+	StateDescription = "description"
+	StateDone        = "done"
+	StateSubmitted   = "submitted"
+	StateCancelled   = "cancelled"
+	StateDiscarded   = "discarded"
+	StateResume      = "resume"
+
+	StateAdminKey      = "admin_key"
+	StateAdminLoggedIn = "admin_logged_in"
+	StateAdminWrong    = "admin_wrong"
+)
+
+// Ключи текстов опроса в каталоге i18n
+const (
+	textHello         = "wizard_hello"
+	textSelectUnit    = "wizard_select_unit"
+	textNoUnits       = "wizard_no_units"
+	textName          = "wizard_name"
+	textDescription   = "wizard_description"
+	textSubmit        = "wizard_submit"
+	textAttachments   = "wizard_attachments"
+	textSubmitYes     = "wizard_submit_yes"
+	textSubmitNo      = "wizard_submit_no"
+	textSubmitSuccess = "wizard_submit_success"
+	textSubmitFailure = "wizard_submit_failure"
+	textUnknown       = "unknown"
+	textDiscarded     = "wizard_discarded"
+
+	textResume       = "wizard_resume"
+	textResumeYes    = "wizard_resume_yes"
+	textResumeNo     = "wizard_resume_no"
+	textResumeChoose = "wizard_resume_choose"
+	textResumeEmpty  = "wizard_resume_empty"
+
+	textEditUnit        = "wizard_edit_unit"
+	textEditName        = "wizard_edit_name"
+	textEditDescription = "wizard_edit_description"
+
+	textAdminKey  = "wizard_admin_key"
+	textAdminHint = "wizard_admin_hint"
+
+	textAttachmentNotHere = "wizard_attachment_not_here"
+)
+
+// Кнопок подразделений в одном ряду клавиатуры
+const unitsPerRow = 3
+
+// Ограничения ввода. Описание с запасом меньше лимита сообщения телеграма в 4096 символов:
+// админам оно уходит вместе с заголовком и ответами на поля
+const (
+	nameMinLength        = 3
+	nameMaxLength        = 100
+	descriptionMaxLength = 3000
+)
+
+// NewTicketWizard - опрос клиента при создании заявки и вход админа по приглашению
+func NewTicketWizard() *Machine {
+	return MustNew(ticketSteps(), ticketCommands())
+}
+
+func ticketCommands() map[string]Transition {
+	return map[string]Transition{
+		CommandStart: {To: StateMenu, Reset: true},
+		CommandNew:   {To: StateUnit, Reset: true, Action: ActionClearDraft},
+		CommandAdmin: {To: StateAdminKey, Reset: true},
+		// Работает на любом шаге, черновик и состояние удаляет действие
+		CommandCancel: {To: StateDiscarded, Action: ActionCancel, Keep: true},
+	}
+}
+
+func ticketSteps() map[string]Step {
+	menu := []string{CommandNew, CommandMyTickets, CommandAdmin}
+
+	return map[string]Step{
+		StateMenu: {
+			Prompt: text(textHello, menu),
+		},
+		StateUnit: {
+			Prompt:        promptUnits,
+			Validate:      validateUnit,
+			Apply:         applyUnit,
+			Next:          &Transition{To: StateName},
+			Current:       currentUnit,
+			Back:          true,
+			Draft:         true,
+			NoAttachments: true,
+		},
+		StateName: {
+			Prompt:        text(textName),
+			Validate:      Validate(NotEmpty(), NotCommand(), HasText(), SingleLine(), MinLength(nameMinLength), MaxLength(nameMaxLength)),
+			Apply:         applyText(func(data *redis.Data, text string) { data.Name = text }),
+			Next:          &Transition{To: StateField},
+			Current:       current(func(data redis.Data) string { return data.Name }),
+			Back:          true,
+			Draft:         true,
+			NoAttachments: true,
+		},
+		// Дополнительные поля подразделения по одному, data.Field - номер текущего
+		StateField: {
+			Prompt:        promptField,
+			Validate:      validateField,
+			Apply:         applyField,
+			Next:          &Transition{To: StateField},
+			Skip:          skipField,
+			SkipTo:        StateDescription,
+			Current:       currentAnswer,
+			Back:          true,
+			Revisit:       revisitField,
+			Draft:         true,
+			NoAttachments: true,
+		},
+		StateDescription: {
+			Prompt:   text(textDescription),
+			Validate: Validate(NotEmpty(), NotCommand(), HasText(), MaxLength(descriptionMaxLength)),
+			Apply:    applyText(func(data *redis.Data, text string) { data.Description = text }),
+			Next:     &Transition{To: StateDone, Action: ActionAttach},
+			Current:  current(func(data redis.Data) string { return data.Description }),
+			Back:     true,
+			Draft:    true,
+		},
+		// Ввод кроме кнопок на последнем шаге - уже сообщение по открытому тикету клиента
+		StateDone: {
+			Prompt: func(data redis.Data, env Env) (Reply, error) {
+				unit, err := unitTitle(data.Unit, env)
+				if err != nil {
+					return Reply{}, errors.Wrap(err, "unitTitle")
+				}
+
+				return Reply{
+					Text: i18n.T(env.Lang, textSubmit, i18n.Args{
+						"unit":        unit,
+						"name":        data.Name,
+						"fields":      i18n.Safe(formatAnswers(env.Lang, data.Fields)),
+						"description": data.Description,
+						"attachments": i18n.Plain(env.Lang, textAttachments, i18n.Args{"n": data.Attachments}),
+					}),
+					Keyboard: [][]string{
+						{i18n.Plain(env.Lang, textSubmitYes), i18n.Plain(env.Lang, textSubmitNo)},
+						{i18n.Plain(env.Lang, textEditUnit)},
+						{i18n.Plain(env.Lang, textEditName)},
+						{i18n.Plain(env.Lang, textEditDescription)},
+					},
+				}, nil
+			},
+			On: map[string]Transition{
+				// Номер заявки сохраняется до отправки: если она не ушла, повторное нажатие
+				// не создаст дубль. Ушедшая заявка уводит из шага, править и отменять ее уже нечего
+				textSubmitYes:       {To: StateSubmitted, Action: ActionSubmit},
+				textSubmitNo:        {To: StateCancelled, Action: ActionCancel, Keep: true},
+				textEditUnit:        {To: StateUnit, Return: true},
+				textEditName:        {To: StateName, Return: true},
+				textEditDescription: {To: StateDescription, Return: true},
+			},
+			Back:  true,
+			Draft: true,
+			// Вложения считаем при каждом показе: части альбома могли прийти позже описания
+			Enter: ActionCountAttachments,
+		},
+		StateSubmitted: {
+			Prompt: func(data redis.Data, env Env) (Reply, error) {
+				return Reply{Text: i18n.T(env.Lang, textSubmitSuccess, i18n.Args{"ticket": data.Reference})}, nil
+			},
+		},
+		StateCancelled: {
+			Prompt: text(textSubmitFailure, []string{CommandNew}),
+		},
+		StateDiscarded: {
+			Prompt: text(textDiscarded, menu),
+		},
+		// Черновик пережил состояние опроса: продолжить с того же шага или удалить.
+		// Шаг, на котором остановился клиент, драйвер берет из черновика
+		StateResume: {
+			Prompt: promptResume,
+			On: map[string]Transition{
+				textResumeYes: {To: StateResume, Action: ActionResume, Keep: true},
+				textResumeNo:  {To: StateDiscarded, Action: ActionCancel, Keep: true},
+			},
+			Validate: func(_ redis.Data, _ Input, env Env) (string, error) { return i18n.T(env.Lang, textResumeChoose), nil },
+			Next:     &Transition{To: StateResume},
+		},
+		StateAdminKey: {
+			Prompt: text(textAdminKey),
+			Next:   &Transition{To: StateAdminKey, Action: ActionLogin, Keep: true},
+		},
+		StateAdminLoggedIn: {
+			Prompt: text(textAdminHint),
+			Next:   &Transition{To: StateAdminLoggedIn, Keep: true},
+		},
+		// После неверного кода ввод разбирается как обычное сообщение
+		StateAdminWrong: {},
+	}
+}
+
+// text - шаг с постоянным текстом message из каталога и клавиатурой из команд
+func text(message string, keyboard ...[]string) func(redis.Data, Env) (Reply, error) {
+	return func(_ redis.Data, env Env) (Reply, error) {
+		return Reply{Text: i18n.T(env.Lang, message), Keyboard: keyboard}, nil
+	}
+}
+
+// applyText - Apply шага, который сохраняет текст ввода без пробелов по краям
+func applyText(save func(data *redis.Data, text string)) func(*redis.Data, Input, Env) error {
+	return func(data *redis.Data, input Input, _ Env) error {
+		save(data, strings.TrimSpace(input.Text))
+
+		return nil
+	}
+}
+
+// current - Current шага, прежний ответ на котором хранится в поле данных опроса
+func current(answer func(data redis.Data) string) func(redis.Data, Env) (string, error) {
+	return func(data redis.Data, _ Env) (string, error) {
+		return answer(data), nil
+	}
+}
+
+// applyUnit сохраняет ключ подразделения, выбранного по названию на кнопке. У другого подразделения
+// другие поля, поэтому при смене ответы на поля сбрасываются и опрос идет дальше по порядку, даже при правке
+func applyUnit(data *redis.Data, input Input, env Env) error {
+	found, err := findUnit(input.Text, env)
+	if err != nil {
+		return errors.Wrap(err, "findUnit")
+	}
+
+	unit := strings.TrimSpace(input.Text)
+	if found != nil {
+		unit = found.Name
+	}
+
+	if unit != data.Unit {
+		data.Fields = nil
+		data.Field = 0
+		data.Return = ""
+	}
+
+	data.Unit = unit
+
+	return nil
+}
+
+// promptResume показывает, что осталось в черновике
+func promptResume(data redis.Data, env Env) (Reply, error) {
+	unit, err := unitTitle(data.Unit, env)
+	if err != nil {
+		return Reply{}, errors.Wrap(err, "unitTitle")
+	}
+
+	name := data.Name
+	if unit == "" {
+		unit = i18n.Plain(env.Lang, textResumeEmpty)
+	}
+
+	if name == "" {
+		name = i18n.Plain(env.Lang, textResumeEmpty)
+	}
+
+	return Reply{
+		Text:     i18n.T(env.Lang, textResume, i18n.Args{"unit": unit, "name": name}),
+		Keyboard: [][]string{{i18n.Plain(env.Lang, textResumeYes), i18n.Plain(env.Lang, textResumeNo)}},
+	}, nil
+}
+
+// promptUnits предлагает выбрать подразделение из принимающих заявки
+func promptUnits(_ redis.Data, env Env) (Reply, error) {
+	units, err := env.Units()
+	if err != nil {
+		return Reply{}, errors.Wrap(err, "Units")
+	}
+
+	if len(units) == 0 {
+		return Reply{Text: i18n.T(env.Lang, textNoUnits)}, nil
+	}
+
+	titles := make([]string, 0, len(units))
+	for _, v := range units {
+		titles = append(titles, v.Title(env.Lang))
+	}
+
+	rows := make([][]string, 0, len(titles)/unitsPerRow+1)
+	for i := 0; i < len(titles); i += unitsPerRow {
+		rows = append(rows, titles[i:min(i+unitsPerRow, len(titles))])
+	}
+
+	return Reply{Text: i18n.T(env.Lang, textSelectUnit), Keyboard: rows}, nil
+}
+
+// validateUnit проверяет выбор подразделения по актуальному списку
+func validateUnit(_ redis.Data, input Input, env Env) (string, error) {
+	unit, err := findUnit(input.Text, env)
+	if err != nil {
+		return "", errors.Wrap(err, "findUnit")
+	}
+
+	if unit == nil {
+		return i18n.T(env.Lang, textUnknown), nil
+	}
+
+	return "", nil
+}
+
+// findUnit ищет подразделение по названию на языке клиента или по ключу:
+// клавиатура могла быть отправлена до того, как у подразделения появился перевод
+func findUnit(text string, env Env) (*rmodels.Unit, error) {
+	units, err := env.Units()
+	if err != nil {
+		return nil, errors.Wrap(err, "Units")
+	}
+
+	text = strings.TrimSpace(text)
+	for i, v := range units {
+		if v.Title(env.Lang) == text || v.Name == text {
+			return &units[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// unitTitle - название подразделения на языке клиента, без перевода или списка - сам ключ
+func unitTitle(unit string, env Env) (string, error) {
+	if unit == "" || env.Units == nil {
+		return unit, nil
+	}
+
+	units, err := env.Units()
+	if err != nil {
+		return "", errors.Wrap(err, "Units")
+	}
+
+	for _, v := range units {
+		if v.Name == unit {
+			return v.Title(env.Lang), nil
+		}
+	}
+
+	return unit, nil
+}
+
+// currentUnit - выбранное подразделение так, как клиент видит его на кнопке
+func currentUnit(data redis.Data, env Env) (string, error) {
+	return unitTitle(data.Unit, env)
+}
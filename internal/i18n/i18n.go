@@ -0,0 +1,348 @@
+package i18n
+
+import (
+	"context"
+	"embed"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Default - язык по умолчанию: на нем пишут чатам без выбранного языка
+// и с языком, которого нет в каталоге
+const Default = "ru"
+
+// Формы множественного числа, по правилам CLDR
+const (
+	formOne   = "one"
+	formFew   = "few"
+	formMany  = "many"
+	formOther = "other"
+)
+
+// Название языка в его же каталоге, для /lang
+const keyLanguageName = "language_name"
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// Каталог грузится при старте: ошибка в файле языка - ошибка программы.
+// Configure заменяет его каталогом с разметкой и текстами из каталога шаблонов
+var catalog = mustLoad()
+
+// Args - данные шаблона текста, {{.name}} берет значение name. Для текста
+// с формами множественного числа число берется из "n"
+type Args map[string]interface{}
+
+// message - шаблон текста или формы множественного числа, у текста без форм ключ ""
+type message map[string]form
+
+// form - шаблон в двух видах: с разметкой для сообщений и без нее для кнопок и всплывающих уведомлений
+type form struct {
+	text  *template.Template
+	plain *template.Template
+}
+
+// source - тексты языка до разбора: ключ текста - формы, у текста без форм ключ ""
+type source map[string]map[string]string
+
+type langKey struct{}
+
+// WithLang запоминает язык чата, для которого обрабатывается апдейт
+func WithLang(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, langKey{}, lang)
+}
+
+// FromContext - язык чата из WithLang, без него - язык по умолчанию
+func FromContext(ctx context.Context) string {
+	if lang, ok := ctx.Value(langKey{}).(string); ok {
+		return lang
+	}
+
+	return Default
+}
+
+// Lang приводит код языка телеграма ("en", "en-US", "pt-br") к языку каталога
+func Lang(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+
+	if _, ok := catalog[code]; ok {
+		return code
+	}
+
+	return Default
+}
+
+// Supported - языки каталога по алфавиту
+func Supported() []string {
+	langs := make([]string, 0, len(catalog))
+	for k := range catalog {
+		langs = append(langs, k)
+	}
+
+	sort.Strings(langs)
+
+	return langs
+}
+
+// Name - название языка на нем самом
+func Name(lang string) string {
+	return Plain(lang, keyLanguageName)
+}
+
+// T - текст сообщения key на языке lang по шаблону с данными args.
+// Подстановки экранируются под формат разметки, кроме Safe
+func T(lang string, key string, args ...Args) string {
+	return render(lang, key, false, args)
+}
+
+// Plain - текст key без разметки: для кнопок, всплывающих уведомлений и названий тем
+func Plain(lang string, key string, args ...Args) string {
+	return render(lang, key, true, args)
+}
+
+// Is проверяет, что text - текст кнопки key на любом из языков.
+// Так кнопка срабатывает, даже если клавиатура осталась от прошлого языка
+func Is(key string, text string) bool {
+	for lang, messages := range catalog {
+		if _, ok := messages[key]; ok && Plain(lang, key) == text {
+			return true
+		}
+	}
+
+	return false
+}
+
+func render(lang string, key string, plain bool, args []Args) string {
+	var values Args
+	if len(args) > 0 {
+		values = args[0]
+	}
+
+	if _, ok := catalog[lang]; !ok {
+		lang = Default
+	}
+
+	text, err := execute(lang, key, plain, values)
+	if err == nil {
+		return text
+	}
+
+	// Сломанный свой текст не должен оставлять пользователя с ключом вместо сообщения
+	logger.WithError(err).Errorf("i18n: message %s, language %s", key, lang)
+
+	if lang != Default {
+		if text, err = execute(Default, key, plain, values); err == nil {
+			return text
+		}
+
+		logger.WithError(err).Errorf("i18n: message %s, language %s", key, Default)
+	}
+
+	return key
+}
+
+// execute выполняет шаблон текста key на языке lang
+func execute(lang string, key string, plain bool, values Args) (string, error) {
+	msg, ok := catalog[lang][key]
+	if !ok {
+		return "", errors.New("unknown message")
+	}
+
+	f, ok := msg[""]
+	if !ok {
+		f = plural(lang, msg, values["n"])
+	}
+
+	t := f.text
+	if plain {
+		t = f.plain
+	}
+
+	var sb strings.Builder
+	if err := t.Execute(&sb, values); err != nil {
+		return "", errors.Wrap(err, "template.Execute")
+	}
+
+	return sb.String(), nil
+}
+
+// plural выбирает форму множественного числа для n
+func plural(lang string, msg message, n interface{}) form {
+	var count int64
+
+	switch v := n.(type) {
+	case int:
+		count = int64(v)
+	case int64:
+		count = v
+	case uint64:
+		count = int64(v)
+	}
+
+	if text, ok := msg[pluralForm(lang, count)]; ok {
+		return text
+	}
+
+	return msg[formOther]
+}
+
+func pluralForm(lang string, n int64) string {
+	if n < 0 {
+		n = -n
+	}
+
+	switch lang {
+	case "ru":
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return formOne
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return formFew
+		default:
+			return formMany
+		}
+
+	default:
+		if n == 1 {
+			return formOne
+		}
+
+		return formOther
+	}
+}
+
+// mustLoad читает встроенный каталог, без разметки и своих текстов
+func mustLoad() map[string]map[string]message {
+	loaded, err := load("", FormatText)
+	if err != nil {
+		panic(err)
+	}
+
+	return loaded
+}
+
+// load разбирает шаблоны всех языков каталога, тексты из dir заменяют встроенные.
+// В каждом языке должны быть те же тексты, что и в языке по умолчанию
+func load(dir string, messageFormat string) (map[string]map[string]message, error) {
+	sources, err := readLocales()
+	if err != nil {
+		return nil, errors.Wrap(err, "readLocales")
+	}
+
+	defaults, ok := sources[Default]
+	if !ok {
+		return nil, errors.Errorf("no default locale %s", Default)
+	}
+
+	for lang, messages := range sources {
+		for k := range defaults {
+			if _, exists := messages[k]; !exists {
+				return nil, errors.Errorf("locale %s: no message %s", lang, k)
+			}
+		}
+
+		for k := range messages {
+			if _, exists := defaults[k]; !exists {
+				return nil, errors.Errorf("locale %s: unknown message %s", lang, k)
+			}
+		}
+	}
+
+	overrides, err := readOverrides(dir, sources)
+	if err != nil {
+		return nil, errors.Wrap(err, "readOverrides")
+	}
+
+	loaded := make(map[string]map[string]message, len(sources))
+
+	for lang, messages := range sources {
+		loaded[lang] = make(map[string]message, len(messages))
+
+		for k, v := range messages {
+			forms, overridden := overrides[lang][k]
+			if !overridden {
+				forms = v
+			}
+
+			msg, errCompile := compile(k, forms, messageFormat, !overridden)
+			if errCompile != nil {
+				return nil, errors.Wrapf(errCompile, "locale %s", lang)
+			}
+
+			if overridden {
+				if errData := checkData(k, v, msg); errData != nil {
+					return nil, errors.Wrapf(errData, "locale %s", lang)
+				}
+			}
+
+			loaded[lang][k] = msg
+		}
+	}
+
+	return loaded, nil
+}
+
+// readLocales читает встроенные файлы языков
+func readLocales() (map[string]source, error) {
+	files, err := locales.ReadDir("locales")
+	if err != nil {
+		return nil, errors.Wrap(err, "locales.ReadDir")
+	}
+
+	sources := make(map[string]source, len(files))
+
+	for _, v := range files {
+		b, errRead := locales.ReadFile(path.Join("locales", v.Name()))
+		if errRead != nil {
+			return nil, errors.Wrap(errRead, "locales.ReadFile")
+		}
+
+		messages, errParse := parseSource(b)
+		if errParse != nil {
+			return nil, errors.Wrap(errParse, v.Name())
+		}
+
+		sources[strings.TrimSuffix(v.Name(), path.Ext(v.Name()))] = messages
+	}
+
+	return sources, nil
+}
+
+// parseSource разбирает файл языка: ключ - текст или объект форм множественного числа
+func parseSource(b []byte) (source, error) {
+	var raw map[string]jsoniter.RawMessage
+	if err := jsoniter.Unmarshal(b, &raw); err != nil {
+		return nil, errors.Wrap(err, "jsoniter.Unmarshal")
+	}
+
+	messages := make(source, len(raw))
+
+	for k, v := range raw {
+		var text string
+		if err := jsoniter.Unmarshal(v, &text); err == nil {
+			messages[k] = map[string]string{"": text}
+
+			continue
+		}
+
+		var forms map[string]string
+		if err := jsoniter.Unmarshal(v, &forms); err != nil {
+			return nil, errors.Errorf("message %s: expected text or plural forms", k)
+		}
+
+		if _, ok := forms[formOther]; !ok {
+			return nil, errors.Errorf("message %s: no %q form", k, formOther)
+		}
+
+		messages[k] = forms
+	}
+
+	return messages, nil
+}
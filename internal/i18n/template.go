@@ -0,0 +1,362 @@
+package i18n
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Форматы разметки сообщений
+const (
+	FormatText       = "text"
+	FormatHTML       = "html"
+	FormatMarkdownV2 = "markdownv2"
+)
+
+// parse_mode телеграма для формата разметки
+var parseModes = map[string]string{
+	FormatText:       "",
+	FormatHTML:       "HTML",
+	FormatMarkdownV2: "MarkdownV2",
+}
+
+// Спецсимволы MarkdownV2, в тексте их экранирует обратный слеш
+var markdownV2Replacer = newMarkdownV2Replacer("\\_*[]()~`>#+-=|{}.!")
+
+// В блоке кода MarkdownV2 экранируются только обратный слеш и обратная кавычка
+var markdownV2PreReplacer = newMarkdownV2Replacer("\\`")
+
+// Функция экранирования, ее вызов дописывается к каждой подстановке шаблона
+const funcEscape = "escape"
+
+// Данные тикета: если встроенный текст берет тикет, свой текст может взять
+// и клиента с подразделением
+var ticketData = []string{"Ticket", "Client", "Unit"}
+
+// Формат разметки сообщений, задается Configure
+var format = FormatText
+
+// Логгер ошибок шаблонов при отправке, задается Configure
+var logger = logrus.StandardLogger()
+
+// Safe - текст, уже готовый для разметки: подстановка вставляет его как есть.
+// Так в сообщение попадают куски, собранные через T
+type Safe string
+
+// Configure задает формат разметки сообщений и заменяет встроенные тексты текстами из dir:
+// файл <язык>.json с частью ключей каталога, в формате разметки format.
+// Вызывается при старте, ошибка в шаблоне - ошибка запуска
+func Configure(dir string, messageFormat string, log *logrus.Logger) error {
+	if _, ok := parseModes[messageFormat]; !ok {
+		return errors.Errorf("unknown message format %q", messageFormat)
+	}
+
+	loaded, err := load(dir, messageFormat)
+	if err != nil {
+		return errors.Wrap(err, "load")
+	}
+
+	catalog, format, logger = loaded, messageFormat, log
+
+	return nil
+}
+
+// ParseMode - parse_mode для сообщений с текстами T, пусто - без разметки
+func ParseMode() string {
+	return parseModes[format]
+}
+
+// Escape экранирует text под формат разметки. Нужен для данных пользователя,
+// которые попадают в сообщение мимо шаблона
+func Escape(text string) string {
+	return escape(format, text)
+}
+
+// Pre оформляет text моноширинным блоком в формате разметки, text экранируется целиком.
+// Без разметки блока нет, text остается как есть
+func Pre(text string) string {
+	switch format {
+	case FormatHTML:
+		return "<pre>" + html.EscapeString(text) + "</pre>"
+	case FormatMarkdownV2:
+		return "```\n" + markdownV2PreReplacer.Replace(text) + "\n```"
+	default:
+		return text
+	}
+}
+
+func escape(messageFormat string, text string) string {
+	switch messageFormat {
+	case FormatHTML:
+		return html.EscapeString(text)
+	case FormatMarkdownV2:
+		return markdownV2Replacer.Replace(text)
+	default:
+		return text
+	}
+}
+
+func newMarkdownV2Replacer(chars string) *strings.Replacer {
+	pairs := make([]string, 0, len(chars)*2)
+	for _, r := range chars {
+		pairs = append(pairs, string(r), "\\"+string(r))
+	}
+
+	return strings.NewReplacer(pairs...)
+}
+
+// readOverrides читает свои тексты из dir, пустой dir - своих текстов нет
+func readOverrides(dir string, sources map[string]source) (map[string]source, error) {
+	overrides := make(map[string]source)
+	if dir == "" {
+		return overrides, nil
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "os.ReadDir")
+	}
+
+	for _, v := range files {
+		if v.IsDir() || filepath.Ext(v.Name()) != ".json" {
+			continue
+		}
+
+		lang := strings.TrimSuffix(v.Name(), ".json")
+
+		messages, ok := sources[lang]
+		if !ok {
+			return nil, errors.Errorf("%s: unknown locale %s", v.Name(), lang)
+		}
+
+		b, errRead := os.ReadFile(filepath.Join(dir, v.Name()))
+		if errRead != nil {
+			return nil, errors.Wrap(errRead, "os.ReadFile")
+		}
+
+		custom, errParse := parseSource(b)
+		if errParse != nil {
+			return nil, errors.Wrap(errParse, v.Name())
+		}
+
+		for k := range custom {
+			if _, exists := messages[k]; !exists {
+				return nil, errors.Errorf("%s: unknown message %s", v.Name(), k)
+			}
+		}
+
+		overrides[lang] = custom
+	}
+
+	return overrides, nil
+}
+
+// compile разбирает шаблоны текста key. builtin - встроенный текст, он написан
+// без разметки, и под формат экранируется весь, а не только подстановки
+func compile(key string, forms map[string]string, messageFormat string, builtin bool) (message, error) {
+	msg := make(message, len(forms))
+
+	for k, v := range forms {
+		text, err := parseTemplate(key, v, messageFormat, builtin)
+		if err != nil {
+			return nil, errors.Wrap(err, "parseTemplate")
+		}
+
+		plain, err := parseTemplate(key, v, FormatText, false)
+		if err != nil {
+			return nil, errors.Wrap(err, "parseTemplate")
+		}
+
+		msg[k] = form{text: text, plain: plain}
+	}
+
+	return msg, nil
+}
+
+func parseTemplate(name string, text string, messageFormat string, escapeText bool) (*template.Template, error) {
+	t, err := template.New(name).Funcs(template.FuncMap{funcEscape: escapeValue(messageFormat)}).Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "template.Parse")
+	}
+
+	for _, v := range t.Templates() {
+		if v.Tree != nil {
+			escapeNode(v.Tree, v.Tree.Root, messageFormat, escapeText)
+		}
+	}
+
+	return t, nil
+}
+
+// escapeValue выводит значение подстановки: нет значения - пусто, Safe - как есть
+func escapeValue(messageFormat string) func(interface{}) string {
+	return func(v interface{}) string {
+		switch value := v.(type) {
+		case nil:
+			return ""
+		case Safe:
+			return string(value)
+		default:
+			return escape(messageFormat, fmt.Sprint(value))
+		}
+	}
+}
+
+// escapeNode дописывает экранирование к каждой подстановке шаблона,
+// escapeText - экранировать и сам текст шаблона
+func escapeNode(tree *parse.Tree, node parse.Node, messageFormat string, escapeText bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+
+		for _, v := range n.Nodes {
+			escapeNode(tree, v, messageFormat, escapeText)
+		}
+
+	case *parse.TextNode:
+		if escapeText {
+			n.Text = []byte(escape(messageFormat, string(n.Text)))
+		}
+
+	case *parse.ActionNode:
+		// Объявление переменной ничего не выводит
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{parse.NewIdentifier(funcEscape).SetTree(tree).SetPos(n.Pos)},
+		})
+
+	case *parse.IfNode:
+		escapeNode(tree, n.List, messageFormat, escapeText)
+		escapeNode(tree, n.ElseList, messageFormat, escapeText)
+
+	case *parse.RangeNode:
+		escapeNode(tree, n.List, messageFormat, escapeText)
+		escapeNode(tree, n.ElseList, messageFormat, escapeText)
+
+	case *parse.WithNode:
+		escapeNode(tree, n.List, messageFormat, escapeText)
+		escapeNode(tree, n.ElseList, messageFormat, escapeText)
+	}
+}
+
+// checkData проверяет, что свой текст key берет только те данные, которые передаются
+// встроенному тексту forms: так опечатка в имени ловится при старте, а не пустым местом в сообщении
+func checkData(key string, forms map[string]string, msg message) error {
+	known := make(map[string]bool)
+
+	for _, v := range forms {
+		t, err := parseTemplate(key, v, FormatText, false)
+		if err != nil {
+			return errors.Wrap(err, "parseTemplate")
+		}
+
+		for _, tmpl := range t.Templates() {
+			if tmpl.Tree != nil {
+				dataNames(tmpl.Tree.Root, known, true)
+			}
+		}
+	}
+
+	ticket := false
+	for _, v := range ticketData {
+		ticket = ticket || known[v]
+	}
+
+	for _, v := range ticketData {
+		known[v] = known[v] || ticket
+	}
+
+	for _, v := range msg {
+		used := make(map[string]bool)
+
+		for _, tmpl := range v.plain.Templates() {
+			if tmpl.Tree != nil {
+				dataNames(tmpl.Tree.Root, used, true)
+			}
+		}
+
+		for name := range used {
+			if !known[name] {
+				return errors.Errorf("message %s: unknown data .%s", key, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// dataNames собирает имена данных шаблона: {{.name}}, {{$.name}}. top - точка
+// указывает на данные шаблона, внутри range и with она указывает на другое
+func dataNames(node parse.Node, names map[string]bool, top bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+
+		for _, v := range n.Nodes {
+			dataNames(v, names, top)
+		}
+
+	case *parse.ActionNode:
+		dataNames(n.Pipe, names, top)
+
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+
+		for _, v := range n.Cmds {
+			dataNames(v, names, top)
+		}
+
+	case *parse.CommandNode:
+		for _, v := range n.Args {
+			dataNames(v, names, top)
+		}
+
+	case *parse.ChainNode:
+		dataNames(n.Node, names, top)
+
+	case *parse.FieldNode:
+		if top {
+			names[n.Ident[0]] = true
+		}
+
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			names[n.Ident[1]] = true
+		}
+
+	case *parse.TemplateNode:
+		dataNames(n.Pipe, names, top)
+
+	case *parse.IfNode:
+		dataNames(n.Pipe, names, top)
+		dataNames(n.List, names, top)
+		dataNames(n.ElseList, names, top)
+
+	case *parse.RangeNode:
+		dataNames(n.Pipe, names, top)
+		dataNames(n.List, names, false)
+		dataNames(n.ElseList, names, top)
+
+	case *parse.WithNode:
+		dataNames(n.Pipe, names, top)
+		dataNames(n.List, names, false)
+		dataNames(n.ElseList, names, top)
+	}
+}
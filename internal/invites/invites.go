@@ -0,0 +1,91 @@
+package invites
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	TTL = 24 * time.Hour
+
+	// 16 байт в base64url - 22 символа, влезает в параметр /start (до 64 символов [A-Za-z0-9_-])
+	tokenBytes = 16
+)
+
+// Create создает приглашение в подразделение и возвращает код, в базе остается только его хеш.
+// createdBy - чат пригласившего, nil для приглашений, созданных при старте
+func Create(ctx context.Context, repo repository.Repository, unit, role string, createdBy *int64) (string, error) {
+	buf := make([]byte, tokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrap(err, "rand.Read")
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	invite := models.Invite{
+		TokenHash: Hash(token),
+		Unit:      unit,
+		Role:      role,
+		CreatedBy: createdBy,
+		ExpiresAt: time.Now().Add(TTL),
+	}
+
+	if err := repo.SaveInvite(ctx, invite); err != nil {
+		return "", errors.Wrap(err, "repo.SaveInvite")
+	}
+
+	return token, nil
+}
+
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Link - deep link, по которому бот получит "/start <token>"
+func Link(botUserName, token string) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s", botUserName, token)
+}
+
+// Bootstrap выдает приглашение владельца, пока владельцев нет ни в одном подразделении,
+// иначе после первого запуска пригласить админов некому
+func Bootstrap(ctx context.Context, repo repository.Repository, botUserName string, logger *logrus.Logger) error {
+	units, err := repo.GetUnits(ctx, false)
+	if err != nil {
+		return errors.Wrap(err, "repo.GetUnits")
+	}
+
+	if len(units) == 0 {
+		return nil
+	}
+
+	for _, v := range units {
+		owners, errOwners := repo.GetAdminsByRole(ctx, v.Name, models.RoleOwner)
+		if errOwners != nil {
+			return errors.Wrap(errOwners, "repo.GetAdminsByRole")
+		}
+
+		if len(owners) > 0 {
+			return nil
+		}
+	}
+
+	token, err := Create(ctx, repo, units[0].Name, models.RoleOwner, nil)
+	if err != nil {
+		return errors.Wrap(err, "Create")
+	}
+
+	logger.Warnf("Bot has no owner, invite link: %s", Link(botUserName, token))
+
+	return nil
+}
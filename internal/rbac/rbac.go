@@ -0,0 +1,162 @@
+package rbac
+
+import (
+	"context"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/pkg/errors"
+)
+
+type Permission string
+
+const (
+	// PermissionNone - действие доступно всем, в том числе клиентам
+	PermissionNone Permission = ""
+
+	PermissionAnswerTickets   Permission = "answer_tickets"
+	PermissionViewTemplates   Permission = "view_templates"
+	PermissionManageTemplates Permission = "manage_templates"
+	PermissionManageAgents    Permission = "manage_agents"
+	PermissionReassignTickets Permission = "reassign_tickets"
+	PermissionViewStats       Permission = "view_stats"
+	PermissionManageUnits     Permission = "manage_units"
+	PermissionManageInvites   Permission = "manage_invites"
+	PermissionManageSchedule  Permission = "manage_schedule"
+)
+
+// Матрица прав: агент отвечает на тикеты, руководитель управляет агентами,
+// переназначает тикеты, смотрит статистику и задает расписание, владелец управляет подразделениями и приглашениями
+var matrix = map[string][]Permission{
+	models.RoleAgent: {
+		PermissionAnswerTickets,
+		PermissionViewTemplates,
+	},
+	models.RoleSupervisor: {
+		PermissionAnswerTickets,
+		PermissionViewTemplates,
+		PermissionManageTemplates,
+		PermissionManageAgents,
+		PermissionReassignTickets,
+		PermissionViewStats,
+		PermissionManageSchedule,
+	},
+	models.RoleOwner: {
+		PermissionAnswerTickets,
+		PermissionViewTemplates,
+		PermissionManageTemplates,
+		PermissionManageAgents,
+		PermissionReassignTickets,
+		PermissionViewStats,
+		PermissionManageSchedule,
+		PermissionManageUnits,
+		PermissionManageInvites,
+	},
+}
+
+// Request - право, которое нужно для действия, и подразделение, в котором оно нужно.
+// Пустой Unit - право нужно хотя бы в одном подразделении
+type Request struct {
+	Permission Permission
+	Unit       string
+}
+
+type Authorizer interface {
+	Can(ctx context.Context, chatID int64, unit string, permission Permission) (bool, error)
+	Units(ctx context.Context, chatID int64, permission Permission) ([]string, error)
+}
+
+type authorizer struct {
+	repo repository.Repository
+}
+
+func NewAuthorizer(repo repository.Repository) *authorizer {
+	return &authorizer{
+		repo: repo,
+	}
+}
+
+func Allowed(role string, permission Permission) bool {
+	if permission == PermissionNone {
+		return true
+	}
+
+	for _, v := range matrix[role] {
+		if v == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Can проверяет право чата в подразделении unit, пустой unit - в любом подразделении
+func (a *authorizer) Can(ctx context.Context, chatID int64, unit string, permission Permission) (bool, error) {
+	if permission == PermissionNone {
+		return true, nil
+	}
+
+	roles, err := a.roles(ctx, chatID)
+	if err != nil {
+		return false, errors.Wrap(err, "roles")
+	}
+
+	for k, v := range roles {
+		if (unit == "" || k == unit || v == models.RoleOwner) && Allowed(v, permission) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Units возвращает подразделения, в которых у чата есть право permission
+func (a *authorizer) Units(ctx context.Context, chatID int64, permission Permission) ([]string, error) {
+	roles, err := a.roles(ctx, chatID)
+	if err != nil {
+		return nil, errors.Wrap(err, "roles")
+	}
+
+	isOwner := false
+	for _, v := range roles {
+		isOwner = isOwner || v == models.RoleOwner
+	}
+
+	if !isOwner {
+		units := make([]string, 0, len(roles))
+		for k, v := range roles {
+			if Allowed(v, permission) {
+				units = append(units, k)
+			}
+		}
+
+		return units, nil
+	}
+
+	all, err := a.repo.GetUnits(ctx, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetUnits")
+	}
+
+	units := make([]string, 0, len(all))
+	for _, v := range all {
+		units = append(units, v.Name)
+	}
+
+	return units, nil
+}
+
+// roles возвращает роли чата по подразделениям.
+// Владелец - роль на весь бот, владелец одного подразделения владеет всеми
+func (a *authorizer) roles(ctx context.Context, chatID int64) (map[string]string, error) {
+	admins, err := a.repo.GetAdminRoles(ctx, chatID)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetAdminRoles")
+	}
+
+	roles := make(map[string]string, len(admins))
+	for _, v := range admins {
+		roles[v.Unit] = v.Role
+	}
+
+	return roles, nil
+}
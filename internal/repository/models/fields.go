@@ -0,0 +1,94 @@
+package models
+
+import (
+	"database/sql/driver"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const (
+	FieldText   = "text"
+	FieldNumber = "number"
+	FieldChoice = "choice"
+	FieldDate   = "date"
+)
+
+var fieldTypeNames = map[string]string{
+	FieldText:   "field_type_text",
+	FieldNumber: "field_type_number",
+	FieldChoice: "field_type_choice",
+	FieldDate:   "field_type_date",
+}
+
+func FieldTypeName(lang string, fieldType string) string {
+	if name, ok := fieldTypeNames[fieldType]; ok {
+		return i18n.Plain(lang, name)
+	}
+
+	return fieldType
+}
+
+// UnitField - дополнительное поле опроса подразделения.
+// Min и Max - границы числа для number и длины для text, nil - без границы
+type UnitField struct {
+	ID       uint64         `db:"id"`
+	Unit     string         `db:"unit"`
+	Key      string         `db:"key"`
+	Label    string         `db:"label"`
+	Type     string         `db:"type"`
+	Required bool           `db:"required"`
+	Options  pq.StringArray `db:"options"`
+	Min      *float64       `db:"min_value"`
+	Max      *float64       `db:"max_value"`
+	// Регулярное выражение для text, пусто - без проверки
+	Pattern string `db:"pattern"`
+}
+
+// FieldAnswer - ответ клиента на поле. Название поля сохраняем вместе с ответом,
+// чтобы старые тикеты не менялись при правке полей
+type FieldAnswer struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// FieldAnswers - ответы тикета в порядке опроса, в базе - JSONB
+type FieldAnswers []FieldAnswer
+
+func (f FieldAnswers) Value() (driver.Value, error) {
+	if f == nil {
+		return "[]", nil
+	}
+
+	b, err := jsoniter.Marshal(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "jsoniter.Marshal")
+	}
+
+	return string(b), nil
+}
+
+func (f *FieldAnswers) Scan(src interface{}) error {
+	var b []byte
+
+	switch v := src.(type) {
+	case nil:
+		*f = nil
+
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return errors.Errorf("unexpected fields type %T", src)
+	}
+
+	if err := jsoniter.Unmarshal(b, f); err != nil {
+		return errors.Wrap(err, "jsoniter.Unmarshal")
+	}
+
+	return nil
+}
@@ -1,15 +1,137 @@
 package models
 
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrAlreadyAssigned = errors.New("ticket is already assigned")
+	ErrAlreadyExists   = errors.New("already exists")
+)
+
 type Ticket struct {
 	ID          uint64 `db:"id"`
+	Reference   string `db:"reference"`
 	ChatID      int64  `db:"chat_id"`
+	ClientName  string `db:"client_name"`
 	Unit        string `db:"unit"`
 	Name        string `db:"name"`
 	Description string `db:"description"`
+	Status      string `db:"status"`
+	Priority    string `db:"priority"`
+
+	// Ответы на дополнительные поля подразделения
+	Fields FieldAnswers `db:"fields"`
+
+	// Админ, взявший тикет в работу, nil пока тикет никто не взял
+	Assignee     *int64 `db:"assignee"`
+	AssigneeName string `db:"assignee_name"`
+
+	// Начало отсчета SLA, nil при сохранении - с создания тикета
+	SLAStartedAt *time.Time `db:"sla_started_at"`
+}
+
+type Attachment struct {
+	ID           uint64 `db:"id"`
+	TicketID     uint64 `db:"ticket_id"`
+	ChatID       int64  `db:"chat_id"`
+	Type         string `db:"type"`
+	FileID       string `db:"file_id"`
+	FileUniqueID string `db:"file_unique_id"`
+	MediaGroupID string `db:"media_group_id"`
+	FileName     string `db:"file_name"`
+	MimeType     string `db:"mime_type"`
+	FileSize     int    `db:"file_size"`
+	Caption      string `db:"caption"`
+}
+
+// Notification - уведомление о тикете, отправленное в чат админа
+type Notification struct {
+	ID        uint64 `db:"id"`
+	TicketID  uint64 `db:"ticket_id"`
+	ChatID    int64  `db:"chat_id"`
+	MessageID int    `db:"message_id"`
+}
+
+type TicketMessage struct {
+	ID        uint64 `db:"id"`
+	TicketID  uint64 `db:"ticket_id"`
+	ChatID    int64  `db:"chat_id"`
+	FromAdmin bool   `db:"from_admin"`
+	Text      string `db:"text"`
+}
+
+// CannedResponse - шаблон ответа подразделения, текст может содержать
+// плейсхолдеры {client}, {ticket}, {name} и {unit}
+type CannedResponse struct {
+	ID    uint64 `db:"id"`
+	Unit  string `db:"unit"`
+	Title string `db:"title"`
+	Text  string `db:"text"`
+	Uses  int    `db:"uses"`
+}
+
+// UnitGroup - группа подразделения, ChatID nil - тикеты уходят в личные чаты админов
+type UnitGroup struct {
+	Unit   string `db:"name"`
+	ChatID *int64 `db:"group_chat_id"`
+	Topics bool   `db:"group_topics"`
+}
+
+// TicketTopic - тема форума группы, созданная для тикета
+type TicketTopic struct {
+	TicketID uint64 `db:"ticket_id"`
+	ChatID   int64  `db:"chat_id"`
+	ThreadID int    `db:"thread_id"`
 }
 
 type Admin struct {
 	ID     uint64 `db:"id"`
 	ChatID int64  `db:"chat_id"`
 	Unit   string `db:"unit"`
+	Role   string `db:"role"`
+	Name   string `db:"name"`
+}
+
+type Invite struct {
+	TokenHash string    `db:"token_hash"`
+	Unit      string    `db:"unit"`
+	Role      string    `db:"role"`
+	CreatedBy *int64    `db:"created_by"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// LoginAttempt - запись журнала попыток входа по приглашению
+type LoginAttempt struct {
+	ChatID   int64  `db:"chat_id"`
+	UserName string `db:"user_name"`
+	Success  bool   `db:"success"`
+}
+
+type Unit struct {
+	Name        string    `db:"name"`
+	Prefix      string    `db:"prefix"`
+	Description string    `db:"description"`
+	Names       UnitNames `db:"names"`
+	Position    int       `db:"position"`
+	Active      bool      `db:"active"`
+}
+
+// UnitHours - часы работы подразделения в день недели (0 - воскресенье),
+// время открытия и закрытия в секундах от полуночи
+type UnitHours struct {
+	Weekday  int `db:"weekday"`
+	OpensAt  int `db:"opens_at"`
+	ClosesAt int `db:"closes_at"`
+}
+
+// UnitSchedule - расписание подразделения, праздники в формате 2006-01-02
+type UnitSchedule struct {
+	Unit          string `db:"name"`
+	Timezone      string `db:"timezone"`
+	OffHoursReply string `db:"off_hours_reply"`
+	Hours         []UnitHours
+	Holidays      []string
 }
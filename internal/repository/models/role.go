@@ -0,0 +1,23 @@
+package models
+
+import "github.com/goddeuce1/tg_bot_tz/internal/i18n"
+
+const (
+	RoleAgent      = "agent"
+	RoleSupervisor = "supervisor"
+	RoleOwner      = "owner"
+)
+
+var roleNames = map[string]string{
+	RoleAgent:      "role_agent",
+	RoleSupervisor: "role_supervisor",
+	RoleOwner:      "role_owner",
+}
+
+func RoleName(lang string, role string) string {
+	if name, ok := roleNames[role]; ok {
+		return i18n.Plain(lang, name)
+	}
+
+	return role
+}
@@ -0,0 +1,37 @@
+package models
+
+import "github.com/goddeuce1/tg_bot_tz/internal/i18n"
+
+const (
+	RoutingBroadcast   = "broadcast"
+	RoutingRoundRobin  = "round_robin"
+	RoutingLeastLoaded = "least_loaded"
+)
+
+var routingNames = map[string]string{
+	RoutingBroadcast:   "routing_broadcast",
+	RoutingRoundRobin:  "routing_round_robin",
+	RoutingLeastLoaded: "routing_least_loaded",
+}
+
+func RoutingName(lang string, routing string) string {
+	if name, ok := routingNames[routing]; ok {
+		return i18n.Plain(lang, name)
+	}
+
+	return routing
+}
+
+// UnitRouting - стратегия распределения тикетов подразделения и время
+// в минутах, за которое выбранный агент должен взять тикет
+type UnitRouting struct {
+	Unit         string `db:"name"`
+	Strategy     string `db:"routing"`
+	ClaimTimeout int    `db:"claim_timeout_minutes"`
+}
+
+// AssigneeLoad - число незакрытых тикетов у исполнителя
+type AssigneeLoad struct {
+	ChatID int64 `db:"assignee"`
+	Open   int   `db:"open"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"time"
+)
+
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+
+	SLAFirstResponse = "first_response"
+	SLAResolution    = "resolution"
+)
+
+var priorityNames = map[string]string{
+	PriorityLow:    "priority_low",
+	PriorityNormal: "priority_normal",
+	PriorityHigh:   "priority_high",
+	PriorityUrgent: "priority_urgent",
+}
+
+// TicketSLA - тикет с его целями SLA и учетом пауз
+type TicketSLA struct {
+	Ticket
+
+	CreatedAt              time.Time  `db:"created_at"`
+	FirstResponseAt        *time.Time `db:"first_response_at"`
+	SLAPausedAt            *time.Time `db:"sla_paused_at"`
+	SLAPausedSeconds       int        `db:"sla_paused_seconds"`
+	FirstResponseEscalated bool       `db:"first_response_escalated"`
+	ResolutionEscalated    bool       `db:"resolution_escalated"`
+	FirstResponseMinutes   int        `db:"first_response_minutes"`
+	ResolutionMinutes      int        `db:"resolution_minutes"`
+	SupervisorChatID       *int64     `db:"supervisor_chat_id"`
+}
+
+// Deadline возвращает срок по цели SLA с учетом времени на паузе на момент now
+func (t TicketSLA) Deadline(kind string, now time.Time) time.Time {
+	minutes := t.ResolutionMinutes
+	if kind == SLAFirstResponse {
+		minutes = t.FirstResponseMinutes
+	}
+
+	paused := time.Duration(t.SLAPausedSeconds) * time.Second
+	if t.SLAPausedAt != nil {
+		paused += now.Sub(*t.SLAPausedAt)
+	}
+
+	start := t.CreatedAt
+	if t.SLAStartedAt != nil {
+		start = *t.SLAStartedAt
+	}
+
+	return start.Add(time.Duration(minutes)*time.Minute + paused)
+}
+
+func PriorityName(lang string, priority string) string {
+	if name, ok := priorityNames[priority]; ok {
+		return i18n.Plain(lang, name)
+	}
+
+	return priority
+}
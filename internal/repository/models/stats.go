@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// StatsFilter - по каким подразделениям и с какого момента считать статистику.
+// Period - исходная запись периода, по ней и подразделениям кешируется результат
+type StatsFilter struct {
+	Units  []string
+	Since  time.Time
+	Period string
+}
+
+type StatusCount struct {
+	Status string `db:"status" json:"status"`
+	Count  int    `db:"count" json:"count"`
+}
+
+// DailyCount - число созданных тикетов за день в формате 2006-01-02
+type DailyCount struct {
+	Day   string `db:"day" json:"day"`
+	Count int    `db:"count" json:"count"`
+}
+
+type AgentStats struct {
+	Name     string `db:"name" json:"name"`
+	Resolved int    `db:"resolved" json:"resolved"`
+}
+
+// Stats - статистика тикетов за период, медианы в секундах, nil - не по чему считать
+type Stats struct {
+	Statuses            []StatusCount `json:"statuses"`
+	Daily               []DailyCount  `json:"daily"`
+	MedianFirstResponse *float64      `db:"median_first_response" json:"median_first_response"`
+	MedianResolution    *float64      `db:"median_resolution" json:"median_resolution"`
+	TopAgents           []AgentStats  `json:"top_agents"`
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/pkg/errors"
+)
+
+const (
+	StatusOpen            = "open"
+	StatusInProgress      = "in_progress"
+	StatusWaitingOnClient = "waiting_on_client"
+	StatusResolved        = "resolved"
+	StatusClosed          = "closed"
+)
+
+var ErrStatusTransition = errors.New("ticket not found or status transition is not allowed")
+
+// Разрешенные переходы: статус -> в какие статусы можно перейти
+var statusTransitions = map[string][]string{
+	StatusOpen:            {StatusInProgress, StatusWaitingOnClient, StatusResolved, StatusClosed},
+	StatusInProgress:      {StatusWaitingOnClient, StatusResolved, StatusClosed},
+	StatusWaitingOnClient: {StatusInProgress, StatusResolved, StatusClosed},
+	StatusResolved:        {StatusOpen, StatusClosed},
+	StatusClosed:          {},
+}
+
+// Названия статусов в каталоге текстов
+var statusNames = map[string]string{
+	StatusOpen:            "status_open",
+	StatusInProgress:      "status_in_progress",
+	StatusWaitingOnClient: "status_waiting_on_client",
+	StatusResolved:        "status_resolved",
+	StatusClosed:          "status_closed",
+}
+
+// NextStatuses возвращает статусы, в которые можно перевести тикет из status
+func NextStatuses(status string) []string {
+	return statusTransitions[status]
+}
+
+// PrevStatuses возвращает статусы, из которых можно перевести тикет в status
+func PrevStatuses(status string) []string {
+	prev := make([]string, 0)
+
+	for from, next := range statusTransitions {
+		for _, v := range next {
+			if v == status {
+				prev = append(prev, from)
+			}
+		}
+	}
+
+	return prev
+}
+
+func CanTransition(from, to string) bool {
+	for _, v := range statusTransitions[from] {
+		if v == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+func StatusName(lang string, status string) string {
+	if name, ok := statusNames[status]; ok {
+		return i18n.Plain(lang, name)
+	}
+
+	return status
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"database/sql/driver"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+)
+
+// UnitNames - названия подразделения для клиентов по языкам, в базе - JSONB
+type UnitNames map[string]string
+
+func (n UnitNames) Value() (driver.Value, error) {
+	if n == nil {
+		return "{}", nil
+	}
+
+	b, err := jsoniter.Marshal(n)
+	if err != nil {
+		return nil, errors.Wrap(err, "jsoniter.Marshal")
+	}
+
+	return string(b), nil
+}
+
+func (n *UnitNames) Scan(src interface{}) error {
+	var b []byte
+
+	switch v := src.(type) {
+	case nil:
+		*n = nil
+
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return errors.Errorf("unexpected names type %T", src)
+	}
+
+	if err := jsoniter.Unmarshal(b, n); err != nil {
+		return errors.Wrap(err, "jsoniter.Unmarshal")
+	}
+
+	return nil
+}
+
+// Title - название подразделения на языке lang. Без перевода - само название,
+// оно же ключ подразделения
+func (u Unit) Title(lang string) string {
+	if title := u.Names[lang]; title != "" {
+		return title
+	}
+
+	return u.Name
+}
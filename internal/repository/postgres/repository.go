@@ -3,13 +3,29 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	sq "github.com/Masterminds/squirrel"
 	"github.com/goddeuce1/tg_bot_tz/internal/repository/models"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"os"
+	"strings"
+)
+
+// Сколько лучших агентов показывать в статистике
+const topAgents = 5
+
+// Коды ошибок нарушения уникальности и внешнего ключа в postgres
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+var (
+	ticketColumns = []string{"id", "reference", "chat_id", "client_name", "unit", "name", "description", "status", "priority", "assignee", "assignee_name", "fields"}
+	unitColumns   = []string{"name", "prefix", "description", "names", "position", "active"}
 )
 
 type repository struct {
@@ -34,10 +50,160 @@ func NewRepository(ctx context.Context, logger *logrus.Logger) (*repository, err
 	}, nil
 }
 
-func (r *repository) SaveTicket(ctx context.Context, ticket models.Ticket) error {
+// NextTicketReference выдает следующий номер тикета подразделения вида BILL-0042
+func (r *repository) NextTicketReference(ctx context.Context, unit string) (string, error) {
+	query, args := sq.Update("units").
+		Set("counter", sq.Expr("counter + 1")).
+		Where(sq.Eq{"name": unit}).
+		Suffix("RETURNING prefix, counter").
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var (
+		prefix string
+		value  int
+	)
+
+	if err := r.db.QueryRowxContext(ctx, query, args...).Scan(&prefix, &value); err != nil {
+		return "", errors.Wrap(err, "QueryRowxContext")
+	}
+
+	return fmt.Sprintf("%s-%04d", prefix, value), nil
+}
+
+// SaveTicket идемпотентен по номеру тикета: при повторной доставке
+// возвращается id уже сохраненного тикета
+func (r *repository) SaveTicket(ctx context.Context, ticket models.Ticket) (uint64, error) {
 	query, args := sq.Insert("tickets").
-		Columns("chat_id", "unit", "name", "description").
-		Values(ticket.ChatID, ticket.Unit, ticket.Name, ticket.Description).
+		Columns("reference", "chat_id", "client_name", "unit", "name", "description", "fields", "priority", "sla_started_at").
+		Values(
+			ticket.Reference, ticket.ChatID, ticket.ClientName, ticket.Unit, ticket.Name, ticket.Description, ticket.Fields,
+			// Приоритет по умолчанию берем из настроек подразделения
+			sq.Expr("COALESCE((SELECT default_priority FROM units WHERE name = ?), ?)", ticket.Unit, models.PriorityNormal),
+			sq.Expr("COALESCE(?::timestamptz, now())", ticket.SLAStartedAt),
+		).
+		Suffix("ON CONFLICT (reference) DO UPDATE SET reference = EXCLUDED.reference RETURNING id").
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var id uint64
+
+	if err := r.db.QueryRowxContext(ctx, query, args...).Scan(&id); err != nil {
+		return 0, errors.Wrap(err, "QueryRowxContext")
+	}
+
+	r.logger.Infof("Saved msg %v to DB", ticket)
+
+	return id, nil
+}
+
+func (r *repository) UpdateTicketStatus(ctx context.Context, ticketID uint64, status string) (*models.Ticket, error) {
+	// Проверка перехода прямо в WHERE, чтобы не было гонок между админами
+	// Пока тикет ждет клиента, SLA стоит на паузе: копим время паузы при выходе из ожидания
+	query, args := sq.Update("tickets").
+		Set("status", status).
+		Set("updated_at", sq.Expr("now()")).
+		Set("sla_paused_seconds", sq.Expr(
+			"CASE WHEN sla_paused_at IS NOT NULL AND ? <> ? "+
+				"THEN sla_paused_seconds + EXTRACT(EPOCH FROM now() - sla_paused_at)::int "+
+				"ELSE sla_paused_seconds END",
+			status, models.StatusWaitingOnClient,
+		)).
+		Set("sla_paused_at", sq.Expr(
+			"CASE WHEN ? = ? THEN COALESCE(sla_paused_at, now()) ELSE NULL END",
+			status, models.StatusWaitingOnClient,
+		)).
+		Set("resolved_at", sq.Expr(
+			"CASE WHEN ? IN (?, ?) THEN COALESCE(resolved_at, now()) ELSE NULL END",
+			status, models.StatusResolved, models.StatusClosed,
+		)).
+		Where(sq.Eq{"id": ticketID, "status": models.PrevStatuses(status)}).
+		Suffix("RETURNING " + strings.Join(ticketColumns, ", ")).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var ticket models.Ticket
+
+	if err := r.db.QueryRowxContext(ctx, query, args...).StructScan(&ticket); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrStatusTransition
+		}
+
+		return nil, errors.Wrap(err, "QueryRowxContext")
+	}
+
+	r.logger.Infof("Ticket %d moved to status %s", ticketID, status)
+
+	return &ticket, nil
+}
+
+// AssignTicket назначает тикет админу, только если его еще никто не взял
+func (r *repository) AssignTicket(ctx context.Context, ticketID uint64, chatID int64, name string) (*models.Ticket, error) {
+	query, args := sq.Update("tickets").
+		Set("assignee", chatID).
+		Set("assignee_name", name).
+		Set("updated_at", sq.Expr("now()")).
+		Where(sq.Eq{"id": ticketID, "assignee": nil}).
+		Suffix("RETURNING " + strings.Join(ticketColumns, ", ")).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var ticket models.Ticket
+
+	if err := r.db.QueryRowxContext(ctx, query, args...).StructScan(&ticket); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrAlreadyAssigned
+		}
+
+		return nil, errors.Wrap(err, "QueryRowxContext")
+	}
+
+	r.logger.Infof("Ticket %d assigned to %d", ticketID, chatID)
+
+	return &ticket, nil
+}
+
+// ReassignTicket передает тикет другому админу, nil - снимает исполнителя,
+// и тикет снова может взять любой админ подразделения
+func (r *repository) ReassignTicket(ctx context.Context, ticketID uint64, chatID *int64, name string) (*models.Ticket, error) {
+	query, args := sq.Update("tickets").
+		Set("assignee", chatID).
+		Set("assignee_name", name).
+		Set("updated_at", sq.Expr("now()")).
+		Where(sq.Eq{"id": ticketID}).
+		Suffix("RETURNING " + strings.Join(ticketColumns, ", ")).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var ticket models.Ticket
+
+	if err := r.db.QueryRowxContext(ctx, query, args...).StructScan(&ticket); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+
+		return nil, errors.Wrap(err, "QueryRowxContext")
+	}
+
+	r.logger.Infof("Ticket %d reassigned to %v", ticketID, chatID)
+
+	return &ticket, nil
+}
+
+// SaveAttachments идемпотентен: повторная доставка не дублирует вложения
+func (r *repository) SaveAttachments(ctx context.Context, attachments []models.Attachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	builder := sq.Insert("ticket_attachments").
+		Columns("ticket_id", "chat_id", "type", "file_id", "file_unique_id", "media_group_id", "file_name", "mime_type", "file_size", "caption")
+
+	for _, v := range attachments {
+		builder = builder.Values(v.TicketID, v.ChatID, v.Type, v.FileID, v.FileUniqueID, v.MediaGroupID, v.FileName, v.MimeType, v.FileSize, v.Caption)
+	}
+
+	query, args := builder.Suffix("on conflict do nothing").
 		PlaceholderFormat(sq.Dollar).
 		MustSql()
 
@@ -45,11 +211,170 @@ func (r *repository) SaveTicket(ctx context.Context, ticket models.Ticket) error
 		return errors.Wrap(err, "ExecContext")
 	}
 
-	r.logger.Infof("Saved msg %v to DB", ticket)
+	return nil
+}
+
+// GetAttachments возвращает вложения тикета в порядке получения
+func (r *repository) GetAttachments(ctx context.Context, ticketID uint64) ([]models.Attachment, error) {
+	query, args := sq.Select("id", "ticket_id", "chat_id", "type", "file_id", "file_unique_id", "media_group_id", "file_name", "mime_type", "file_size", "caption").
+		From("ticket_attachments").
+		Where(sq.Eq{"ticket_id": ticketID}).
+		OrderBy("id").
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var attachments []models.Attachment
+
+	if err := r.db.SelectContext(ctx, &attachments, query, args...); err != nil {
+		return nil, errors.Wrap(err, "SelectContext")
+	}
+
+	return attachments, nil
+}
+
+func (r *repository) SaveNotification(ctx context.Context, notification models.Notification) error {
+	query, args := sq.Insert("ticket_notifications").
+		Columns("ticket_id", "chat_id", "message_id").
+		Values(notification.TicketID, notification.ChatID, notification.MessageID).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return errors.Wrap(err, "ExecContext")
+	}
+
+	return nil
+}
+
+func (r *repository) GetNotifications(ctx context.Context, ticketID uint64) ([]models.Notification, error) {
+	query, args := sq.Select("id", "ticket_id", "chat_id", "message_id").
+		From("ticket_notifications").
+		Where(sq.Eq{"ticket_id": ticketID}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var notifications []models.Notification
+
+	if err := r.db.SelectContext(ctx, &notifications, query, args...); err != nil {
+		return nil, errors.Wrap(err, "SelectContext")
+	}
+
+	return notifications, nil
+}
+
+func (r *repository) SaveTicketMessage(ctx context.Context, message models.TicketMessage) error {
+	query, args := sq.Insert("ticket_messages").
+		Columns("ticket_id", "chat_id", "from_admin", "text").
+		Values(message.TicketID, message.ChatID, message.FromAdmin, message.Text).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return errors.Wrap(err, "ExecContext")
+	}
+
+	if !message.FromAdmin {
+		return nil
+	}
+
+	// Первый ответ админа останавливает SLA первого ответа
+	query, args = sq.Update("tickets").
+		Set("first_response_at", sq.Expr("COALESCE(first_response_at, now())")).
+		Where(sq.Eq{"id": message.TicketID}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return errors.Wrap(err, "ExecContext")
+	}
 
 	return nil
 }
 
+func (r *repository) GetTicket(ctx context.Context, ticketID uint64) (*models.Ticket, error) {
+	query, args := sq.Select(ticketColumns...).
+		From("tickets").
+		Where(sq.Eq{"id": ticketID}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var ticket models.Ticket
+
+	if err := r.db.GetContext(ctx, &ticket, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+
+		return nil, errors.Wrap(err, "GetContext")
+	}
+
+	return &ticket, nil
+}
+
+func (r *repository) GetTicketByReference(ctx context.Context, reference string) (*models.Ticket, error) {
+	query, args := sq.Select(ticketColumns...).
+		From("tickets").
+		Where(sq.Eq{"reference": reference}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var ticket models.Ticket
+
+	if err := r.db.GetContext(ctx, &ticket, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+
+		return nil, errors.Wrap(err, "GetContext")
+	}
+
+	return &ticket, nil
+}
+
+// GetActiveTicket возвращает последний незакрытый тикет клиента
+func (r *repository) GetActiveTicket(ctx context.Context, chatID int64) (*models.Ticket, error) {
+	query, args := sq.Select(ticketColumns...).
+		From("tickets").
+		Where(sq.Eq{"chat_id": chatID}).
+		Where(sq.NotEq{"status": []string{models.StatusResolved, models.StatusClosed}}).
+		OrderBy("id DESC").
+		Limit(1).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var ticket models.Ticket
+
+	if err := r.db.GetContext(ctx, &ticket, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+
+		return nil, errors.Wrap(err, "GetContext")
+	}
+
+	return &ticket, nil
+}
+
+// GetClientTickets возвращает тикеты клиента от новых к старым (индекс tickets_chat_id_idx)
+func (r *repository) GetClientTickets(ctx context.Context, chatID int64, offset, limit uint64) ([]models.Ticket, error) {
+	query, args := sq.Select(ticketColumns...).
+		From("tickets").
+		Where(sq.Eq{"chat_id": chatID}).
+		OrderBy("id DESC").
+		Offset(offset).
+		Limit(limit).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var tickets []models.Ticket
+
+	if err := r.db.SelectContext(ctx, &tickets, query, args...); err != nil {
+		return nil, errors.Wrap(err, "SelectContext")
+	}
+
+	return tickets, nil
+}
+
 func (r *repository) SaveAdmins(ctx context.Context, chatIDs []int64, unit string) error {
 	builder := sq.Insert("admins").Columns("chat_id", "unit")
 
@@ -85,3 +410,1025 @@ func (r *repository) GetAdmins(ctx context.Context, unit string) ([]models.Admin
 
 	return admins, nil
 }
+
+// DeleteAdmin удаляет админа подразделения и снимает его с незакрытых тикетов подразделения,
+// чтобы их мог взять кто-то другой. Возвращает такие тикеты
+func (r *repository) DeleteAdmin(ctx context.Context, chatID int64, unit string) ([]models.Ticket, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "BeginTxx")
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query, args := sq.Delete("admins").
+		Where(sq.Eq{"chat_id": chatID, "unit": unit}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "ExecContext")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err, "RowsAffected")
+	}
+
+	if affected == 0 {
+		return nil, models.ErrNotFound
+	}
+
+	query, args = sq.Update("tickets").
+		Set("assignee", nil).
+		Set("assignee_name", "").
+		Set("updated_at", sq.Expr("now()")).
+		Where(sq.Eq{"assignee": chatID, "unit": unit}).
+		Where(sq.NotEq{"status": []string{models.StatusResolved, models.StatusClosed}}).
+		Suffix("RETURNING " + strings.Join(ticketColumns, ", ")).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var released []models.Ticket
+
+	if err = sqlx.SelectContext(ctx, tx, &released, query, args...); err != nil {
+		return nil, errors.Wrap(err, "SelectContext")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "Commit")
+	}
+
+	r.logger.Infof("Deleted admin %d from %s, released %d tickets", chatID, unit, len(released))
+
+	return released, nil
+}
+
+func (r *repository) GetAdminRoles(ctx context.Context, chatID int64) ([]models.Admin, error) {
+	query, args := sq.Select("id", "chat_id", "unit", "role", "name").
+		From("admins").
+		Where(sq.Eq{"chat_id": chatID}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var admins []models.Admin
+
+	if err := r.db.SelectContext(ctx, &admins, query, args...); err != nil {
+		return nil, errors.Wrap(err, "SelectContext")
+	}
+
+	return admins, nil
+}
+
+func (r *repository) GetUnitAdmins(ctx context.Context, unit string) ([]models.Admin, error) {
+	query, args := sq.Select("id", "chat_id", "unit", "role", "name").
+		From("admins").
+		Where(sq.Eq{"unit": unit}).
+		OrderBy("role DESC", "id").
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var admins []models.Admin
+
+	if err := r.db.SelectContext(ctx, &admins, query, args...); err != nil {
+		return nil, errors.Wrap(err, "SelectContext")
+	}
+
+	return admins, nil
+}
+
+func (r *repository) SaveLoginAttempt(ctx context.Context, attempt models.LoginAttempt) error {
+	query, args := sq.Insert("admin_login_attempts").
+		Columns("chat_id", "user_name", "success").
+		Values(attempt.ChatID, attempt.UserName, attempt.Success).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return errors.Wrap(err, "ExecContext")
+	}
+
+	return nil
+}
+
+// GetSupervisorChats возвращает чаты руководителей и владельцев всех подразделений
+// вместе с чатами эскалаций - туда уходят предупреждения безопасности
+func (r *repository) GetSupervisorChats(ctx context.Context) ([]int64, error) {
+	query, args := sq.Select("chat_id").
+		From("admins").
+		Where(sq.Eq{"role": []string{models.RoleSupervisor, models.RoleOwner}}).
+		Suffix("UNION SELECT supervisor_chat_id FROM units WHERE supervisor_chat_id IS NOT NULL").
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var chatIDs []int64
+
+	if err := r.db.SelectContext(ctx, &chatIDs, query, args...); err != nil {
+		return nil, errors.Wrap(err, "SelectContext")
+	}
+
+	return chatIDs, nil
+}
+
+// GetStats считает статистику тикетов подразделений filter.Units, созданных начиная с filter.Since.
+// Время первого ответа и решения берется из отметок first_response_at и resolved_at
+func (r *repository) GetStats(ctx context.Context, filter models.StatsFilter) (*models.Stats, error) {
+	where := sq.And{
+		sq.Eq{"unit": filter.Units},
+		sq.GtOrEq{"created_at": filter.Since},
+	}
+
+	var stats models.Stats
+
+	query, args := sq.Select("status", "COUNT(*) AS count").
+		From("tickets").
+		Where(where).
+		GroupBy("status").
+		OrderBy("status").
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if err := r.db.SelectContext(ctx, &stats.Statuses, query, args...); err != nil {
+		return nil, errors.Wrap(err, "SelectContext")
+	}
+
+	query, args = sq.Select("to_char(date_trunc('day', created_at), 'YYYY-MM-DD') AS day", "COUNT(*) AS count").
+		From("tickets").
+		Where(where).
+		GroupBy("day").
+		OrderBy("day").
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if err := r.db.SelectContext(ctx, &stats.Daily, query, args...); err != nil {
+		return nil, errors.Wrap(err, "SelectContext")
+	}
+
+	query, args = sq.Select(
+		"percentile_cont(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM first_response_at - created_at)) AS median_first_response",
+		"percentile_cont(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM resolved_at - created_at)) AS median_resolution",
+	).
+		From("tickets").
+		Where(where).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if err := r.db.QueryRowxContext(ctx, query, args...).StructScan(&stats); err != nil {
+		return nil, errors.Wrap(err, "QueryRowxContext")
+	}
+
+	// Лучшие агенты - по решенным за период тикетам, когда бы те ни были созданы
+	query, args = sq.Select("assignee_name AS name", "COUNT(*) AS resolved").
+		From("tickets").
+		Where(sq.Eq{"unit": filter.Units}).
+		Where(sq.GtOrEq{"resolved_at": filter.Since}).
+		Where(sq.NotEq{"assignee": nil}).
+		GroupBy("assignee", "assignee_name").
+		OrderBy("resolved DESC", "name").
+		Limit(topAgents).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if err := r.db.SelectContext(ctx, &stats.TopAgents, query, args...); err != nil {
+		return nil, errors.Wrap(err, "SelectContext")
+	}
+
+	return &stats, nil
+}
+
+// CacheStats - статистика считается по тикетам, отдельно хранить нечего
+func (r *repository) CacheStats(_ context.Context, _ models.StatsFilter, _ models.Stats) error {
+	return nil
+}
+
+func (r *repository) GetLanguage(_ context.Context, _ int64) (string, error) {
+	return "", nil
+}
+
+func (r *repository) SetLanguage(_ context.Context, _ int64, _ string) error {
+	return nil
+}
+
+func (r *repository) DetectLanguage(_ context.Context, _ int64, _ string) error {
+	return nil
+}
+
+func (r *repository) SaveCannedResponse(ctx context.Context, response models.CannedResponse) (uint64, error) {
+	query, args := sq.Insert("canned_responses").
+		Columns("unit", "title", "text").
+		Values(response.Unit, response.Title, response.Text).
+		Suffix("RETURNING id").
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var id uint64
+
+	if err := r.db.QueryRowxContext(ctx, query, args...).Scan(&id); err != nil {
+		return 0, errors.Wrap(err, "QueryRowxContext")
+	}
+
+	return id, nil
+}
+
+func (r *repository) UpdateCannedResponse(ctx context.Context, response models.CannedResponse) error {
+	query, args := sq.Update("canned_responses").
+		Set("title", response.Title).
+		Set("text", response.Text).
+		Where(sq.Eq{"id": response.ID}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext")
+	}
+
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteCannedResponse(ctx context.Context, responseID uint64) error {
+	query, args := sq.Delete("canned_responses").
+		Where(sq.Eq{"id": responseID}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext")
+	}
+
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) UseCannedResponse(ctx context.Context, responseID uint64) error {
+	query, args := sq.Update("canned_responses").
+		Set("uses", sq.Expr("uses + 1")).
+		Where(sq.Eq{"id": responseID}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return errors.Wrap(err, "ExecContext")
+	}
+
+	return nil
+}
+
+func (r *repository) GetCannedResponse(ctx context.Context, responseID uint64) (*models.CannedResponse, error) {
+	query, args := sq.Select("id", "unit", "title", "text", "uses").
+		From("canned_responses").
+		Where(sq.Eq{"id": responseID}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var response models.CannedResponse
+
+	if err := r.db.GetContext(ctx, &response, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+
+		return nil, errors.Wrap(err, "GetContext")
+	}
+
+	return &response, nil
+}
+
+// GetCannedResponses возвращает шаблоны подразделения, самые используемые первыми
+func (r *repository) GetCannedResponses(ctx context.Context, unit string, offset, limit uint64) ([]models.CannedResponse, error) {
+	query, args := sq.Select("id", "unit", "title", "text", "uses").
+		From("canned_responses").
+		Where(sq.Eq{"unit": unit}).
+		OrderBy("uses DESC", "id").
+		Offset(offset).
+		Limit(limit).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var responses []models.CannedResponse
+
+	if err := r.db.SelectContext(ctx, &responses, query, args...); err != nil {
+		return nil, errors.Wrap(err, "SelectContext")
+	}
+
+	return responses, nil
+}
+
+func (r *repository) GetTicketSLA(ctx context.Context, ticketID uint64) (*models.TicketSLA, error) {
+	columns := make([]string, 0, len(ticketColumns))
+	for _, v := range ticketColumns {
+		columns = append(columns, "t."+v)
+	}
+
+	query, args := sq.Select(columns...).
+		Columns(
+			"t.created_at", "t.sla_started_at", "t.first_response_at", "t.sla_paused_at", "t.sla_paused_seconds",
+			"t.first_response_escalated", "t.resolution_escalated",
+			"COALESCE(st.first_response_minutes, sd.first_response_minutes) AS first_response_minutes",
+			"COALESCE(st.resolution_minutes, sd.resolution_minutes) AS resolution_minutes",
+			"u.supervisor_chat_id",
+		).
+		From("tickets t").
+		Join("units u ON u.name = t.unit").
+		Join("sla_defaults sd ON sd.priority = t.priority").
+		LeftJoin("sla_targets st ON st.unit = t.unit AND st.priority = t.priority").
+		Where(sq.Eq{"t.id": ticketID}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var ticket models.TicketSLA
+
+	if err := r.db.GetContext(ctx, &ticket, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+
+		return nil, errors.Wrap(err, "GetContext")
+	}
+
+	return &ticket, nil
+}
+
+// EscalateTicket помечает нарушение SLA вида kind, true - если пометили мы,
+// так эскалация уходит один раз даже при нескольких репликах
+func (r *repository) EscalateTicket(ctx context.Context, ticketID uint64, kind string) (bool, error) {
+	column := escalationColumn(kind)
+
+	query, args := sq.Update("tickets").
+		Set(column, true).
+		Where(sq.Eq{"id": ticketID, column: false}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, errors.Wrap(err, "ExecContext")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "RowsAffected")
+	}
+
+	return affected > 0, nil
+}
+
+// ResetEscalation снимает пометку EscalateTicket, если эскалацию не удалось отправить:
+// следующая проверка SLA отправит ее снова
+func (r *repository) ResetEscalation(ctx context.Context, ticketID uint64, kind string) error {
+	query, args := sq.Update("tickets").
+		Set(escalationColumn(kind), false).
+		Where(sq.Eq{"id": ticketID}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return errors.Wrap(err, "ExecContext")
+	}
+
+	return nil
+}
+
+// escalationColumn - колонка пометки эскалации нарушения SLA вида kind
+func escalationColumn(kind string) string {
+	if kind == models.SLAFirstResponse {
+		return "first_response_escalated"
+	}
+
+	return "resolution_escalated"
+}
+
+func (r *repository) SetUnitSupervisor(ctx context.Context, unit string, chatID int64) error {
+	query, args := sq.Update("units").
+		Set("supervisor_chat_id", chatID).
+		Where(sq.Eq{"name": unit}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	return r.execUnit(ctx, query, args)
+}
+
+// GetUnits возвращает подразделения в порядке показа, onlyActive - только доступные клиентам
+func (r *repository) GetUnits(ctx context.Context, onlyActive bool) ([]models.Unit, error) {
+	builder := sq.Select(unitColumns...).
+		From("units").
+		OrderBy("position", "name")
+
+	if onlyActive {
+		builder = builder.Where(sq.Eq{"active": true})
+	}
+
+	query, args := builder.PlaceholderFormat(sq.Dollar).MustSql()
+
+	var units []models.Unit
+
+	if err := r.db.SelectContext(ctx, &units, query, args...); err != nil {
+		return nil, errors.Wrap(err, "SelectContext")
+	}
+
+	return units, nil
+}
+
+func (r *repository) GetUnit(ctx context.Context, name string) (*models.Unit, error) {
+	query, args := sq.Select(unitColumns...).
+		From("units").
+		Where(sq.Eq{"name": name}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var unit models.Unit
+
+	if err := r.db.GetContext(ctx, &unit, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+
+		return nil, errors.Wrap(err, "GetContext")
+	}
+
+	return &unit, nil
+}
+
+// SaveUnit добавляет подразделение в конец списка
+func (r *repository) SaveUnit(ctx context.Context, unit models.Unit) error {
+	query, args := sq.Insert("units").
+		Columns("name", "prefix", "description", "position").
+		Values(unit.Name, unit.Prefix, unit.Description, sq.Expr("(SELECT COALESCE(MAX(position), 0) + 1 FROM units)")).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return models.ErrAlreadyExists
+		}
+
+		return errors.Wrap(err, "ExecContext")
+	}
+
+	return nil
+}
+
+// RenameUnit переименовывает подразделение, тикеты, админы и шаблоны
+// переезжают за ним по ON UPDATE CASCADE
+func (r *repository) RenameUnit(ctx context.Context, name string, newName string) error {
+	query, args := sq.Update("units").
+		Set("name", newName).
+		Where(sq.Eq{"name": name}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	return r.execUnit(ctx, query, args)
+}
+
+// SetUnitActive скрывает подразделение из выбора при создании заявки,
+// старые тикеты и админы подразделения остаются
+func (r *repository) SetUnitActive(ctx context.Context, name string, active bool) error {
+	query, args := sq.Update("units").
+		Set("active", active).
+		Where(sq.Eq{"name": name}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	return r.execUnit(ctx, query, args)
+}
+
+// SetUnitName задает название подразделения для клиентов на языке lang, пустое - убирает его.
+// Ключ подразделения не меняется
+func (r *repository) SetUnitName(ctx context.Context, unit string, lang string, name string) error {
+	names := sq.Expr("names || jsonb_build_object(?::text, ?::text)", lang, name)
+	if name == "" {
+		names = sq.Expr("names - ?::text", lang)
+	}
+
+	query, args := sq.Update("units").
+		Set("names", names).
+		Where(sq.Eq{"name": unit}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	return r.execUnit(ctx, query, args)
+}
+
+// GetUnitSchedule возвращает расписание подразделения, часы работы - в секундах от полуночи
+func (r *repository) GetUnitSchedule(ctx context.Context, unit string) (*models.UnitSchedule, error) {
+	query, args := sq.Select("name", "timezone", "off_hours_reply").
+		From("units").
+		Where(sq.Eq{"name": unit}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var unitSchedule models.UnitSchedule
+
+	if err := r.db.GetContext(ctx, &unitSchedule, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+
+		return nil, errors.Wrap(err, "GetContext")
+	}
+
+	query, args = sq.Select(
+		"weekday",
+		"EXTRACT(EPOCH FROM opens_at)::int AS opens_at",
+		"EXTRACT(EPOCH FROM closes_at)::int AS closes_at",
+	).
+		From("unit_hours").
+		Where(sq.Eq{"unit": unit}).
+		OrderBy("weekday").
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if err := r.db.SelectContext(ctx, &unitSchedule.Hours, query, args...); err != nil {
+		return nil, errors.Wrap(err, "SelectContext")
+	}
+
+	// Прошедшие праздники расписанию уже не нужны
+	query, args = sq.Select("to_char(day, 'YYYY-MM-DD')").
+		From("unit_holidays").
+		Where(sq.Eq{"unit": unit}).
+		Where(sq.Expr("day >= CURRENT_DATE - 1")).
+		OrderBy("day").
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if err := r.db.SelectContext(ctx, &unitSchedule.Holidays, query, args...); err != nil {
+		return nil, errors.Wrap(err, "SelectContext")
+	}
+
+	return &unitSchedule, nil
+}
+
+// SetUnitHours заменяет недельное расписание подразделения целиком,
+// пустое hours - подразделение работает круглосуточно
+func (r *repository) SetUnitHours(ctx context.Context, unit string, timezone string, hours []models.UnitHours) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "BeginTxx")
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query, args := sq.Update("units").
+		Set("timezone", timezone).
+		Where(sq.Eq{"name": unit}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "RowsAffected")
+	}
+
+	if affected == 0 {
+		return models.ErrNotFound
+	}
+
+	query, args = sq.Delete("unit_hours").
+		Where(sq.Eq{"unit": unit}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+		return errors.Wrap(err, "ExecContext")
+	}
+
+	if len(hours) > 0 {
+		builder := sq.Insert("unit_hours").
+			Columns("unit", "weekday", "opens_at", "closes_at")
+
+		for _, v := range hours {
+			builder = builder.Values(unit, v.Weekday, clock(v.OpensAt), clock(v.ClosesAt))
+		}
+
+		query, args = builder.PlaceholderFormat(sq.Dollar).MustSql()
+
+		if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+			return errors.Wrap(err, "ExecContext")
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "Commit")
+	}
+
+	return nil
+}
+
+// clock переводит секунды от полуночи в TIME, 24:00 postgres тоже принимает
+func clock(seconds int) string {
+	return fmt.Sprintf("%02d:%02d", seconds/3600, seconds%3600/60)
+}
+
+func (r *repository) SaveHoliday(ctx context.Context, unit string, day string) error {
+	query, args := sq.Insert("unit_holidays").
+		Columns("unit", "day").
+		Values(unit, day).
+		Suffix("ON CONFLICT DO NOTHING").
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+			return models.ErrNotFound
+		}
+
+		return errors.Wrap(err, "ExecContext")
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteHoliday(ctx context.Context, unit string, day string) error {
+	query, args := sq.Delete("unit_holidays").
+		Where(sq.Eq{"unit": unit, "day": day}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	return r.execUnit(ctx, query, args)
+}
+
+func (r *repository) SetOffHoursReply(ctx context.Context, unit string, text string) error {
+	query, args := sq.Update("units").
+		Set("off_hours_reply", text).
+		Where(sq.Eq{"name": unit}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	return r.execUnit(ctx, query, args)
+}
+
+func (r *repository) GetUnitRouting(ctx context.Context, unit string) (*models.UnitRouting, error) {
+	query, args := sq.Select("name", "routing", "claim_timeout_minutes").
+		From("units").
+		Where(sq.Eq{"name": unit}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var routing models.UnitRouting
+
+	if err := r.db.GetContext(ctx, &routing, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+
+		return nil, errors.Wrap(err, "GetContext")
+	}
+
+	return &routing, nil
+}
+
+func (r *repository) SetUnitRouting(ctx context.Context, routing models.UnitRouting) error {
+	query, args := sq.Update("units").
+		Set("routing", routing.Strategy).
+		Set("claim_timeout_minutes", routing.ClaimTimeout).
+		Where(sq.Eq{"name": routing.Unit}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	return r.execUnit(ctx, query, args)
+}
+
+// GetUnitFields возвращает дополнительные поля опроса подразделения в порядке опроса
+func (r *repository) GetUnitFields(ctx context.Context, unit string) ([]models.UnitField, error) {
+	query, args := sq.Select(
+		"id", "unit", "key", "label", "type", "required", "options", "min_value", "max_value", "pattern",
+	).
+		From("unit_fields").
+		Where(sq.Eq{"unit": unit}).
+		OrderBy("position", "id").
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var fields []models.UnitField
+
+	if err := r.db.SelectContext(ctx, &fields, query, args...); err != nil {
+		return nil, errors.Wrap(err, "SelectContext")
+	}
+
+	return fields, nil
+}
+
+// SaveUnitField добавляет поле в конец опроса подразделения
+func (r *repository) SaveUnitField(ctx context.Context, field models.UnitField) error {
+	options := field.Options
+	if options == nil {
+		options = pq.StringArray{}
+	}
+
+	query, args := sq.Insert("unit_fields").
+		Columns("unit", "key", "label", "type", "required", "options", "min_value", "max_value", "pattern", "position").
+		Values(
+			field.Unit, field.Key, field.Label, field.Type, field.Required, options, field.Min, field.Max, field.Pattern,
+			sq.Expr("(SELECT COALESCE(MAX(position), 0) + 1 FROM unit_fields WHERE unit = ?)", field.Unit),
+		).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			switch pqErr.Code {
+			case foreignKeyViolation:
+				return models.ErrNotFound
+			case uniqueViolation:
+				return models.ErrAlreadyExists
+			}
+		}
+
+		return errors.Wrap(err, "ExecContext")
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteUnitField(ctx context.Context, unit string, key string) error {
+	query, args := sq.Delete("unit_fields").
+		Where(sq.Eq{"unit": unit, "key": key}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	return r.execUnit(ctx, query, args)
+}
+
+// GetAssigneeLoads считает незакрытые тикеты подразделения по исполнителям,
+// исполнителей без тикетов в результате нет
+func (r *repository) GetAssigneeLoads(ctx context.Context, unit string) ([]models.AssigneeLoad, error) {
+	query, args := sq.Select("assignee", "COUNT(*) AS open").
+		From("tickets").
+		Where(sq.Eq{"unit": unit}).
+		Where(sq.NotEq{"assignee": nil}).
+		Where(sq.NotEq{"status": []string{models.StatusResolved, models.StatusClosed}}).
+		GroupBy("assignee").
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var loads []models.AssigneeLoad
+
+	if err := r.db.SelectContext(ctx, &loads, query, args...); err != nil {
+		return nil, errors.Wrap(err, "SelectContext")
+	}
+
+	return loads, nil
+}
+
+func (r *repository) GetUnitGroup(ctx context.Context, unit string) (*models.UnitGroup, error) {
+	query, args := sq.Select("name", "group_chat_id", "group_topics").
+		From("units").
+		Where(sq.Eq{"name": unit}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var group models.UnitGroup
+
+	if err := r.db.GetContext(ctx, &group, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+
+		return nil, errors.Wrap(err, "GetContext")
+	}
+
+	return &group, nil
+}
+
+// SetUnitGroup привязывает подразделение к группе, ChatID nil - отвязывает
+func (r *repository) SetUnitGroup(ctx context.Context, group models.UnitGroup) error {
+	query, args := sq.Update("units").
+		Set("group_chat_id", group.ChatID).
+		Set("group_topics", group.Topics).
+		Where(sq.Eq{"name": group.Unit}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	return r.execUnit(ctx, query, args)
+}
+
+func (r *repository) SaveTicketTopic(ctx context.Context, topic models.TicketTopic) error {
+	query, args := sq.Insert("ticket_topics").
+		Columns("ticket_id", "chat_id", "thread_id").
+		Values(topic.TicketID, topic.ChatID, topic.ThreadID).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return models.ErrAlreadyExists
+		}
+
+		return errors.Wrap(err, "ExecContext")
+	}
+
+	return nil
+}
+
+func (r *repository) GetTicketTopic(ctx context.Context, ticketID uint64) (*models.TicketTopic, error) {
+	query, args := sq.Select("ticket_id", "chat_id", "thread_id").
+		From("ticket_topics").
+		Where(sq.Eq{"ticket_id": ticketID}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var topic models.TicketTopic
+
+	if err := r.db.GetContext(ctx, &topic, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+
+		return nil, errors.Wrap(err, "GetContext")
+	}
+
+	return &topic, nil
+}
+
+// GetTopicTicket ищет тикет по теме форума, в которую пишет админ
+func (r *repository) GetTopicTicket(ctx context.Context, chatID int64, threadID int) (*models.Ticket, error) {
+	query, args := sq.Select(ticketColumns...).
+		From("tickets").
+		Where(sq.Expr("id = (SELECT ticket_id FROM ticket_topics WHERE chat_id = ? AND thread_id = ?)", chatID, threadID)).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var ticket models.Ticket
+
+	if err := r.db.GetContext(ctx, &ticket, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+
+		return nil, errors.Wrap(err, "GetContext")
+	}
+
+	return &ticket, nil
+}
+
+// execUnit выполняет изменение одного подразделения
+func (r *repository) execUnit(ctx context.Context, query string, args []interface{}) error {
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return models.ErrAlreadyExists
+		}
+
+		return errors.Wrap(err, "ExecContext")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "RowsAffected")
+	}
+
+	if affected == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) GetAdminRole(ctx context.Context, chatID int64, unit string) (string, error) {
+	query, args := sq.Select("role").
+		From("admins").
+		Where(sq.Eq{"chat_id": chatID, "unit": unit}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var role string
+
+	if err := r.db.GetContext(ctx, &role, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", models.ErrNotFound
+		}
+
+		return "", errors.Wrap(err, "GetContext")
+	}
+
+	return role, nil
+}
+
+func (r *repository) GetAdminsByRole(ctx context.Context, unit string, role string) ([]models.Admin, error) {
+	query, args := sq.Select("id", "chat_id", "unit", "role").
+		From("admins").
+		Where(sq.Eq{"unit": unit, "role": role}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var admins []models.Admin
+
+	if err := r.db.SelectContext(ctx, &admins, query, args...); err != nil {
+		return nil, errors.Wrap(err, "SelectContext")
+	}
+
+	return admins, nil
+}
+
+func (r *repository) SetAdminRole(ctx context.Context, chatID int64, unit string, role string) error {
+	query, args := sq.Update("admins").
+		Set("role", role).
+		Where(sq.Eq{"chat_id": chatID, "unit": unit}).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "RowsAffected")
+	}
+
+	if affected == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) SaveInvite(ctx context.Context, invite models.Invite) error {
+	query, args := sq.Insert("admin_invites").
+		Columns("token_hash", "unit", "role", "created_by", "expires_at").
+		Values(invite.TokenHash, invite.Unit, invite.Role, invite.CreatedBy, invite.ExpiresAt).
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return errors.Wrap(err, "ExecContext")
+	}
+
+	return nil
+}
+
+// RedeemInvite гасит приглашение и добавляет chatID в админы подразделения одной транзакцией.
+// Просроченное, использованное или неизвестное приглашение - ErrNotFound
+func (r *repository) RedeemInvite(ctx context.Context, tokenHash string, chatID int64, name string) (*models.Invite, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "BeginTxx")
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query, args := sq.Update("admin_invites").
+		Set("used_by", chatID).
+		Set("used_at", sq.Expr("now()")).
+		Where(sq.Eq{"token_hash": tokenHash, "used_at": nil}).
+		Where(sq.Expr("expires_at > now()")).
+		Suffix("RETURNING token_hash, unit, role, created_by, expires_at").
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	var invite models.Invite
+
+	if err = tx.QueryRowxContext(ctx, query, args...).StructScan(&invite); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+
+		return nil, errors.Wrap(err, "QueryRowxContext")
+	}
+
+	// Приглашение не понижает роль тех, кто уже состоит в подразделении
+	query, args = sq.Insert("admins").
+		Columns("chat_id", "unit", "role", "name").
+		Values(chatID, invite.Unit, invite.Role, name).
+		Suffix("ON CONFLICT (chat_id, unit) DO UPDATE SET role = GREATEST(admins.role, EXCLUDED.role), name = EXCLUDED.name").
+		PlaceholderFormat(sq.Dollar).
+		MustSql()
+
+	if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, errors.Wrap(err, "ExecContext")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "Commit")
+	}
+
+	r.logger.Infof("Invite to %s redeemed by %d", invite.Unit, chatID)
+
+	return &invite, nil
+}
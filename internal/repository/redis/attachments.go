@@ -0,0 +1,111 @@
+package redis
+
+import (
+	"context"
+	"github.com/goddeuce1/tg_bot_tz/internal/tickets/models"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+const (
+	draftAttachmentsPrefix = "attachments:"
+	mediaGroupPrefix       = "media_group:"
+
+	// Части альбома приходят отдельными апдейтами почти одновременно,
+	// минуты хватает, чтобы все они нашли, за кем закреплен альбом
+	mediaGroupTTL = time.Minute
+)
+
+// Части альбома приходят отдельными апдейтами и обрабатываются параллельно,
+// поэтому вложения черновика храним списком, а не в ChatData
+
+func (r *repository) AddDraftAttachment(ctx context.Context, chatID int64, attachment models.Attachment) (int64, error) {
+	key := draftAttachmentsPrefix + strconv.Itoa(int(chatID))
+
+	value, err := jsoniter.MarshalToString(attachment)
+	if err != nil {
+		return 0, errors.Wrap(err, "MarshalToString")
+	}
+
+	pipe := r.db.TxPipeline()
+
+	// Вложения - часть черновика и живут столько же
+	count := pipe.RPush(ctx, key, value)
+	pipe.Expire(ctx, key, r.draftTTL)
+
+	if _, err = pipe.Exec(ctx); err != nil {
+		return 0, errors.Wrap(err, "Exec")
+	}
+
+	return count.Val(), nil
+}
+
+func (r *repository) GetDraftAttachments(ctx context.Context, chatID int64) ([]models.Attachment, error) {
+	key := draftAttachmentsPrefix + strconv.Itoa(int(chatID))
+
+	values, err := r.db.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "LRange")
+	}
+
+	attachments := make([]models.Attachment, 0, len(values))
+	for _, v := range values {
+		var attachment models.Attachment
+		if err = jsoniter.UnmarshalFromString(v, &attachment); err != nil {
+			return nil, errors.Wrap(err, "UnmarshalFromString")
+		}
+
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, nil
+}
+
+func (r *repository) ClearDraftAttachments(ctx context.Context, chatID int64) error {
+	key := draftAttachmentsPrefix + strconv.Itoa(int(chatID))
+
+	if err := r.db.Del(ctx, key).Err(); err != nil {
+		return errors.Wrap(err, "Del")
+	}
+
+	return nil
+}
+
+// ClaimMediaGroup закрепляет альбом за target (черновик или номер тикета).
+// Возвращает target, за которым альбом закреплен, и true, если закрепили мы
+func (r *repository) ClaimMediaGroup(ctx context.Context, mediaGroupID string, target string) (string, bool, error) {
+	key := mediaGroupPrefix + mediaGroupID
+
+	ok, err := r.db.SetNX(ctx, key, target, mediaGroupTTL).Result()
+	if err != nil {
+		return "", false, errors.Wrap(err, "SetNX")
+	}
+
+	if ok {
+		return target, true, nil
+	}
+
+	claimed, err := r.db.Get(ctx, key).Result()
+	if err != nil {
+		return "", false, errors.Wrap(err, "Get")
+	}
+
+	return claimed, false, nil
+}
+
+// GetMediaGroup возвращает target альбома или пустую строку, если альбом еще не закреплен
+func (r *repository) GetMediaGroup(ctx context.Context, mediaGroupID string) (string, error) {
+	claimed, err := r.db.Get(ctx, mediaGroupPrefix+mediaGroupID).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", nil
+		}
+
+		return "", errors.Wrap(err, "Get")
+	}
+
+	return claimed, nil
+}
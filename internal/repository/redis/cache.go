@@ -5,20 +5,88 @@ import (
 	"github.com/goddeuce1/tg_bot_tz/internal/repository/models"
 	"github.com/pkg/errors"
 	"strconv"
+	"time"
 )
 
-func (r *repository) SaveTicket(_ context.Context, _ models.Ticket) error {
+func (r *repository) NextTicketReference(_ context.Context, _ string) (string, error) {
+	return "", nil
+}
+
+func (r *repository) SaveTicket(_ context.Context, _ models.Ticket) (uint64, error) {
+	return 0, nil
+}
+
+func (r *repository) UpdateTicketStatus(_ context.Context, _ uint64, _ string) (*models.Ticket, error) {
+	return nil, nil
+}
+
+func (r *repository) AssignTicket(_ context.Context, _ uint64, _ int64, _ string) (*models.Ticket, error) {
+	return nil, nil
+}
+
+func (r *repository) ReassignTicket(_ context.Context, _ uint64, _ *int64, _ string) (*models.Ticket, error) {
+	return nil, nil
+}
+
+func (r *repository) SaveAttachments(_ context.Context, _ []models.Attachment) error {
+	return nil
+}
+
+func (r *repository) SaveNotification(_ context.Context, _ models.Notification) error {
+	return nil
+}
+
+func (r *repository) GetAttachments(_ context.Context, _ uint64) ([]models.Attachment, error) {
+	return nil, nil
+}
+
+func (r *repository) GetNotifications(_ context.Context, _ uint64) ([]models.Notification, error) {
+	return nil, nil
+}
+
+func (r *repository) SaveTicketMessage(_ context.Context, _ models.TicketMessage) error {
 	return nil
 }
 
+func (r *repository) GetTicket(_ context.Context, _ uint64) (*models.Ticket, error) {
+	return nil, nil
+}
+
+func (r *repository) GetTicketByReference(_ context.Context, _ string) (*models.Ticket, error) {
+	return nil, nil
+}
+
+func (r *repository) GetActiveTicket(_ context.Context, _ int64) (*models.Ticket, error) {
+	return nil, nil
+}
+
+func (r *repository) GetClientTickets(_ context.Context, _ int64, _, _ uint64) ([]models.Ticket, error) {
+	return nil, nil
+}
+
+// Админов подразделения храним множеством: повторное заполнение кеша не плодит дубли.
+// Кеш живет adminsTTL, после этого список снова читается из базы
+const (
+	adminsPrefix = "admins:"
+	adminsTTL    = time.Minute
+)
+
 func (r *repository) SaveAdmins(ctx context.Context, chatIDs []int64, unit string) error {
-	pipe := r.db.TxPipeline()
+	if len(chatIDs) == 0 {
+		return nil
+	}
 
+	key := adminsPrefix + unit
+
+	members := make([]interface{}, 0, len(chatIDs))
 	for _, v := range chatIDs {
-		pipe.LPush(ctx, unit, v)
+		members = append(members, v)
 	}
 
-	pipe.Expire(ctx, unit, r.ttl)
+	pipe := r.db.TxPipeline()
+
+	pipe.SAdd(ctx, key, members...)
+	pipe.Expire(ctx, key, adminsTTL)
 
 	if _, err := pipe.Exec(ctx); err != nil {
 		return errors.Wrap(err, "Exec")
@@ -28,9 +96,9 @@ func (r *repository) SaveAdmins(ctx context.Context, chatIDs []int64, unit strin
 }
 
 func (r *repository) GetAdmins(ctx context.Context, unit string) ([]models.Admin, error) {
-	admins, err := r.db.LRange(ctx, unit, 0, -1).Result()
+	admins, err := r.db.SMembers(ctx, adminsPrefix+unit).Result()
 	if err != nil {
-		return nil, errors.Wrap(err, "LRange")
+		return nil, errors.Wrap(err, "SMembers")
 	}
 
 	response := make([]models.Admin, 0)
@@ -50,3 +118,176 @@ func (r *repository) GetAdmins(ctx context.Context, unit string) ([]models.Admin
 
 	return response, nil
 }
+
+// DeleteAdmin сбрасывает кеш подразделения целиком, следующий GetAdmins перечитает его из постгри
+func (r *repository) DeleteAdmin(ctx context.Context, _ int64, unit string) ([]models.Ticket, error) {
+	if err := r.db.Del(ctx, adminsPrefix+unit).Err(); err != nil {
+		return nil, errors.Wrap(err, "Del")
+	}
+
+	return nil, nil
+}
+
+func (r *repository) GetAdminRoles(_ context.Context, _ int64) ([]models.Admin, error) {
+	return nil, nil
+}
+
+func (r *repository) GetUnitAdmins(_ context.Context, _ string) ([]models.Admin, error) {
+	return nil, nil
+}
+
+func (r *repository) SaveLoginAttempt(_ context.Context, _ models.LoginAttempt) error {
+	return nil
+}
+
+func (r *repository) GetSupervisorChats(_ context.Context) ([]int64, error) {
+	return nil, nil
+}
+
+func (r *repository) SaveCannedResponse(_ context.Context, _ models.CannedResponse) (uint64, error) {
+	return 0, nil
+}
+
+func (r *repository) UpdateCannedResponse(_ context.Context, _ models.CannedResponse) error {
+	return nil
+}
+
+func (r *repository) DeleteCannedResponse(_ context.Context, _ uint64) error {
+	return nil
+}
+
+func (r *repository) UseCannedResponse(_ context.Context, _ uint64) error {
+	return nil
+}
+
+func (r *repository) GetCannedResponse(_ context.Context, _ uint64) (*models.CannedResponse, error) {
+	return nil, nil
+}
+
+func (r *repository) GetCannedResponses(_ context.Context, _ string, _, _ uint64) ([]models.CannedResponse, error) {
+	return nil, nil
+}
+
+func (r *repository) GetTicketSLA(_ context.Context, _ uint64) (*models.TicketSLA, error) {
+	return nil, nil
+}
+
+func (r *repository) EscalateTicket(_ context.Context, _ uint64, _ string) (bool, error) {
+	return false, nil
+}
+
+func (r *repository) ResetEscalation(_ context.Context, _ uint64, _ string) error {
+	return nil
+}
+
+func (r *repository) SetUnitSupervisor(_ context.Context, _ string, _ int64) error {
+	return nil
+}
+
+func (r *repository) GetUnits(_ context.Context, _ bool) ([]models.Unit, error) {
+	return nil, nil
+}
+
+func (r *repository) GetUnit(_ context.Context, _ string) (*models.Unit, error) {
+	return nil, nil
+}
+
+func (r *repository) SaveUnit(_ context.Context, _ models.Unit) error {
+	return nil
+}
+
+func (r *repository) RenameUnit(_ context.Context, _ string, _ string) error {
+	return nil
+}
+
+func (r *repository) SetUnitActive(_ context.Context, _ string, _ bool) error {
+	return nil
+}
+
+func (r *repository) SetUnitName(_ context.Context, _ string, _ string, _ string) error {
+	return nil
+}
+
+func (r *repository) GetUnitSchedule(_ context.Context, _ string) (*models.UnitSchedule, error) {
+	return nil, nil
+}
+
+func (r *repository) SetUnitHours(_ context.Context, _ string, _ string, _ []models.UnitHours) error {
+	return nil
+}
+
+func (r *repository) SaveHoliday(_ context.Context, _ string, _ string) error {
+	return nil
+}
+
+func (r *repository) DeleteHoliday(_ context.Context, _ string, _ string) error {
+	return nil
+}
+
+func (r *repository) SetOffHoursReply(_ context.Context, _ string, _ string) error {
+	return nil
+}
+
+func (r *repository) GetUnitRouting(_ context.Context, _ string) (*models.UnitRouting, error) {
+	return nil, nil
+}
+
+func (r *repository) SetUnitRouting(_ context.Context, _ models.UnitRouting) error {
+	return nil
+}
+
+func (r *repository) GetAssigneeLoads(_ context.Context, _ string) ([]models.AssigneeLoad, error) {
+	return nil, nil
+}
+
+func (r *repository) GetUnitFields(_ context.Context, _ string) ([]models.UnitField, error) {
+	return nil, nil
+}
+
+func (r *repository) SaveUnitField(_ context.Context, _ models.UnitField) error {
+	return nil
+}
+
+func (r *repository) DeleteUnitField(_ context.Context, _ string, _ string) error {
+	return nil
+}
+
+func (r *repository) GetUnitGroup(_ context.Context, _ string) (*models.UnitGroup, error) {
+	return nil, nil
+}
+
+func (r *repository) SetUnitGroup(_ context.Context, _ models.UnitGroup) error {
+	return nil
+}
+
+func (r *repository) SaveTicketTopic(_ context.Context, _ models.TicketTopic) error {
+	return nil
+}
+
+func (r *repository) GetTicketTopic(_ context.Context, _ uint64) (*models.TicketTopic, error) {
+	return nil, nil
+}
+
+func (r *repository) GetTopicTicket(_ context.Context, _ int64, _ int) (*models.Ticket, error) {
+	return nil, nil
+}
+
+func (r *repository) GetAdminRole(_ context.Context, _ int64, _ string) (string, error) {
+	return "", nil
+}
+
+func (r *repository) GetAdminsByRole(_ context.Context, _ string, _ string) ([]models.Admin, error) {
+	return nil, nil
+}
+
+func (r *repository) SetAdminRole(_ context.Context, _ int64, _ string, _ string) error {
+	return nil
+}
+
+func (r *repository) SaveInvite(_ context.Context, _ models.Invite) error {
+	return nil
+}
+
+func (r *repository) RedeemInvite(_ context.Context, _ string, _ int64, _ string) (*models.Invite, error) {
+	return nil, nil
+}
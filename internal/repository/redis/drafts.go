@@ -0,0 +1,99 @@
+package redis
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+const (
+	draftPrefix       = "draft:"
+	draftRemindersKey = "draft_reminders"
+)
+
+// Draft - черновик заявки: копия состояния опроса, которая переживает его срок
+type Draft struct {
+	ChatData
+	// Сколько черновику осталось жить
+	ExpiresIn time.Duration
+}
+
+// SaveDraft сохраняет черновик на draftTTL и переносит напоминание о нем.
+// Вложения черновика продлеваются вместе с ним
+func (r *repository) SaveDraft(ctx context.Context, chatID int64, data ChatData) error {
+	id := strconv.Itoa(int(chatID))
+	key := draftPrefix + id
+
+	pipe := r.db.TxPipeline()
+
+	pipe.HSet(ctx, key, data)
+	pipe.Expire(ctx, key, r.draftTTL)
+	pipe.Expire(ctx, draftAttachmentsPrefix+id, r.draftTTL)
+	pipe.ZAdd(ctx, draftRemindersKey, redis.Z{
+		Score:  float64(time.Now().Add(r.draftTTL - r.draftReminder).Unix()),
+		Member: id,
+	})
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return errors.Wrap(err, "Exec")
+	}
+
+	return nil
+}
+
+// GetDraft возвращает черновик чата, пустой State - черновика нет
+func (r *repository) GetDraft(ctx context.Context, chatID int64) (*Draft, error) {
+	key := draftPrefix + strconv.Itoa(int(chatID))
+
+	data, err := r.getChatData(ctx, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "getChatData")
+	}
+
+	ttl, err := r.db.PTTL(ctx, key).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "PTTL")
+	}
+
+	return &Draft{
+		ChatData:  *data,
+		ExpiresIn: max(ttl, 0),
+	}, nil
+}
+
+func (r *repository) DeleteDraft(ctx context.Context, chatID int64) error {
+	id := strconv.Itoa(int(chatID))
+
+	pipe := r.db.TxPipeline()
+
+	pipe.Del(ctx, draftPrefix+id)
+	pipe.ZRem(ctx, draftRemindersKey, id)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return errors.Wrap(err, "Exec")
+	}
+
+	return nil
+}
+
+// PopDueDraftReminders забирает чаты, черновикам которых пора напомнить о сроке
+func (r *repository) PopDueDraftReminders(ctx context.Context, now time.Time) ([]int64, error) {
+	members, err := r.popDueMembers(ctx, draftRemindersKey, now)
+	if err != nil {
+		return nil, errors.Wrap(err, "popDueMembers")
+	}
+
+	chatIDs := make([]int64, 0, len(members))
+	for _, v := range members {
+		chatID, errParse := strconv.ParseInt(v, 10, 64)
+		if errParse != nil {
+			return nil, errors.Wrap(errParse, "strconv.ParseInt")
+		}
+
+		chatIDs = append(chatIDs, chatID)
+	}
+
+	return chatIDs, nil
+}
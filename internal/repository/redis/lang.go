@@ -0,0 +1,64 @@
+package redis
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+)
+
+// Язык чата хранится рядом с состоянием, без срока: выбранный в /lang
+// и язык телеграма из первого сообщения. Выбранный важнее
+const (
+	langPrefix   = "lang:"
+	langSelected = "selected"
+	langDetected = "detected"
+)
+
+// GetLanguage возвращает язык чата, пусто - язык неизвестен
+func (r *repository) GetLanguage(ctx context.Context, chatID int64) (string, error) {
+	values, err := r.db.HMGet(ctx, langPrefix+strconv.Itoa(int(chatID)), langSelected, langDetected).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "", errors.Wrap(err, "HMGet")
+	}
+
+	for _, v := range values {
+		if lang, ok := v.(string); ok && lang != "" {
+			return lang, nil
+		}
+	}
+
+	return "", nil
+}
+
+// SetLanguage запоминает язык, выбранный в /lang, пусто - снова язык телеграма
+func (r *repository) SetLanguage(ctx context.Context, chatID int64, lang string) error {
+	key := langPrefix + strconv.Itoa(int(chatID))
+
+	if lang == "" {
+		if err := r.db.HDel(ctx, key, langSelected).Err(); err != nil {
+			return errors.Wrap(err, "HDel")
+		}
+
+		return nil
+	}
+
+	if err := r.db.HSet(ctx, key, langSelected, lang).Err(); err != nil {
+		return errors.Wrap(err, "HSet")
+	}
+
+	return nil
+}
+
+// DetectLanguage запоминает язык телеграма, на нем пишем чату, пока язык не выбран
+func (r *repository) DetectLanguage(ctx context.Context, chatID int64, code string) error {
+	if code == "" {
+		return nil
+	}
+
+	if err := r.db.HSet(ctx, langPrefix+strconv.Itoa(int(chatID)), langDetected, code).Err(); err != nil {
+		return errors.Wrap(err, "HSet")
+	}
+
+	return nil
+}
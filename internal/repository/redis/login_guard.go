@@ -0,0 +1,116 @@
+package redis
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"strconv"
+	"time"
+)
+
+const (
+	loginFailuresPrefix = "login_failures:"
+	loginLockPrefix     = "login_lock:"
+	loginGlobalKey      = "login_failures:global"
+
+	// Первые попытки чата бесплатные, дальше каждая неудача удваивает блокировку
+	LoginFreeAttempts = 3
+	loginBaseLockout  = 30 * time.Second
+	loginMaxLockout   = 24 * time.Hour
+	loginFailuresTTL  = 24 * time.Hour
+
+	// Больше LoginGlobalLimit неудач со всех чатов за окно - всплеск, о нем предупреждаются руководители.
+	// Вход при этом не блокируется: иначе один перебирающий чат закрыл бы вход всем
+	LoginGlobalWindow = 5 * time.Minute
+	LoginGlobalLimit  = 30
+)
+
+// LoginFailure - счетчики после очередной неудачной попытки входа
+type LoginFailure struct {
+	ChatFailures   int64
+	GlobalFailures int64
+	// LockedFor - на сколько заблокирован вход чату, 0 - не заблокирован
+	LockedFor time.Duration
+	// Spike - попытка первой превысила глобальный лимит окна
+	Spike bool
+}
+
+type LoginGuardOperator interface {
+	GetLoginLock(ctx context.Context, chatID int64) (time.Duration, error)
+	RegisterLoginFailure(ctx context.Context, chatID int64) (LoginFailure, error)
+	ResetLoginFailures(ctx context.Context, chatID int64) error
+}
+
+// GetLoginLock возвращает, сколько еще заблокирован вход чату
+func (r *repository) GetLoginLock(ctx context.Context, chatID int64) (time.Duration, error) {
+	ttl, err := r.db.PTTL(ctx, loginLockPrefix+strconv.FormatInt(chatID, 10)).Result()
+	if err != nil {
+		return 0, errors.Wrap(err, "PTTL")
+	}
+
+	// Отрицательный ttl - ключа нет
+	return max(ttl, 0), nil
+}
+
+// RegisterLoginFailure считает неудачную попытку чата и общую, блокируя вход только чату.
+// INCR атомарный, поэтому счетчики верны и при нескольких репликах бота
+func (r *repository) RegisterLoginFailure(ctx context.Context, chatID int64) (LoginFailure, error) {
+	chatKey := loginFailuresPrefix + strconv.FormatInt(chatID, 10)
+
+	chatFailures, err := r.db.Incr(ctx, chatKey).Result()
+	if err != nil {
+		return LoginFailure{}, errors.Wrap(err, "Incr")
+	}
+
+	if err = r.db.Expire(ctx, chatKey, loginFailuresTTL).Err(); err != nil {
+		return LoginFailure{}, errors.Wrap(err, "Expire")
+	}
+
+	failure := LoginFailure{
+		ChatFailures: chatFailures,
+	}
+
+	if chatFailures > LoginFreeAttempts {
+		failure.LockedFor = backoff(loginBaseLockout, chatFailures-LoginFreeAttempts-1, loginMaxLockout)
+
+		lockKey := loginLockPrefix + strconv.FormatInt(chatID, 10)
+		if err = r.db.Set(ctx, lockKey, chatFailures, failure.LockedFor).Err(); err != nil {
+			return LoginFailure{}, errors.Wrap(err, "Set")
+		}
+	}
+
+	// Окно фиксированное: ttl ставит первая неудача окна
+	if failure.GlobalFailures, err = r.db.Incr(ctx, loginGlobalKey).Result(); err != nil {
+		return LoginFailure{}, errors.Wrap(err, "Incr")
+	}
+
+	if failure.GlobalFailures == 1 {
+		if err = r.db.Expire(ctx, loginGlobalKey, LoginGlobalWindow).Err(); err != nil {
+			return LoginFailure{}, errors.Wrap(err, "Expire")
+		}
+	}
+
+	failure.Spike = failure.GlobalFailures == LoginGlobalLimit+1
+
+	return failure, nil
+}
+
+// ResetLoginFailures сбрасывает счетчик чата после успешного входа
+func (r *repository) ResetLoginFailures(ctx context.Context, chatID int64) error {
+	chatKey := loginFailuresPrefix + strconv.FormatInt(chatID, 10)
+
+	if err := r.db.Del(ctx, chatKey).Err(); err != nil {
+		return errors.Wrap(err, "Del")
+	}
+
+	return nil
+}
+
+// backoff - base, удвоенный step раз, но не больше limit
+func backoff(base time.Duration, step int64, limit time.Duration) time.Duration {
+	lockout := base
+	for i := int64(0); i < step && lockout < limit; i++ {
+		lockout *= 2
+	}
+
+	return min(lockout, limit)
+}
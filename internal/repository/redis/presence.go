@@ -0,0 +1,76 @@
+package redis
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"strconv"
+	"time"
+)
+
+const (
+	presencePrefix = "presence:"
+
+	// Админ без активности дольше OnlineTTL автоматически уходит со смены
+	OnlineTTL = 30 * time.Minute
+)
+
+type PresenceOperator interface {
+	SetOnline(ctx context.Context, chatID int64) error
+	SetOffline(ctx context.Context, chatID int64) error
+	TouchPresence(ctx context.Context, chatID int64) error
+	GetOnline(ctx context.Context, chatIDs []int64) (map[int64]bool, error)
+}
+
+func (r *repository) SetOnline(ctx context.Context, chatID int64) error {
+	key := presencePrefix + strconv.Itoa(int(chatID))
+
+	if err := r.db.Set(ctx, key, time.Now().Unix(), OnlineTTL).Err(); err != nil {
+		return errors.Wrap(err, "Set")
+	}
+
+	return nil
+}
+
+func (r *repository) SetOffline(ctx context.Context, chatID int64) error {
+	key := presencePrefix + strconv.Itoa(int(chatID))
+
+	if err := r.db.Del(ctx, key).Err(); err != nil {
+		return errors.Wrap(err, "Del")
+	}
+
+	return nil
+}
+
+// TouchPresence продлевает смену при активности, тех, кто не на смене, не трогает
+func (r *repository) TouchPresence(ctx context.Context, chatID int64) error {
+	key := presencePrefix + strconv.Itoa(int(chatID))
+
+	if err := r.db.Expire(ctx, key, OnlineTTL).Err(); err != nil {
+		return errors.Wrap(err, "Expire")
+	}
+
+	return nil
+}
+
+func (r *repository) GetOnline(ctx context.Context, chatIDs []int64) (map[int64]bool, error) {
+	online := make(map[int64]bool, len(chatIDs))
+	if len(chatIDs) == 0 {
+		return online, nil
+	}
+
+	keys := make([]string, 0, len(chatIDs))
+	for _, v := range chatIDs {
+		keys = append(keys, presencePrefix+strconv.Itoa(int(v)))
+	}
+
+	values, err := r.db.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "MGet")
+	}
+
+	for i, v := range values {
+		online[chatIDs[i]] = v != nil
+	}
+
+	return online, nil
+}
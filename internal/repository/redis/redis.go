@@ -6,13 +6,28 @@ import (
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 	"os"
+	"strings"
 	"time"
 )
 
+// Сроки по умолчанию, если в окружении не заданы свои
+const (
+	defaultStateTTL      = 30 * time.Minute
+	defaultDraftTTL      = 72 * time.Hour
+	defaultDraftReminder = 12 * time.Hour
+)
+
 type repository struct {
 	db     *redis.Client
 	logger *logrus.Logger
-	ttl    time.Duration
+
+	// Состояние опроса живет stateTTL, для отдельных шагов - свой срок из stateTTLs
+	stateTTL  time.Duration
+	stateTTLs map[string]time.Duration
+
+	// Черновик заявки живет дольше состояния, напоминание приходит за draftReminder до удаления
+	draftTTL      time.Duration
+	draftReminder time.Duration
 }
 
 func NewRepository(ctx context.Context, logger *logrus.Logger) (*repository, error) {
@@ -24,14 +39,89 @@ func NewRepository(ctx context.Context, logger *logrus.Logger) (*repository, err
 		ConnMaxIdleTime: 5 * time.Second,
 	}
 
+	stateTTL, err := envDuration("STATE_TTL", defaultStateTTL)
+	if err != nil {
+		return nil, errors.Wrap(err, "envDuration")
+	}
+
+	stateTTLs, err := envDurations("STATE_TTLS")
+	if err != nil {
+		return nil, errors.Wrap(err, "envDurations")
+	}
+
+	draftTTL, err := envDuration("DRAFT_TTL", defaultDraftTTL)
+	if err != nil {
+		return nil, errors.Wrap(err, "envDuration")
+	}
+
+	draftReminder, err := envDuration("DRAFT_REMINDER", defaultDraftReminder)
+	if err != nil {
+		return nil, errors.Wrap(err, "envDuration")
+	}
+
+	if draftReminder >= draftTTL {
+		return nil, errors.Errorf("DRAFT_REMINDER %s must be less than DRAFT_TTL %s", draftReminder, draftTTL)
+	}
+
 	db := redis.NewClient(opts)
-	if _, err := db.Ping(ctx).Result(); err != nil {
+	if _, err = db.Ping(ctx).Result(); err != nil {
 		return nil, errors.Wrap(err, "db.Ping")
 	}
 
 	return &repository{
-		db:     db,
-		logger: logger,
-		ttl:    1 * time.Minute,
+		db:            db,
+		logger:        logger,
+		stateTTL:      stateTTL,
+		stateTTLs:     stateTTLs,
+		draftTTL:      draftTTL,
+		draftReminder: draftReminder,
 	}, nil
 }
+
+// envDuration читает срок из окружения в формате time.ParseDuration: "30m", "72h"
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Wrap(err, name)
+	}
+
+	if d <= 0 {
+		return 0, errors.Errorf("%s must be positive", name)
+	}
+
+	return d, nil
+}
+
+// envDurations читает сроки по ключам: "description=2h,done=1h"
+func envDurations(name string) (map[string]time.Duration, error) {
+	durations := make(map[string]time.Duration)
+
+	for _, v := range strings.Split(os.Getenv(name), ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(v, "=")
+		if !found {
+			return nil, errors.Errorf("%s: expected key=duration, got %q", name, v)
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, errors.Wrap(err, name)
+		}
+
+		if d <= 0 {
+			return nil, errors.Errorf("%s: %s must be positive", name, key)
+		}
+
+		durations[strings.TrimSpace(key)] = d
+	}
+
+	return durations, nil
+}
@@ -0,0 +1,23 @@
+package redis
+
+import (
+	"context"
+	"github.com/pkg/errors"
+)
+
+const roundRobinPrefix = "round_robin:"
+
+type RoutingOperator interface {
+	NextRoundRobin(ctx context.Context, unit string) (int64, error)
+}
+
+// NextRoundRobin выдает следующий номер очереди подразделения. INCR атомарный,
+// поэтому реплики бота не выдают один номер дважды
+func (r *repository) NextRoundRobin(ctx context.Context, unit string) (int64, error) {
+	value, err := r.db.Incr(ctx, roundRobinPrefix+unit).Result()
+	if err != nil {
+		return 0, errors.Wrap(err, "Incr")
+	}
+
+	return value, nil
+}
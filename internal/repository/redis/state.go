@@ -2,14 +2,28 @@ package redis
 
 import (
 	"context"
+	"github.com/goddeuce1/tg_bot_tz/internal/tickets/models"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/pkg/errors"
 	"strconv"
+	"time"
 )
 
 type StateOperator interface {
 	GetState(ctx context.Context, chatID int64) (*ChatData, error)
 	SetState(ctx context.Context, chatID int64, data ChatData) error
+	ClearState(ctx context.Context, chatID int64) error
+
+	SaveDraft(ctx context.Context, chatID int64, data ChatData) error
+	GetDraft(ctx context.Context, chatID int64) (*Draft, error)
+	DeleteDraft(ctx context.Context, chatID int64) error
+	PopDueDraftReminders(ctx context.Context, now time.Time) ([]int64, error)
+
+	AddDraftAttachment(ctx context.Context, chatID int64, attachment models.Attachment) (int64, error)
+	GetDraftAttachments(ctx context.Context, chatID int64) ([]models.Attachment, error)
+	ClearDraftAttachments(ctx context.Context, chatID int64) error
+	ClaimMediaGroup(ctx context.Context, mediaGroupID string, target string) (string, bool, error)
+	GetMediaGroup(ctx context.Context, mediaGroupID string) (string, error)
 }
 
 type ChatData struct {
@@ -21,6 +35,18 @@ type Data struct {
 	Unit        string `json:"unit"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	Reference   string `json:"reference,omitempty"`
+
+	// Ответы на дополнительные поля подразделения и номер поля, которое спрашиваем сейчас
+	Fields []models.FieldAnswer `json:"fields,omitempty"`
+	Field  int                  `json:"field,omitempty"`
+
+	// Пройденные шаги опроса для кнопки "Назад" и шаг, куда вернуться после правки ответа
+	History []string `json:"history,omitempty"`
+	Return  string   `json:"return,omitempty"`
+
+	// Число вложений черновика, только для показа, сами вложения в отдельном списке
+	Attachments int64 `json:"-"`
 }
 
 func (d Data) MarshalBinary() ([]byte, error) {
@@ -28,8 +54,10 @@ func (d Data) MarshalBinary() ([]byte, error) {
 }
 
 func (r *repository) GetState(ctx context.Context, chatID int64) (*ChatData, error) {
-	key := strconv.Itoa(int(chatID))
+	return r.getChatData(ctx, strconv.Itoa(int(chatID)))
+}
 
+func (r *repository) getChatData(ctx context.Context, key string) (*ChatData, error) {
 	d, err := r.db.HGetAll(ctx, key).Result()
 	if err != nil {
 		return nil, errors.Wrap(err, "HSet")
@@ -54,7 +82,7 @@ func (r *repository) SetState(ctx context.Context, chatID int64, data ChatData)
 	pipe := r.db.TxPipeline()
 
 	pipe.HSet(ctx, key, data)
-	pipe.Expire(ctx, key, r.ttl)
+	pipe.Expire(ctx, key, r.stateTTLFor(data.State))
 
 	if _, err := pipe.Exec(ctx); err != nil {
 		return errors.Wrap(err, "Exec")
@@ -62,3 +90,20 @@ func (r *repository) SetState(ctx context.Context, chatID int64, data ChatData)
 
 	return nil
 }
+
+// stateTTLFor - срок состояния на шаге state: свой, если задан, иначе общий
+func (r *repository) stateTTLFor(state string) time.Duration {
+	if ttl, ok := r.stateTTLs[state]; ok {
+		return ttl
+	}
+
+	return r.stateTTL
+}
+
+func (r *repository) ClearState(ctx context.Context, chatID int64) error {
+	if err := r.db.Del(ctx, strconv.Itoa(int(chatID))).Err(); err != nil {
+		return errors.Wrap(err, "Del")
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package redis
+
+import (
+	"context"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	statsPrefix = "stats:"
+	statsTTL    = time.Minute
+)
+
+// GetStats возвращает статистику из кеша, nil - в кеше ее нет
+func (r *repository) GetStats(ctx context.Context, filter models.StatsFilter) (*models.Stats, error) {
+	value, err := r.db.Get(ctx, statsKey(filter)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+
+		return nil, errors.Wrap(err, "Get")
+	}
+
+	var stats models.Stats
+
+	if err = jsoniter.UnmarshalFromString(value, &stats); err != nil {
+		return nil, errors.Wrap(err, "jsoniter.UnmarshalFromString")
+	}
+
+	return &stats, nil
+}
+
+// CacheStats кеширует статистику на statsTTL: цифры чуть отстают, зато тяжелые
+// запросы не выполняются на каждый /stats
+func (r *repository) CacheStats(ctx context.Context, filter models.StatsFilter, stats models.Stats) error {
+	value, err := jsoniter.MarshalToString(stats)
+	if err != nil {
+		return errors.Wrap(err, "jsoniter.MarshalToString")
+	}
+
+	if err = r.db.Set(ctx, statsKey(filter), value, statsTTL).Err(); err != nil {
+		return errors.Wrap(err, "Set")
+	}
+
+	return nil
+}
+
+func statsKey(filter models.StatsFilter) string {
+	units := append([]string(nil), filter.Units...)
+	sort.Strings(units)
+
+	return statsPrefix + filter.Period + ":" + strings.Join(units, "|")
+}
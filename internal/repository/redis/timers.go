@@ -0,0 +1,111 @@
+package redis
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+const (
+	slaTimersKey    = "sla_timers"
+	notifyTimersKey = "notify_timers"
+	claimTimersKey  = "claim_timers"
+)
+
+type TimerOperator interface {
+	ScheduleSLA(ctx context.Context, ticketID uint64, at time.Time) error
+	PopDueSLA(ctx context.Context, now time.Time) ([]uint64, error)
+	ScheduleNotification(ctx context.Context, ticketID uint64, at time.Time) error
+	PopDueNotifications(ctx context.Context, now time.Time) ([]uint64, error)
+	ScheduleClaim(ctx context.Context, ticketID uint64, at time.Time) error
+	PopDueClaims(ctx context.Context, now time.Time) ([]uint64, error)
+}
+
+// Таймеры храним в ZSET с временем срабатывания в score,
+// так они переживают рестарт и не дублируются между репликами
+
+func (r *repository) ScheduleSLA(ctx context.Context, ticketID uint64, at time.Time) error {
+	return r.scheduleTimer(ctx, slaTimersKey, ticketID, at)
+}
+
+func (r *repository) PopDueSLA(ctx context.Context, now time.Time) ([]uint64, error) {
+	return r.popDueTimers(ctx, slaTimersKey, now)
+}
+
+// ScheduleNotification откладывает уведомление админов о тикете до открытия подразделения
+func (r *repository) ScheduleNotification(ctx context.Context, ticketID uint64, at time.Time) error {
+	return r.scheduleTimer(ctx, notifyTimersKey, ticketID, at)
+}
+
+func (r *repository) PopDueNotifications(ctx context.Context, now time.Time) ([]uint64, error) {
+	return r.popDueTimers(ctx, notifyTimersKey, now)
+}
+
+// ScheduleClaim ставит срок, после которого не взятый агентом тикет увидят все на смене
+func (r *repository) ScheduleClaim(ctx context.Context, ticketID uint64, at time.Time) error {
+	return r.scheduleTimer(ctx, claimTimersKey, ticketID, at)
+}
+
+func (r *repository) PopDueClaims(ctx context.Context, now time.Time) ([]uint64, error) {
+	return r.popDueTimers(ctx, claimTimersKey, now)
+}
+
+func (r *repository) scheduleTimer(ctx context.Context, key string, ticketID uint64, at time.Time) error {
+	member := redis.Z{
+		Score:  float64(at.Unix()),
+		Member: strconv.FormatUint(ticketID, 10),
+	}
+
+	if err := r.db.ZAdd(ctx, key, member).Err(); err != nil {
+		return errors.Wrap(err, "ZAdd")
+	}
+
+	return nil
+}
+
+func (r *repository) popDueTimers(ctx context.Context, key string, now time.Time) ([]uint64, error) {
+	members, err := r.popDueMembers(ctx, key, now)
+	if err != nil {
+		return nil, errors.Wrap(err, "popDueMembers")
+	}
+
+	ticketIDs := make([]uint64, 0, len(members))
+	for _, v := range members {
+		ticketID, errParse := strconv.ParseUint(v, 10, 64)
+		if errParse != nil {
+			return nil, errors.Wrap(errParse, "strconv.ParseUint")
+		}
+
+		ticketIDs = append(ticketIDs, ticketID)
+	}
+
+	return ticketIDs, nil
+}
+
+// popDueMembers забирает сработавшие таймеры. Таймер наш, только если ZRem
+// удалил его, остальные уже забрала другая реплика
+func (r *repository) popDueMembers(ctx context.Context, key string, now time.Time) ([]string, error) {
+	members, err := r.db.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "ZRangeByScore")
+	}
+
+	popped := make([]string, 0, len(members))
+	for _, v := range members {
+		removed, errRem := r.db.ZRem(ctx, key, v).Result()
+		if errRem != nil {
+			return nil, errors.Wrap(errRem, "ZRem")
+		}
+
+		if removed > 0 {
+			popped = append(popped, v)
+		}
+	}
+
+	return popped, nil
+}
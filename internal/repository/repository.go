@@ -8,10 +8,81 @@ import (
 )
 
 type Repository interface {
-	SaveTicket(ctx context.Context, ticket models.Ticket) error
+	NextTicketReference(ctx context.Context, unit string) (string, error)
+	SaveTicket(ctx context.Context, ticket models.Ticket) (uint64, error)
+	UpdateTicketStatus(ctx context.Context, ticketID uint64, status string) (*models.Ticket, error)
+	AssignTicket(ctx context.Context, ticketID uint64, chatID int64, name string) (*models.Ticket, error)
+	ReassignTicket(ctx context.Context, ticketID uint64, chatID *int64, name string) (*models.Ticket, error)
+	SaveTicketMessage(ctx context.Context, message models.TicketMessage) error
+	SaveAttachments(ctx context.Context, attachments []models.Attachment) error
+	SaveNotification(ctx context.Context, notification models.Notification) error
 	SaveAdmins(ctx context.Context, chatIDs []int64, unit string) error
+	DeleteAdmin(ctx context.Context, chatID int64, unit string) ([]models.Ticket, error)
+
+	GetTicket(ctx context.Context, ticketID uint64) (*models.Ticket, error)
+	GetTicketByReference(ctx context.Context, reference string) (*models.Ticket, error)
+	GetActiveTicket(ctx context.Context, chatID int64) (*models.Ticket, error)
+	GetClientTickets(ctx context.Context, chatID int64, offset, limit uint64) ([]models.Ticket, error)
+	GetAttachments(ctx context.Context, ticketID uint64) ([]models.Attachment, error)
+	GetNotifications(ctx context.Context, ticketID uint64) ([]models.Notification, error)
+	GetTicketSLA(ctx context.Context, ticketID uint64) (*models.TicketSLA, error)
+	EscalateTicket(ctx context.Context, ticketID uint64, kind string) (bool, error)
+	ResetEscalation(ctx context.Context, ticketID uint64, kind string) error
+	SetUnitSupervisor(ctx context.Context, unit string, chatID int64) error
+
+	GetUnits(ctx context.Context, onlyActive bool) ([]models.Unit, error)
+	GetUnit(ctx context.Context, name string) (*models.Unit, error)
+	SaveUnit(ctx context.Context, unit models.Unit) error
+	RenameUnit(ctx context.Context, name string, newName string) error
+	SetUnitActive(ctx context.Context, name string, active bool) error
+	SetUnitName(ctx context.Context, unit string, lang string, name string) error
+
+	GetUnitSchedule(ctx context.Context, unit string) (*models.UnitSchedule, error)
+	SetUnitHours(ctx context.Context, unit string, timezone string, hours []models.UnitHours) error
+	SaveHoliday(ctx context.Context, unit string, day string) error
+	DeleteHoliday(ctx context.Context, unit string, day string) error
+	SetOffHoursReply(ctx context.Context, unit string, text string) error
+
+	GetUnitRouting(ctx context.Context, unit string) (*models.UnitRouting, error)
+	SetUnitRouting(ctx context.Context, routing models.UnitRouting) error
+	GetAssigneeLoads(ctx context.Context, unit string) ([]models.AssigneeLoad, error)
+
+	GetUnitFields(ctx context.Context, unit string) ([]models.UnitField, error)
+	SaveUnitField(ctx context.Context, field models.UnitField) error
+	DeleteUnitField(ctx context.Context, unit string, key string) error
+
+	GetUnitGroup(ctx context.Context, unit string) (*models.UnitGroup, error)
+	SetUnitGroup(ctx context.Context, group models.UnitGroup) error
+	SaveTicketTopic(ctx context.Context, topic models.TicketTopic) error
+	GetTicketTopic(ctx context.Context, ticketID uint64) (*models.TicketTopic, error)
+	GetTopicTicket(ctx context.Context, chatID int64, threadID int) (*models.Ticket, error)
 
 	GetAdmins(ctx context.Context, unit string) ([]models.Admin, error)
+	GetAdminRoles(ctx context.Context, chatID int64) ([]models.Admin, error)
+	GetUnitAdmins(ctx context.Context, unit string) ([]models.Admin, error)
+	GetAdminRole(ctx context.Context, chatID int64, unit string) (string, error)
+	GetAdminsByRole(ctx context.Context, unit string, role string) ([]models.Admin, error)
+	SetAdminRole(ctx context.Context, chatID int64, unit string, role string) error
+
+	SaveInvite(ctx context.Context, invite models.Invite) error
+	RedeemInvite(ctx context.Context, tokenHash string, chatID int64, name string) (*models.Invite, error)
+
+	SaveLoginAttempt(ctx context.Context, attempt models.LoginAttempt) error
+	GetSupervisorChats(ctx context.Context) ([]int64, error)
+
+	GetStats(ctx context.Context, filter models.StatsFilter) (*models.Stats, error)
+	CacheStats(ctx context.Context, filter models.StatsFilter, stats models.Stats) error
+
+	GetLanguage(ctx context.Context, chatID int64) (string, error)
+	SetLanguage(ctx context.Context, chatID int64, lang string) error
+	DetectLanguage(ctx context.Context, chatID int64, code string) error
+
+	SaveCannedResponse(ctx context.Context, response models.CannedResponse) (uint64, error)
+	UpdateCannedResponse(ctx context.Context, response models.CannedResponse) error
+	DeleteCannedResponse(ctx context.Context, responseID uint64) error
+	UseCannedResponse(ctx context.Context, responseID uint64) error
+	GetCannedResponse(ctx context.Context, responseID uint64) (*models.CannedResponse, error)
+	GetCannedResponses(ctx context.Context, unit string, offset, limit uint64) ([]models.CannedResponse, error)
 }
 
 type repository struct {
@@ -28,14 +99,129 @@ func NewRepository(repo Repository, cache Repository, logger *logrus.Logger) *re
 	}
 }
 
-func (r *repository) SaveTicket(ctx context.Context, ticket models.Ticket) error {
-	if err := r.repo.SaveTicket(ctx, ticket); err != nil {
-		return errors.Wrap(err, "repo.SaveTicket")
+func (r *repository) NextTicketReference(ctx context.Context, unit string) (string, error) {
+	reference, err := r.repo.NextTicketReference(ctx, unit)
+	if err != nil {
+		return "", errors.Wrap(err, "repo.NextTicketReference")
+	}
+
+	return reference, nil
+}
+
+func (r *repository) SaveTicket(ctx context.Context, ticket models.Ticket) (uint64, error) {
+	id, err := r.repo.SaveTicket(ctx, ticket)
+	if err != nil {
+		return 0, errors.Wrap(err, "repo.SaveTicket")
+	}
+
+	return id, nil
+}
+
+func (r *repository) UpdateTicketStatus(ctx context.Context, ticketID uint64, status string) (*models.Ticket, error) {
+	ticket, err := r.repo.UpdateTicketStatus(ctx, ticketID, status)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.UpdateTicketStatus")
+	}
+
+	return ticket, nil
+}
+
+func (r *repository) AssignTicket(ctx context.Context, ticketID uint64, chatID int64, name string) (*models.Ticket, error) {
+	ticket, err := r.repo.AssignTicket(ctx, ticketID, chatID, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.AssignTicket")
+	}
+
+	return ticket, nil
+}
+
+func (r *repository) ReassignTicket(ctx context.Context, ticketID uint64, chatID *int64, name string) (*models.Ticket, error) {
+	ticket, err := r.repo.ReassignTicket(ctx, ticketID, chatID, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.ReassignTicket")
+	}
+
+	return ticket, nil
+}
+
+func (r *repository) SaveAttachments(ctx context.Context, attachments []models.Attachment) error {
+	if err := r.repo.SaveAttachments(ctx, attachments); err != nil {
+		return errors.Wrap(err, "repo.SaveAttachments")
 	}
 
 	return nil
 }
 
+func (r *repository) SaveNotification(ctx context.Context, notification models.Notification) error {
+	if err := r.repo.SaveNotification(ctx, notification); err != nil {
+		return errors.Wrap(err, "repo.SaveNotification")
+	}
+
+	return nil
+}
+
+func (r *repository) GetAttachments(ctx context.Context, ticketID uint64) ([]models.Attachment, error) {
+	attachments, err := r.repo.GetAttachments(ctx, ticketID)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetAttachments")
+	}
+
+	return attachments, nil
+}
+
+func (r *repository) GetNotifications(ctx context.Context, ticketID uint64) ([]models.Notification, error) {
+	notifications, err := r.repo.GetNotifications(ctx, ticketID)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetNotifications")
+	}
+
+	return notifications, nil
+}
+
+func (r *repository) SaveTicketMessage(ctx context.Context, message models.TicketMessage) error {
+	if err := r.repo.SaveTicketMessage(ctx, message); err != nil {
+		return errors.Wrap(err, "repo.SaveTicketMessage")
+	}
+
+	return nil
+}
+
+func (r *repository) GetTicket(ctx context.Context, ticketID uint64) (*models.Ticket, error) {
+	ticket, err := r.repo.GetTicket(ctx, ticketID)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetTicket")
+	}
+
+	return ticket, nil
+}
+
+func (r *repository) GetTicketByReference(ctx context.Context, reference string) (*models.Ticket, error) {
+	ticket, err := r.repo.GetTicketByReference(ctx, reference)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetTicketByReference")
+	}
+
+	return ticket, nil
+}
+
+func (r *repository) GetActiveTicket(ctx context.Context, chatID int64) (*models.Ticket, error) {
+	ticket, err := r.repo.GetActiveTicket(ctx, chatID)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetActiveTicket")
+	}
+
+	return ticket, nil
+}
+
+func (r *repository) GetClientTickets(ctx context.Context, chatID int64, offset, limit uint64) ([]models.Ticket, error) {
+	tickets, err := r.repo.GetClientTickets(ctx, chatID, offset, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetClientTickets")
+	}
+
+	return tickets, nil
+}
+
 func (r *repository) SaveAdmins(ctx context.Context, chatIDs []int64, unit string) error {
 	// В первую очередь сейвим в постгрю
 	if err := r.repo.SaveAdmins(ctx, chatIDs, unit); err != nil {
@@ -70,3 +256,426 @@ func (r *repository) GetAdmins(ctx context.Context, unit string) ([]models.Admin
 
 	return admins, nil
 }
+
+// DeleteAdmin убирает чат из админов подразделения и возвращает тикеты, с которых снят исполнитель
+func (r *repository) DeleteAdmin(ctx context.Context, chatID int64, unit string) ([]models.Ticket, error) {
+	released, err := r.repo.DeleteAdmin(ctx, chatID, unit)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.DeleteAdmin")
+	}
+
+	// Сразу после постгри, иначе удаленный админ получал бы тикеты до истечения ттл кеша
+	if _, err = r.cache.DeleteAdmin(ctx, chatID, unit); err != nil {
+		return nil, errors.Wrap(err, "cache.DeleteAdmin")
+	}
+
+	return released, nil
+}
+
+func (r *repository) GetAdminRoles(ctx context.Context, chatID int64) ([]models.Admin, error) {
+	admins, err := r.repo.GetAdminRoles(ctx, chatID)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetAdminRoles")
+	}
+
+	return admins, nil
+}
+
+func (r *repository) GetUnitAdmins(ctx context.Context, unit string) ([]models.Admin, error) {
+	admins, err := r.repo.GetUnitAdmins(ctx, unit)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetUnitAdmins")
+	}
+
+	return admins, nil
+}
+
+func (r *repository) SaveLoginAttempt(ctx context.Context, attempt models.LoginAttempt) error {
+	if err := r.repo.SaveLoginAttempt(ctx, attempt); err != nil {
+		return errors.Wrap(err, "repo.SaveLoginAttempt")
+	}
+
+	return nil
+}
+
+func (r *repository) GetSupervisorChats(ctx context.Context) ([]int64, error) {
+	chatIDs, err := r.repo.GetSupervisorChats(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetSupervisorChats")
+	}
+
+	return chatIDs, nil
+}
+
+// GetStats считает статистику в постгре, результат недолго живет в кеше
+func (r *repository) GetStats(ctx context.Context, filter models.StatsFilter) (*models.Stats, error) {
+	stats, err := r.cache.GetStats(ctx, filter)
+	if err == nil && stats != nil {
+		return stats, nil
+	}
+
+	stats, err = r.repo.GetStats(ctx, filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetStats")
+	}
+
+	if err = r.cache.CacheStats(ctx, filter, *stats); err != nil {
+		return nil, errors.Wrap(err, "cache.CacheStats")
+	}
+
+	return stats, nil
+}
+
+func (r *repository) CacheStats(ctx context.Context, filter models.StatsFilter, stats models.Stats) error {
+	if err := r.cache.CacheStats(ctx, filter, stats); err != nil {
+		return errors.Wrap(err, "cache.CacheStats")
+	}
+
+	return nil
+}
+
+// Язык чата живет в кеше рядом с состоянием чата
+
+func (r *repository) GetLanguage(ctx context.Context, chatID int64) (string, error) {
+	lang, err := r.cache.GetLanguage(ctx, chatID)
+	if err != nil {
+		return "", errors.Wrap(err, "cache.GetLanguage")
+	}
+
+	return lang, nil
+}
+
+func (r *repository) SetLanguage(ctx context.Context, chatID int64, lang string) error {
+	if err := r.cache.SetLanguage(ctx, chatID, lang); err != nil {
+		return errors.Wrap(err, "cache.SetLanguage")
+	}
+
+	return nil
+}
+
+func (r *repository) DetectLanguage(ctx context.Context, chatID int64, code string) error {
+	if err := r.cache.DetectLanguage(ctx, chatID, code); err != nil {
+		return errors.Wrap(err, "cache.DetectLanguage")
+	}
+
+	return nil
+}
+
+func (r *repository) SaveCannedResponse(ctx context.Context, response models.CannedResponse) (uint64, error) {
+	id, err := r.repo.SaveCannedResponse(ctx, response)
+	if err != nil {
+		return 0, errors.Wrap(err, "repo.SaveCannedResponse")
+	}
+
+	return id, nil
+}
+
+func (r *repository) UpdateCannedResponse(ctx context.Context, response models.CannedResponse) error {
+	if err := r.repo.UpdateCannedResponse(ctx, response); err != nil {
+		return errors.Wrap(err, "repo.UpdateCannedResponse")
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteCannedResponse(ctx context.Context, responseID uint64) error {
+	if err := r.repo.DeleteCannedResponse(ctx, responseID); err != nil {
+		return errors.Wrap(err, "repo.DeleteCannedResponse")
+	}
+
+	return nil
+}
+
+func (r *repository) UseCannedResponse(ctx context.Context, responseID uint64) error {
+	if err := r.repo.UseCannedResponse(ctx, responseID); err != nil {
+		return errors.Wrap(err, "repo.UseCannedResponse")
+	}
+
+	return nil
+}
+
+func (r *repository) GetCannedResponse(ctx context.Context, responseID uint64) (*models.CannedResponse, error) {
+	response, err := r.repo.GetCannedResponse(ctx, responseID)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetCannedResponse")
+	}
+
+	return response, nil
+}
+
+func (r *repository) GetCannedResponses(ctx context.Context, unit string, offset, limit uint64) ([]models.CannedResponse, error) {
+	responses, err := r.repo.GetCannedResponses(ctx, unit, offset, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetCannedResponses")
+	}
+
+	return responses, nil
+}
+
+func (r *repository) GetTicketSLA(ctx context.Context, ticketID uint64) (*models.TicketSLA, error) {
+	ticket, err := r.repo.GetTicketSLA(ctx, ticketID)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetTicketSLA")
+	}
+
+	return ticket, nil
+}
+
+func (r *repository) EscalateTicket(ctx context.Context, ticketID uint64, kind string) (bool, error) {
+	escalated, err := r.repo.EscalateTicket(ctx, ticketID, kind)
+	if err != nil {
+		return false, errors.Wrap(err, "repo.EscalateTicket")
+	}
+
+	return escalated, nil
+}
+
+func (r *repository) ResetEscalation(ctx context.Context, ticketID uint64, kind string) error {
+	if err := r.repo.ResetEscalation(ctx, ticketID, kind); err != nil {
+		return errors.Wrap(err, "repo.ResetEscalation")
+	}
+
+	return nil
+}
+
+func (r *repository) SetUnitSupervisor(ctx context.Context, unit string, chatID int64) error {
+	if err := r.repo.SetUnitSupervisor(ctx, unit, chatID); err != nil {
+		return errors.Wrap(err, "repo.SetUnitSupervisor")
+	}
+
+	return nil
+}
+
+func (r *repository) GetUnits(ctx context.Context, onlyActive bool) ([]models.Unit, error) {
+	units, err := r.repo.GetUnits(ctx, onlyActive)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetUnits")
+	}
+
+	return units, nil
+}
+
+func (r *repository) GetUnit(ctx context.Context, name string) (*models.Unit, error) {
+	unit, err := r.repo.GetUnit(ctx, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetUnit")
+	}
+
+	return unit, nil
+}
+
+func (r *repository) SaveUnit(ctx context.Context, unit models.Unit) error {
+	if err := r.repo.SaveUnit(ctx, unit); err != nil {
+		return errors.Wrap(err, "repo.SaveUnit")
+	}
+
+	return nil
+}
+
+func (r *repository) RenameUnit(ctx context.Context, name string, newName string) error {
+	if err := r.repo.RenameUnit(ctx, name, newName); err != nil {
+		return errors.Wrap(err, "repo.RenameUnit")
+	}
+
+	return nil
+}
+
+func (r *repository) SetUnitActive(ctx context.Context, name string, active bool) error {
+	if err := r.repo.SetUnitActive(ctx, name, active); err != nil {
+		return errors.Wrap(err, "repo.SetUnitActive")
+	}
+
+	return nil
+}
+
+func (r *repository) SetUnitName(ctx context.Context, unit string, lang string, name string) error {
+	if err := r.repo.SetUnitName(ctx, unit, lang, name); err != nil {
+		return errors.Wrap(err, "repo.SetUnitName")
+	}
+
+	return nil
+}
+
+func (r *repository) GetUnitSchedule(ctx context.Context, unit string) (*models.UnitSchedule, error) {
+	unitSchedule, err := r.repo.GetUnitSchedule(ctx, unit)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetUnitSchedule")
+	}
+
+	return unitSchedule, nil
+}
+
+func (r *repository) SetUnitHours(ctx context.Context, unit string, timezone string, hours []models.UnitHours) error {
+	if err := r.repo.SetUnitHours(ctx, unit, timezone, hours); err != nil {
+		return errors.Wrap(err, "repo.SetUnitHours")
+	}
+
+	return nil
+}
+
+func (r *repository) SaveHoliday(ctx context.Context, unit string, day string) error {
+	if err := r.repo.SaveHoliday(ctx, unit, day); err != nil {
+		return errors.Wrap(err, "repo.SaveHoliday")
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteHoliday(ctx context.Context, unit string, day string) error {
+	if err := r.repo.DeleteHoliday(ctx, unit, day); err != nil {
+		return errors.Wrap(err, "repo.DeleteHoliday")
+	}
+
+	return nil
+}
+
+func (r *repository) SetOffHoursReply(ctx context.Context, unit string, text string) error {
+	if err := r.repo.SetOffHoursReply(ctx, unit, text); err != nil {
+		return errors.Wrap(err, "repo.SetOffHoursReply")
+	}
+
+	return nil
+}
+
+func (r *repository) GetUnitRouting(ctx context.Context, unit string) (*models.UnitRouting, error) {
+	routing, err := r.repo.GetUnitRouting(ctx, unit)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetUnitRouting")
+	}
+
+	return routing, nil
+}
+
+func (r *repository) SetUnitRouting(ctx context.Context, routing models.UnitRouting) error {
+	if err := r.repo.SetUnitRouting(ctx, routing); err != nil {
+		return errors.Wrap(err, "repo.SetUnitRouting")
+	}
+
+	return nil
+}
+
+func (r *repository) GetAssigneeLoads(ctx context.Context, unit string) ([]models.AssigneeLoad, error) {
+	loads, err := r.repo.GetAssigneeLoads(ctx, unit)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetAssigneeLoads")
+	}
+
+	return loads, nil
+}
+
+func (r *repository) GetUnitFields(ctx context.Context, unit string) ([]models.UnitField, error) {
+	fields, err := r.repo.GetUnitFields(ctx, unit)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetUnitFields")
+	}
+
+	return fields, nil
+}
+
+func (r *repository) SaveUnitField(ctx context.Context, field models.UnitField) error {
+	if err := r.repo.SaveUnitField(ctx, field); err != nil {
+		return errors.Wrap(err, "repo.SaveUnitField")
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteUnitField(ctx context.Context, unit string, key string) error {
+	if err := r.repo.DeleteUnitField(ctx, unit, key); err != nil {
+		return errors.Wrap(err, "repo.DeleteUnitField")
+	}
+
+	return nil
+}
+
+func (r *repository) GetUnitGroup(ctx context.Context, unit string) (*models.UnitGroup, error) {
+	group, err := r.repo.GetUnitGroup(ctx, unit)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetUnitGroup")
+	}
+
+	return group, nil
+}
+
+func (r *repository) SetUnitGroup(ctx context.Context, group models.UnitGroup) error {
+	if err := r.repo.SetUnitGroup(ctx, group); err != nil {
+		return errors.Wrap(err, "repo.SetUnitGroup")
+	}
+
+	return nil
+}
+
+func (r *repository) SaveTicketTopic(ctx context.Context, topic models.TicketTopic) error {
+	if err := r.repo.SaveTicketTopic(ctx, topic); err != nil {
+		return errors.Wrap(err, "repo.SaveTicketTopic")
+	}
+
+	return nil
+}
+
+func (r *repository) GetTicketTopic(ctx context.Context, ticketID uint64) (*models.TicketTopic, error) {
+	topic, err := r.repo.GetTicketTopic(ctx, ticketID)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetTicketTopic")
+	}
+
+	return topic, nil
+}
+
+func (r *repository) GetTopicTicket(ctx context.Context, chatID int64, threadID int) (*models.Ticket, error) {
+	ticket, err := r.repo.GetTopicTicket(ctx, chatID, threadID)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetTopicTicket")
+	}
+
+	return ticket, nil
+}
+
+func (r *repository) GetAdminRole(ctx context.Context, chatID int64, unit string) (string, error) {
+	role, err := r.repo.GetAdminRole(ctx, chatID, unit)
+	if err != nil {
+		return "", errors.Wrap(err, "repo.GetAdminRole")
+	}
+
+	return role, nil
+}
+
+func (r *repository) GetAdminsByRole(ctx context.Context, unit string, role string) ([]models.Admin, error) {
+	admins, err := r.repo.GetAdminsByRole(ctx, unit, role)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetAdminsByRole")
+	}
+
+	return admins, nil
+}
+
+func (r *repository) SetAdminRole(ctx context.Context, chatID int64, unit string, role string) error {
+	if err := r.repo.SetAdminRole(ctx, chatID, unit, role); err != nil {
+		return errors.Wrap(err, "repo.SetAdminRole")
+	}
+
+	return nil
+}
+
+func (r *repository) SaveInvite(ctx context.Context, invite models.Invite) error {
+	if err := r.repo.SaveInvite(ctx, invite); err != nil {
+		return errors.Wrap(err, "repo.SaveInvite")
+	}
+
+	return nil
+}
+
+func (r *repository) RedeemInvite(ctx context.Context, tokenHash string, chatID int64, name string) (*models.Invite, error) {
+	invite, err := r.repo.RedeemInvite(ctx, tokenHash, chatID, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.RedeemInvite")
+	}
+
+	// Новый админ сразу должен получать тикеты. Кеш сбрасываем, а не дописываем:
+	// если ключ успел истечь, в нем остался бы один новый админ
+	if _, err = r.cache.DeleteAdmin(ctx, chatID, invite.Unit); err != nil {
+		return nil, errors.Wrap(err, "cache.DeleteAdmin")
+	}
+
+	return invite, nil
+}
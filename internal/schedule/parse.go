@@ -0,0 +1,199 @@
+package schedule
+
+import (
+	"fmt"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Дни недели в порядке показа, с понедельника
+var weekdays = []time.Weekday{
+	time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday,
+}
+
+var weekdayNames = map[time.Weekday]string{
+	time.Monday:    "weekday_mon",
+	time.Tuesday:   "weekday_tue",
+	time.Wednesday: "weekday_wed",
+	time.Thursday:  "weekday_thu",
+	time.Friday:    "weekday_fri",
+	time.Saturday:  "weekday_sat",
+	time.Sunday:    "weekday_sun",
+}
+
+var ErrInvalidHours = errors.New("invalid hours")
+
+// FromUnit собирает расписание из сохраненного в базе
+func FromUnit(unitSchedule models.UnitSchedule) (Schedule, error) {
+	location, err := time.LoadLocation(unitSchedule.Timezone)
+	if err != nil {
+		return Schedule{}, errors.Wrap(err, "time.LoadLocation")
+	}
+
+	s := Schedule{
+		Location: location,
+		Hours:    make(map[time.Weekday]Interval, len(unitSchedule.Hours)),
+		Holidays: make(map[string]bool, len(unitSchedule.Holidays)),
+	}
+
+	for _, v := range unitSchedule.Hours {
+		s.Hours[time.Weekday(v.Weekday)] = Interval{
+			Opens:  time.Duration(v.OpensAt) * time.Second,
+			Closes: time.Duration(v.ClosesAt) * time.Second,
+		}
+	}
+
+	for _, v := range unitSchedule.Holidays {
+		s.Holidays[v] = true
+	}
+
+	return s, nil
+}
+
+// ParseHours разбирает расписание вида "1-5 09:00-18:00, 6 10:00-14:00",
+// дни недели от 1 (понедельник) до 7 (воскресенье). "24/7" и пустая строка -
+// круглосуточно, то есть без расписания
+func ParseHours(text string) ([]models.UnitHours, error) {
+	text = strings.TrimSpace(text)
+	if text == "" || text == "24/7" {
+		return nil, nil
+	}
+
+	seen := make(map[int]bool)
+	hours := make([]models.UnitHours, 0, len(weekdays))
+
+	for _, part := range strings.Split(text, ",") {
+		days, interval, ok := strings.Cut(strings.TrimSpace(part), " ")
+		if !ok {
+			return nil, ErrInvalidHours
+		}
+
+		from, to, err := parseRange(days, parseWeekday)
+		if err != nil {
+			return nil, err
+		}
+
+		opens, closes, err := parseRange(strings.TrimSpace(interval), parseClock)
+		if err != nil {
+			return nil, err
+		}
+
+		// Работу через полночь не поддерживаем, ее задают двумя днями
+		if opens >= closes {
+			return nil, ErrInvalidHours
+		}
+
+		for day := from; day <= to; day++ {
+			weekday := day % 7
+			if seen[weekday] {
+				return nil, ErrInvalidHours
+			}
+
+			seen[weekday] = true
+			hours = append(hours, models.UnitHours{
+				Weekday:  weekday,
+				OpensAt:  opens,
+				ClosesAt: closes,
+			})
+		}
+	}
+
+	return hours, nil
+}
+
+// ParseDate проверяет дату праздника в формате 2006-01-02
+func ParseDate(text string) (string, error) {
+	day, err := time.Parse(dateLayout, strings.TrimSpace(text))
+	if err != nil {
+		return "", ErrInvalidHours
+	}
+
+	return day.Format(dateLayout), nil
+}
+
+// FormatHours показывает расписание по дням недели начиная с понедельника, в разметке сообщений
+func FormatHours(lang string, s Schedule) string {
+	if s.AlwaysOpen() {
+		return i18n.T(lang, "hours_always_open")
+	}
+
+	lines := make([]string, 0, len(weekdays))
+	for _, v := range weekdays {
+		day := i18n.Plain(lang, weekdayNames[v])
+
+		interval, ok := s.Hours[v]
+		if !ok {
+			lines = append(lines, i18n.T(lang, "hours_day_off", i18n.Args{"day": day}))
+
+			continue
+		}
+
+		lines = append(lines, i18n.T(lang, "hours_day", i18n.Args{
+			"day":    day,
+			"opens":  formatClock(interval.Opens),
+			"closes": formatClock(interval.Closes),
+		}))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func parseRange(text string, parse func(string) (int, error)) (int, int, error) {
+	fromText, toText, ok := strings.Cut(text, "-")
+	if !ok {
+		toText = fromText
+	}
+
+	from, err := parse(fromText)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	to, err := parse(toText)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if from > to {
+		return 0, 0, ErrInvalidHours
+	}
+
+	return from, to, nil
+}
+
+func parseWeekday(text string) (int, error) {
+	day, err := strconv.Atoi(strings.TrimSpace(text))
+	if err != nil || day < 1 || day > 7 {
+		return 0, ErrInvalidHours
+	}
+
+	return day, nil
+}
+
+// parseClock переводит ЧЧ:ММ в секунды от полуночи, 24:00 - конец дня
+func parseClock(text string) (int, error) {
+	hoursText, minutesText, ok := strings.Cut(strings.TrimSpace(text), ":")
+	if !ok {
+		return 0, ErrInvalidHours
+	}
+
+	hours, err := strconv.Atoi(hoursText)
+	if err != nil || hours < 0 || hours > 24 {
+		return 0, ErrInvalidHours
+	}
+
+	minutes, err := strconv.Atoi(minutesText)
+	if err != nil || minutes < 0 || minutes > 59 || hours == 24 && minutes != 0 {
+		return 0, ErrInvalidHours
+	}
+
+	return hours*3600 + minutes*60, nil
+}
+
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
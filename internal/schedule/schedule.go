@@ -0,0 +1,87 @@
+package schedule
+
+import (
+	"time"
+)
+
+const (
+	dateLayout = "2006-01-02"
+
+	// Дальше года вперед открытие не ищем - значит, подразделение закрыто бессрочно
+	maxLookahead = 366
+)
+
+// Interval - часы работы в день недели, смещения от полуночи по времени подразделения
+type Interval struct {
+	Opens  time.Duration
+	Closes time.Duration
+}
+
+// Schedule - недельное расписание подразделения. Пустое расписание - работает круглосуточно
+type Schedule struct {
+	Location *time.Location
+	Hours    map[time.Weekday]Interval
+	Holidays map[string]bool
+}
+
+func (s Schedule) AlwaysOpen() bool {
+	return len(s.Hours) == 0
+}
+
+// IsOpen проверяет, работает ли подразделение в момент t
+func (s Schedule) IsOpen(t time.Time) bool {
+	if s.AlwaysOpen() {
+		return true
+	}
+
+	t = t.In(s.location())
+	if s.Holidays[t.Format(dateLayout)] {
+		return false
+	}
+
+	interval, ok := s.Hours[t.Weekday()]
+	if !ok {
+		return false
+	}
+
+	sinceMidnight := t.Sub(midnight(t))
+
+	return sinceMidnight >= interval.Opens && sinceMidnight < interval.Closes
+}
+
+// NextOpen возвращает ближайший момент начиная с t, когда подразделение работает.
+// false - в ближайший год подразделение не откроется
+func (s Schedule) NextOpen(t time.Time) (time.Time, bool) {
+	if s.IsOpen(t) {
+		return t, true
+	}
+
+	t = t.In(s.location())
+	day := midnight(t)
+
+	for i := 0; i < maxLookahead; i++ {
+		interval, ok := s.Hours[day.Weekday()]
+		if ok && !s.Holidays[day.Format(dateLayout)] {
+			// Сегодня подразделение могло уже закрыться, тогда ищем дальше
+			if opens := day.Add(interval.Opens); !opens.Before(t) {
+				return opens, true
+			}
+		}
+
+		day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, day.Location())
+	}
+
+	return time.Time{}, false
+}
+
+func (s Schedule) location() *time.Location {
+	if s.Location == nil {
+		return time.UTC
+	}
+
+	return s.Location
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,231 @@
+package sla
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/redis"
+	"github.com/goddeuce1/tg_bot_tz/internal/tickets"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+const (
+	pollInterval = 10 * time.Second
+
+	// Пока тикет на паузе, проверяем его реже - срок все равно сдвигается
+	pausedRecheck = time.Minute
+
+	textEscalation = "sla_escalation"
+	textReminder   = "sla_reminder"
+	textNoAssignee = "admin_ticket_no_assignee"
+)
+
+var kindNames = map[string]string{
+	models.SLAFirstResponse: "sla_first_response",
+	models.SLAResolution:    "sla_resolution",
+}
+
+type scheduler struct {
+	repo   repository.Repository
+	timers redis.TimerOperator
+	botAPI *tgbotapi.BotAPI
+	logger *logrus.Logger
+}
+
+func NewScheduler(
+	repo repository.Repository,
+	timers redis.TimerOperator,
+	botAPI *tgbotapi.BotAPI,
+	logger *logrus.Logger,
+) *scheduler {
+	return &scheduler{
+		repo:   repo,
+		timers: timers,
+		botAPI: botAPI,
+		logger: logger,
+	}
+}
+
+func (s *scheduler) Start(ctx context.Context, gracefulWg *sync.WaitGroup) {
+	defer func() {
+		s.logger.Info("Shutting down SLA scheduler")
+
+		gracefulWg.Done()
+	}()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case now := <-ticker.C:
+			ticketIDs, err := s.timers.PopDueSLA(ctx, now)
+			if err != nil {
+				s.logger.Errorf("Cannot pop SLA timers, Error = %s", err)
+
+				continue
+			}
+
+			for _, v := range ticketIDs {
+				if err = s.check(ctx, v, now); err != nil {
+					s.logger.Errorf("Cannot check SLA of ticket ID = %d, Error = %s", v, err)
+
+					// Таймер уже снят, ставим заново, чтобы не потерять тикет
+					if err = s.timers.ScheduleSLA(ctx, v, now.Add(pollInterval)); err != nil {
+						s.logger.Errorf("Cannot reschedule SLA of ticket ID = %d, Error = %s", v, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+// check эскалирует нарушенные сроки тикета и ставит таймер на ближайший оставшийся
+func (s *scheduler) check(ctx context.Context, ticketID uint64, now time.Time) error {
+	ticket, err := s.repo.GetTicketSLA(ctx, ticketID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil
+		}
+
+		return errors.Wrap(err, "repo.GetTicketSLA")
+	}
+
+	if ticket.Status == models.StatusResolved || ticket.Status == models.StatusClosed {
+		return nil
+	}
+
+	if ticket.SLAPausedAt != nil {
+		return errors.Wrap(s.timers.ScheduleSLA(ctx, ticketID, now.Add(pausedRecheck)), "timers.ScheduleSLA")
+	}
+
+	var next time.Time
+
+	kinds := []struct {
+		kind    string
+		pending bool
+	}{
+		{models.SLAFirstResponse, ticket.FirstResponseAt == nil && !ticket.FirstResponseEscalated},
+		{models.SLAResolution, !ticket.ResolutionEscalated},
+	}
+
+	for _, v := range kinds {
+		if !v.pending {
+			continue
+		}
+
+		deadline := ticket.Deadline(v.kind, now)
+		if deadline.After(now) {
+			if next.IsZero() || deadline.Before(next) {
+				next = deadline
+			}
+
+			continue
+		}
+
+		if err = s.escalate(ctx, *ticket, v.kind, deadline); err != nil {
+			return errors.Wrap(err, "escalate")
+		}
+	}
+
+	if next.IsZero() {
+		return nil
+	}
+
+	return errors.Wrap(s.timers.ScheduleSLA(ctx, ticketID, next), "timers.ScheduleSLA")
+}
+
+// escalate помечает нарушение и рассылает эскалацию. Пометка ставится до отправки,
+// чтобы несколько реплик не разослали ее дважды, и снимается, если отправить не вышло
+func (s *scheduler) escalate(ctx context.Context, ticket models.TicketSLA, kind string, deadline time.Time) error {
+	escalated, err := s.repo.EscalateTicket(ctx, ticket.ID, kind)
+	if err != nil {
+		return errors.Wrap(err, "repo.EscalateTicket")
+	}
+
+	if !escalated {
+		return nil
+	}
+
+	if err = s.notify(ctx, ticket, kind, deadline); err != nil {
+		if errReset := s.repo.ResetEscalation(ctx, ticket.ID, kind); errReset != nil {
+			s.logger.Errorf("Cannot reset SLA escalation of ticket ID = %d, Error = %s", ticket.ID, errReset)
+		}
+
+		return errors.Wrap(err, "notify")
+	}
+
+	return nil
+}
+
+// notify пишет руководителю подразделения и напоминает исполнителю
+// (или всем админам подразделения, если тикет никто не взял)
+func (s *scheduler) notify(ctx context.Context, ticket models.TicketSLA, kind string, deadline time.Time) error {
+	data, err := tickets.LoadTicketData(ctx, s.repo, ticket.Ticket)
+	if err != nil {
+		return errors.Wrap(err, "tickets.LoadTicketData")
+	}
+
+	if ticket.SupervisorChatID != nil {
+		lang, errLang := tickets.ChatLang(ctx, s.repo, *ticket.SupervisorChatID)
+		if errLang != nil {
+			return errors.Wrap(errLang, "tickets.ChatLang")
+		}
+
+		assignee := i18n.Plain(lang, textNoAssignee)
+		if ticket.Assignee != nil {
+			assignee = ticket.AssigneeName
+		}
+
+		text := i18n.T(lang, textEscalation, data.Args(i18n.Args{
+			"kind":     i18n.Plain(lang, kindNames[kind]),
+			"priority": models.PriorityName(lang, ticket.Priority),
+			"status":   models.StatusName(lang, ticket.Status),
+			"assignee": assignee,
+			"deadline": deadline.Format("02.01.2006 15:04"),
+		}))
+
+		if err = s.send(*ticket.SupervisorChatID, text); err != nil {
+			return errors.Wrap(err, "send")
+		}
+	}
+
+	admins, err := tickets.TicketAdmins(ctx, s.repo, ticket.Ticket)
+	if err != nil {
+		return errors.Wrap(err, "tickets.TicketAdmins")
+	}
+
+	for k := range admins {
+		lang, errLang := tickets.ChatLang(ctx, s.repo, k)
+		if errLang != nil {
+			return errors.Wrap(errLang, "tickets.ChatLang")
+		}
+
+		text := i18n.T(lang, textReminder, data.Args(i18n.Args{"kind": i18n.Plain(lang, kindNames[kind])}))
+
+		if err = s.send(k, text); err != nil {
+			return errors.Wrap(err, "send")
+		}
+	}
+
+	return nil
+}
+
+func (s *scheduler) send(chatID int64, text string) error {
+	msgToSend := tgbotapi.NewMessage(chatID, text)
+	msgToSend.ParseMode = i18n.ParseMode()
+
+	if _, err := s.botAPI.Send(msgToSend); err != nil {
+		return errors.Wrap(err, "botAPI.Send")
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package tickets
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	hmodels "github.com/goddeuce1/tg_bot_tz/internal/tickets/models"
+	"github.com/pkg/errors"
+)
+
+// SendAttachments отправляет вложения ответом на сообщение replyTo,
+// альбомы (общий MediaGroupID) отправляются одной медиагруппой
+func SendAttachments(botAPI *tgbotapi.BotAPI, chatID int64, replyTo int, attachments []hmodels.Attachment) error {
+	groups := make([][]hmodels.Attachment, 0)
+	groupIndex := make(map[string]int)
+
+	for _, v := range attachments {
+		if v.MediaGroupID == "" {
+			groups = append(groups, []hmodels.Attachment{v})
+
+			continue
+		}
+
+		if i, ok := groupIndex[v.MediaGroupID]; ok {
+			groups[i] = append(groups[i], v)
+
+			continue
+		}
+
+		groupIndex[v.MediaGroupID] = len(groups)
+		groups = append(groups, []hmodels.Attachment{v})
+	}
+
+	for _, group := range groups {
+		if len(group) == 1 {
+			if _, err := botAPI.Send(attachmentConfig(chatID, replyTo, group[0])); err != nil {
+				return errors.Wrap(err, "botAPI.Send")
+			}
+
+			continue
+		}
+
+		media := make([]interface{}, 0, len(group))
+		for _, v := range group {
+			media = append(media, inputMedia(v))
+		}
+
+		mediaGroup := tgbotapi.NewMediaGroup(chatID, media)
+		mediaGroup.ReplyToMessageID = replyTo
+
+		if _, err := botAPI.SendMediaGroup(mediaGroup); err != nil {
+			return errors.Wrap(err, "botAPI.SendMediaGroup")
+		}
+	}
+
+	return nil
+}
+
+func attachmentConfig(chatID int64, replyTo int, attachment hmodels.Attachment) tgbotapi.Chattable {
+	file := tgbotapi.FileID(attachment.FileID)
+
+	switch attachment.Type {
+	case hmodels.AttachmentPhoto:
+		cfg := tgbotapi.NewPhoto(chatID, file)
+		cfg.Caption = attachment.Caption
+		cfg.ReplyToMessageID = replyTo
+
+		return cfg
+
+	case hmodels.AttachmentVoice:
+		cfg := tgbotapi.NewVoice(chatID, file)
+		cfg.Caption = attachment.Caption
+		cfg.ReplyToMessageID = replyTo
+
+		return cfg
+
+	case hmodels.AttachmentVideo:
+		cfg := tgbotapi.NewVideo(chatID, file)
+		cfg.Caption = attachment.Caption
+		cfg.ReplyToMessageID = replyTo
+
+		return cfg
+
+	default:
+		cfg := tgbotapi.NewDocument(chatID, file)
+		cfg.Caption = attachment.Caption
+		cfg.ReplyToMessageID = replyTo
+
+		return cfg
+	}
+}
+
+// В альбоме телеграм допускает только фото, видео, документы и аудио
+func inputMedia(attachment hmodels.Attachment) interface{} {
+	file := tgbotapi.FileID(attachment.FileID)
+
+	switch attachment.Type {
+	case hmodels.AttachmentPhoto:
+		media := tgbotapi.NewInputMediaPhoto(file)
+		media.Caption = attachment.Caption
+
+		return media
+
+	case hmodels.AttachmentVideo:
+		media := tgbotapi.NewInputMediaVideo(file)
+		media.Caption = attachment.Caption
+
+		return media
+
+	default:
+		media := tgbotapi.NewInputMediaDocument(file)
+		media.Caption = attachment.Caption
+
+		return media
+	}
+}
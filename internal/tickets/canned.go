@@ -0,0 +1,127 @@
+package tickets
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/callbacks"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	topCannedResponses = 3
+	cannedPageSize     = 5
+	cannedTitleLength  = 30
+
+	textCannedClient = "canned_client"
+	textButtonBack   = "button_back"
+	textButtonMore   = "button_more_canned"
+)
+
+// GetTopCannedResponses возвращает самые используемые шаблоны подразделения
+// для кнопок уведомления, лишний шаблон в конце означает, что есть еще
+func GetTopCannedResponses(ctx context.Context, repo repository.Repository, unit string) ([]models.CannedResponse, error) {
+	responses, err := repo.GetCannedResponses(ctx, unit, 0, topCannedResponses+1)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetCannedResponses")
+	}
+
+	return responses, nil
+}
+
+// RenderCannedResponse подставляет в шаблон данные тикета, lang - язык клиента
+func RenderCannedResponse(lang string, text string, ticket models.Ticket) string {
+	client := ticket.ClientName
+	if client == "" {
+		client = i18n.Plain(lang, textCannedClient)
+	}
+
+	replacer := strings.NewReplacer(
+		"{client}", client,
+		"{ticket}", ticket.Reference,
+		"{name}", ticket.Name,
+		"{unit}", ticket.Unit,
+	)
+
+	return replacer.Replace(text)
+}
+
+// BuildCannedResponsesMarkup строит страницу всех шаблонов подразделения (страницы с 0)
+func BuildCannedResponsesMarkup(
+	ctx context.Context,
+	repo repository.Repository,
+	lang string,
+	ticket models.Ticket,
+	page int,
+) (tgbotapi.InlineKeyboardMarkup, error) {
+	responses, err := repo.GetCannedResponses(ctx, ticket.Unit, uint64(page*cannedPageSize), cannedPageSize+1)
+	if err != nil {
+		return tgbotapi.InlineKeyboardMarkup{}, errors.Wrap(err, "repo.GetCannedResponses")
+	}
+
+	hasNext := len(responses) > cannedPageSize
+	if hasNext {
+		responses = responses[:cannedPageSize]
+	}
+
+	ticketID := strconv.FormatUint(ticket.ID, 10)
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0)
+
+	for _, v := range responses {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(cannedResponseButton(ticket, v)))
+	}
+
+	navigation := []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData(i18n.Plain(lang, textButtonBack), callbacks.Build(callbacks.ActionAdminView, ticketID)),
+	}
+
+	if page > 0 {
+		navigation = append(navigation, tgbotapi.NewInlineKeyboardButtonData(
+			"◀", callbacks.Build(callbacks.ActionCannedPage, ticketID, strconv.Itoa(page-1)),
+		))
+	}
+
+	if hasNext {
+		navigation = append(navigation, tgbotapi.NewInlineKeyboardButtonData(
+			"▶", callbacks.Build(callbacks.ActionCannedPage, ticketID, strconv.Itoa(page+1)),
+		))
+	}
+
+	rows = append(rows, navigation)
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...), nil
+}
+
+func cannedResponsesRows(lang string, ticket models.Ticket, responses []models.CannedResponse) [][]tgbotapi.InlineKeyboardButton {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0)
+
+	for i, v := range responses {
+		if i == topCannedResponses {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(i18n.Plain(lang, textButtonMore), callbacks.Build(
+					callbacks.ActionCannedPage, strconv.FormatUint(ticket.ID, 10), "0",
+				)),
+			))
+
+			break
+		}
+
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(cannedResponseButton(ticket, v)))
+	}
+
+	return rows
+}
+
+func cannedResponseButton(ticket models.Ticket, response models.CannedResponse) tgbotapi.InlineKeyboardButton {
+	data := callbacks.Build(
+		callbacks.ActionCanned,
+		strconv.FormatUint(ticket.ID, 10),
+		strconv.FormatUint(response.ID, 10),
+	)
+
+	return tgbotapi.NewInlineKeyboardButtonData("💬 "+truncate(response.Title, cannedTitleLength), data)
+}
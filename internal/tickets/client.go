@@ -0,0 +1,121 @@
+package tickets
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/callbacks"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/pkg/errors"
+	"strconv"
+)
+
+const (
+	clientPageSize   = 5
+	clientNameLength = 30
+
+	textClientTickets      = "client_tickets"
+	textClientTicketsEmpty = "client_tickets_empty"
+	textClientTicketsItem  = "client_tickets_item"
+	textClientTicket       = "client_ticket"
+	textButtonReopen       = "button_reopen"
+	textButtonList         = "button_list"
+)
+
+// BuildClientTicketsWithMarkup строит страницу списка тикетов клиента (страницы с 0) на языке lang
+func BuildClientTicketsWithMarkup(
+	ctx context.Context,
+	repo repository.Repository,
+	lang string,
+	chatID int64,
+	page int,
+) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	// Берем на один больше, чтобы понять, есть ли следующая страница
+	tickets, err := repo.GetClientTickets(ctx, chatID, uint64(page*clientPageSize), clientPageSize+1)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, errors.Wrap(err, "repo.GetClientTickets")
+	}
+
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0)
+
+	if len(tickets) == 0 && page == 0 {
+		return i18n.T(lang, textClientTicketsEmpty), tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}, nil
+	}
+
+	hasNext := len(tickets) > clientPageSize
+	if hasNext {
+		tickets = tickets[:clientPageSize]
+	}
+
+	pageStr := strconv.Itoa(page)
+
+	for _, v := range tickets {
+		text := i18n.Plain(lang, textClientTicketsItem, i18n.Args{
+			"ticket": v.Reference,
+			"name":   truncate(v.Name, clientNameLength),
+			"status": models.StatusName(lang, v.Status),
+		})
+		data := callbacks.Build(callbacks.ActionMyTicket, strconv.FormatUint(v.ID, 10), pageStr)
+
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(text, data),
+		))
+	}
+
+	navigation := make([]tgbotapi.InlineKeyboardButton, 0)
+	if page > 0 {
+		navigation = append(navigation, tgbotapi.NewInlineKeyboardButtonData(
+			"◀", callbacks.Build(callbacks.ActionMyTickets, strconv.Itoa(page-1)),
+		))
+	}
+
+	if hasNext {
+		navigation = append(navigation, tgbotapi.NewInlineKeyboardButtonData(
+			"▶", callbacks.Build(callbacks.ActionMyTickets, strconv.Itoa(page+1)),
+		))
+	}
+
+	if len(navigation) > 0 {
+		rows = append(rows, navigation)
+	}
+
+	return i18n.T(lang, textClientTickets, i18n.Args{"page": page + 1}), tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}, nil
+}
+
+// BuildClientTicketWithMarkup строит карточку тикета клиента, page - страница списка для возврата
+func BuildClientTicketWithMarkup(lang string, data TicketData, page int) (string, tgbotapi.InlineKeyboardMarkup) {
+	ticket := data.Ticket
+
+	msg := i18n.T(lang, textClientTicket, data.Args(i18n.Args{
+		"unit":        data.Unit.Title(lang),
+		"description": ticket.Description,
+		"status":      models.StatusName(lang, ticket.Status),
+	}))
+
+	ticketID := strconv.FormatUint(ticket.ID, 10)
+	pageStr := strconv.Itoa(page)
+
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0)
+
+	if models.CanTransition(ticket.Status, models.StatusOpen) {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(i18n.Plain(lang, textButtonReopen), callbacks.Build(callbacks.ActionReopen, ticketID, pageStr)),
+		))
+	}
+
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(i18n.Plain(lang, textButtonList), callbacks.Build(callbacks.ActionMyTickets, pageStr)),
+	))
+
+	return msg, tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func truncate(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+
+	return string(runes[:length-1]) + "…"
+}
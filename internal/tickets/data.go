@@ -0,0 +1,76 @@
+package tickets
+
+import (
+	"context"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/pkg/errors"
+)
+
+// Client - клиент тикета в шаблонах сообщений
+type Client struct {
+	ID   int64
+	Name string
+}
+
+// TicketData - данные шаблонов сообщений о тикете:
+// {{.Ticket.Reference}}, {{.Client.Name}}, {{.Unit.Description}}
+type TicketData struct {
+	Ticket models.Ticket
+	Client Client
+	Unit   models.Unit
+}
+
+// LoadTicketData собирает данные шаблонов о тикете. Подразделение могли
+// удалить, тогда в шаблоне есть только его название
+func LoadTicketData(ctx context.Context, repo repository.Repository, ticket models.Ticket) (TicketData, error) {
+	data := TicketData{
+		Ticket: ticket,
+		Client: Client{ID: ticket.ChatID, Name: ticket.ClientName},
+		Unit:   models.Unit{Name: ticket.Unit},
+	}
+
+	unit, err := repo.GetUnit(ctx, ticket.Unit)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return data, nil
+		}
+
+		return TicketData{}, errors.Wrap(err, "repo.GetUnit")
+	}
+
+	data.Unit = *unit
+
+	return data, nil
+}
+
+// unitTitle - название подразделения для клиента на языке lang. Удаленное
+// подразделение остается под своим ключом
+func unitTitle(ctx context.Context, repo repository.Repository, lang string, unit string) (string, error) {
+	u, err := repo.GetUnit(ctx, unit)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return unit, nil
+		}
+
+		return "", errors.Wrap(err, "repo.GetUnit")
+	}
+
+	return u.Title(lang), nil
+}
+
+// Args - данные шаблона о тикете вместе с args
+func (d TicketData) Args(args i18n.Args) i18n.Args {
+	values := i18n.Args{
+		"Ticket": d.Ticket,
+		"Client": d.Client,
+		"Unit":   d.Unit,
+	}
+
+	for k, v := range args {
+		values[k] = v
+	}
+
+	return values
+}
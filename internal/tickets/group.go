@@ -0,0 +1,151 @@
+package tickets
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/forum"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	hmodels "github.com/goddeuce1/tg_bot_tz/internal/tickets/models"
+	"github.com/pkg/errors"
+)
+
+// IsGroupChat - у групп и супергрупп в телеграме отрицательные chat id
+func IsGroupChat(chatID int64) bool {
+	return chatID < 0
+}
+
+// EnsureTopic возвращает тему форума тикета в группе chatID, создавая ее при первом обращении
+func EnsureTopic(
+	ctx context.Context,
+	repo repository.Repository,
+	botAPI *tgbotapi.BotAPI,
+	ticket models.Ticket,
+	chatID int64,
+) (int, error) {
+	topic, err := repo.GetTicketTopic(ctx, ticket.ID)
+	if err == nil {
+		return topic.ThreadID, nil
+	}
+
+	if !errors.Is(err, models.ErrNotFound) {
+		return 0, errors.Wrap(err, "repo.GetTicketTopic")
+	}
+
+	threadID, err := forum.CreateTopic(botAPI, chatID, fmt.Sprintf("№%s %s", ticket.Reference, ticket.Name))
+	if err != nil {
+		return 0, errors.Wrap(err, "forum.CreateTopic")
+	}
+
+	newTopic := models.TicketTopic{
+		TicketID: ticket.ID,
+		ChatID:   chatID,
+		ThreadID: threadID,
+	}
+
+	if err = repo.SaveTicketTopic(ctx, newTopic); err != nil {
+		return 0, errors.Wrap(err, "repo.SaveTicketTopic")
+	}
+
+	return threadID, nil
+}
+
+// TicketThread возвращает группу и тему, куда зеркалируется переписка по тикету,
+// тема 0 - общий чат группы. false - подразделение работает через личные чаты админов
+func TicketThread(ctx context.Context, repo repository.Repository, ticket models.Ticket) (int64, int, bool, error) {
+	group, err := repo.GetUnitGroup(ctx, ticket.Unit)
+	if err != nil {
+		return 0, 0, false, errors.Wrap(err, "repo.GetUnitGroup")
+	}
+
+	if group.ChatID == nil {
+		return 0, 0, false, nil
+	}
+
+	if !group.Topics {
+		return *group.ChatID, 0, true, nil
+	}
+
+	// Тикет мог появиться до включения тем, тогда пишем в общий чат
+	topic, err := repo.GetTicketTopic(ctx, ticket.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return *group.ChatID, 0, true, nil
+		}
+
+		return 0, 0, false, errors.Wrap(err, "repo.GetTicketTopic")
+	}
+
+	return topic.ChatID, topic.ThreadID, true, nil
+}
+
+// ThreadLang - язык группы подразделения тикета для копий переписки, см. MirrorToThread
+func ThreadLang(ctx context.Context, repo repository.Repository, ticket models.Ticket) (string, error) {
+	group, err := repo.GetUnitGroup(ctx, ticket.Unit)
+	if err != nil {
+		return "", errors.Wrap(err, "repo.GetUnitGroup")
+	}
+
+	if group.ChatID == nil {
+		return i18n.Default, nil
+	}
+
+	lang, err := ChatLang(ctx, repo, *group.ChatID)
+	if err != nil {
+		return "", errors.Wrap(err, "ChatLang")
+	}
+
+	return lang, nil
+}
+
+// ticketAttachments возвращает сохраненные вложения тикета для повторной отправки
+func ticketAttachments(ctx context.Context, repo repository.Repository, ticketID uint64) ([]hmodels.Attachment, error) {
+	dbAttachments, err := repo.GetAttachments(ctx, ticketID)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetAttachments")
+	}
+
+	attachments := make([]hmodels.Attachment, 0, len(dbAttachments))
+	for _, v := range dbAttachments {
+		attachments = append(attachments, hmodels.Attachment{
+			Type:         v.Type,
+			FileID:       v.FileID,
+			FileUniqueID: v.FileUniqueID,
+			MediaGroupID: v.MediaGroupID,
+			FileName:     v.FileName,
+			MimeType:     v.MimeType,
+			FileSize:     v.FileSize,
+			Caption:      v.Caption,
+		})
+	}
+
+	return attachments, nil
+}
+
+// MirrorToThread дублирует сообщение переписки по тикету в группу подразделения,
+// если подразделение работает в группе. Возвращает группу и тему для копирования вложений
+func MirrorToThread(
+	ctx context.Context,
+	repo repository.Repository,
+	botAPI *tgbotapi.BotAPI,
+	ticket models.Ticket,
+	text string,
+	markup interface{},
+) (int64, int, bool, error) {
+	chatID, threadID, ok, err := TicketThread(ctx, repo, ticket)
+	if err != nil {
+		return 0, 0, false, errors.Wrap(err, "TicketThread")
+	}
+
+	if !ok {
+		return 0, 0, false, nil
+	}
+
+	if _, err = forum.SendMessage(botAPI, chatID, threadID, text, markup); err != nil {
+		return 0, 0, false, errors.Wrap(err, "forum.SendMessage")
+	}
+
+	return chatID, threadID, true, nil
+}
@@ -0,0 +1,19 @@
+package tickets
+
+import (
+	"context"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository"
+	"github.com/pkg/errors"
+)
+
+// ChatLang - язык, на котором пишем чату chatID. Нужен для сообщений
+// другим чатам: клиенту об ответе, админам о тикете
+func ChatLang(ctx context.Context, repo repository.Repository, chatID int64) (string, error) {
+	lang, err := repo.GetLanguage(ctx, chatID)
+	if err != nil {
+		return "", errors.Wrap(err, "repo.GetLanguage")
+	}
+
+	return i18n.Lang(lang), nil
+}
@@ -0,0 +1,58 @@
+package tickets
+
+import (
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+)
+
+// Лимит длины текста сообщения телеграма. Телеграм считает длину в UTF-16,
+// поэтому эмодзи и другие символы вне BMP занимают по два
+const messageLimit = 4096
+
+// textLength - длина text так, как ее считает телеграм
+func textLength(text string) int {
+	length := 0
+	for _, r := range text {
+		length += runeLength(r)
+	}
+
+	return length
+}
+
+func runeLength(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+
+	return 1
+}
+
+// fitText обрезает text, чтобы вместе с остальным сообщением длиной other
+// он влез в лимит, обрезанный текст заканчивается многоточием
+func fitText(text string, other int) string {
+	limit := messageLimit - other
+	if textLength(text) <= limit {
+		return text
+	}
+
+	length := 0
+	for i, r := range text {
+		// Одно место под многоточие
+		if length+runeLength(r) > limit-1 {
+			return text[:i] + "…"
+		}
+
+		length += runeLength(r)
+	}
+
+	return text
+}
+
+// fitMessage строит текст key на языке lang о тикете data, text - текст
+// переписки, он обрезается, чтобы сообщение влезло в лимит
+func fitMessage(lang string, key string, data TicketData, text string) string {
+	format := func(text string) string {
+		return i18n.T(lang, key, data.Args(i18n.Args{"text": text}))
+	}
+
+	return format(fitText(text, textLength(format(""))))
+}
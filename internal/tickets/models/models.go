@@ -1,8 +1,42 @@
 package models
 
 type Ticket struct {
+	// Номер тикета вида BILL-0042, выдается при отправке, по нему
+	// повторная доставка из кафки не создает дубль
+	Reference   string `json:"reference"`
 	ChatID      int64  `json:"chat_id"`
+	ClientName  string `json:"client_name"`
 	Unit        string `json:"unit"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
+
+	Fields      []FieldAnswer `json:"fields,omitempty"`
+	Attachments []Attachment  `json:"attachments,omitempty"`
+}
+
+// FieldAnswer - ответ клиента на дополнительное поле подразделения
+type FieldAnswer struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+const (
+	AttachmentPhoto    = "photo"
+	AttachmentDocument = "document"
+	AttachmentVoice    = "voice"
+	AttachmentVideo    = "video"
+)
+
+// Attachment - файл из телеграма, храним только file_id и метаданные.
+// Вложения с одинаковым MediaGroupID пришли одним альбомом
+type Attachment struct {
+	Type         string `json:"type"`
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	MediaGroupID string `json:"media_group_id,omitempty"`
+	FileName     string `json:"file_name,omitempty"`
+	MimeType     string `json:"mime_type,omitempty"`
+	FileSize     int    `json:"file_size,omitempty"`
+	Caption      string `json:"caption,omitempty"`
 }
@@ -0,0 +1,66 @@
+package tickets
+
+import (
+	"context"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/redis"
+	"github.com/pkg/errors"
+)
+
+// OnDutyAdmins возвращает чаты админов подразделения, которые сейчас на смене.
+// Если на смене никого нет, тикет не должен потеряться: отдаем руководителей
+// подразделения, а если нет и их - всех админов
+func OnDutyAdmins(
+	ctx context.Context,
+	repo repository.Repository,
+	presence redis.PresenceOperator,
+	unit string,
+) (map[int64]bool, error) {
+	admins, err := repo.GetAdmins(ctx, unit)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetAdmins")
+	}
+
+	chatIDs := make([]int64, 0, len(admins))
+	for _, v := range admins {
+		chatIDs = append(chatIDs, v.ChatID)
+	}
+
+	online, err := presence.GetOnline(ctx, chatIDs)
+	if err != nil {
+		return nil, errors.Wrap(err, "presence.GetOnline")
+	}
+
+	adminsMap := make(map[int64]bool)
+	for k, v := range online {
+		if v {
+			adminsMap[k] = true
+		}
+	}
+
+	if len(adminsMap) > 0 {
+		return adminsMap, nil
+	}
+
+	unitAdmins, err := repo.GetUnitAdmins(ctx, unit)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetUnitAdmins")
+	}
+
+	for _, v := range unitAdmins {
+		if v.Role != models.RoleAgent {
+			adminsMap[v.ChatID] = true
+		}
+	}
+
+	if len(adminsMap) > 0 {
+		return adminsMap, nil
+	}
+
+	for _, v := range chatIDs {
+		adminsMap[v] = true
+	}
+
+	return adminsMap, nil
+}
@@ -0,0 +1,117 @@
+package tickets
+
+import (
+	"context"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/redis"
+	"github.com/pkg/errors"
+	"sort"
+)
+
+// RouteTicket выбирает, кому из админов adminsMap предложить новый тикет.
+// При broadcast это все, при round_robin и least_loaded - один админ:
+// по очереди или с наименьшим числом незакрытых тикетов, среди равных - по очереди
+func RouteTicket(
+	ctx context.Context,
+	repo repository.Repository,
+	routing redis.RoutingOperator,
+	unitRouting models.UnitRouting,
+	adminsMap map[int64]bool,
+) (map[int64]bool, error) {
+	if unitRouting.Strategy == models.RoutingBroadcast || len(adminsMap) <= 1 {
+		return adminsMap, nil
+	}
+
+	// Порядок очереди не должен зависеть от порядка обхода map
+	candidates := make([]int64, 0, len(adminsMap))
+	for k := range adminsMap {
+		candidates = append(candidates, k)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i] < candidates[j]
+	})
+
+	if unitRouting.Strategy == models.RoutingLeastLoaded {
+		loads, err := repo.GetAssigneeLoads(ctx, unitRouting.Unit)
+		if err != nil {
+			return nil, errors.Wrap(err, "repo.GetAssigneeLoads")
+		}
+
+		loadsMap := make(map[int64]int, len(loads))
+		for _, v := range loads {
+			loadsMap[v.ChatID] = v.Open
+		}
+
+		minLoad := loadsMap[candidates[0]]
+		for _, v := range candidates {
+			minLoad = min(minLoad, loadsMap[v])
+		}
+
+		leastLoaded := make([]int64, 0, len(candidates))
+		for _, v := range candidates {
+			if loadsMap[v] == minLoad {
+				leastLoaded = append(leastLoaded, v)
+			}
+		}
+
+		candidates = leastLoaded
+	}
+
+	next, err := routing.NextRoundRobin(ctx, unitRouting.Unit)
+	if err != nil {
+		return nil, errors.Wrap(err, "routing.NextRoundRobin")
+	}
+
+	chosen := candidates[next%int64(len(candidates))]
+
+	return map[int64]bool{chosen: true}, nil
+}
+
+// AssignRouted назначает тикет агенту, которого выбрал RouteTicket. Остальные
+// увидят тикет, только если агент не возьмется за него до срока
+func AssignRouted(
+	ctx context.Context,
+	repo repository.Repository,
+	ticket models.Ticket,
+	routed map[int64]bool,
+) (*models.Ticket, error) {
+	if len(routed) != 1 || ticket.Assignee != nil {
+		return &ticket, nil
+	}
+
+	var chatID int64
+	for k := range routed {
+		chatID = k
+	}
+
+	admins, err := repo.GetUnitAdmins(ctx, ticket.Unit)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetUnitAdmins")
+	}
+
+	var name string
+	for _, v := range admins {
+		if v.ChatID == chatID {
+			name = v.Name
+		}
+	}
+
+	assigned, err := repo.AssignTicket(ctx, ticket.ID, chatID, name)
+	if err != nil {
+		// Тикет уже успели назначить, показываем его как есть
+		if errors.Is(err, models.ErrAlreadyAssigned) {
+			current, errGet := repo.GetTicket(ctx, ticket.ID)
+			if errGet != nil {
+				return nil, errors.Wrap(errGet, "repo.GetTicket")
+			}
+
+			return current, nil
+		}
+
+		return nil, errors.Wrap(err, "repo.AssignTicket")
+	}
+
+	return assigned, nil
+}
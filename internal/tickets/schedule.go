@@ -0,0 +1,79 @@
+package tickets
+
+import (
+	"context"
+	"fmt"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/goddeuce1/tg_bot_tz/internal/schedule"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+const (
+	// Формат времени открытия подразделения в автоответе
+	openLayout = "02.01 15:04"
+
+	textOffHoursReply = "offhours_reply"
+	textOpenUnknown   = "offhours_open_unknown"
+)
+
+// UnitSchedule возвращает расписание подразделения вместе с настройками из базы
+func UnitSchedule(ctx context.Context, repo repository.Repository, unit string) (schedule.Schedule, *models.UnitSchedule, error) {
+	unitSchedule, err := repo.GetUnitSchedule(ctx, unit)
+	if err != nil {
+		return schedule.Schedule{}, nil, errors.Wrap(err, "repo.GetUnitSchedule")
+	}
+
+	s, err := schedule.FromUnit(*unitSchedule)
+	if err != nil {
+		return schedule.Schedule{}, nil, errors.Wrap(err, "schedule.FromUnit")
+	}
+
+	return s, unitSchedule, nil
+}
+
+// OffHoursReply строит автоответ клиенту на его языке lang, если подразделение закрыто в момент now.
+// Свой автоответ подразделения не переводится. false - подразделение работает и автоответ не нужен
+func OffHoursReply(
+	ctx context.Context,
+	repo repository.Repository,
+	lang, unit, reference string,
+	now time.Time,
+) (string, bool, error) {
+	s, unitSchedule, err := UnitSchedule(ctx, repo, unit)
+	if err != nil {
+		return "", false, errors.Wrap(err, "UnitSchedule")
+	}
+
+	if s.IsOpen(now) {
+		return "", false, nil
+	}
+
+	open := i18n.Plain(lang, textOpenUnknown)
+	if opens, ok := s.NextOpen(now); ok {
+		open = opens.Format(openLayout)
+	}
+
+	open = fmt.Sprintf("%s (%s)", open, s.Location)
+
+	title, err := unitTitle(ctx, repo, lang, unit)
+	if err != nil {
+		return "", false, errors.Wrap(err, "unitTitle")
+	}
+
+	if unitSchedule.OffHoursReply == "" {
+		return i18n.T(lang, textOffHoursReply, i18n.Args{"ticket": reference, "unit": title, "open": open}), true, nil
+	}
+
+	// Свой автоответ подразделения пишет админ, подстановки в нем остались в прежнем виде
+	replacer := strings.NewReplacer(
+		"{ticket}", reference,
+		"{unit}", title,
+		"{open}", open,
+	)
+
+	return i18n.Escape(replacer.Replace(unitSchedule.OffHoursReply)), true, nil
+}
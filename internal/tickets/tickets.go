@@ -2,35 +2,69 @@ package tickets
 
 import (
 	"context"
-	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/goddeuce1/tg_bot_tz/internal/callbacks"
+	"github.com/goddeuce1/tg_bot_tz/internal/forum"
+	"github.com/goddeuce1/tg_bot_tz/internal/i18n"
 	"github.com/goddeuce1/tg_bot_tz/internal/repository"
 	"github.com/goddeuce1/tg_bot_tz/internal/repository/models"
+	"github.com/goddeuce1/tg_bot_tz/internal/repository/redis"
 	hmodels "github.com/goddeuce1/tg_bot_tz/internal/tickets/models"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+const (
+	textAdminTicket   = "admin_ticket"
+	textAdminField    = "admin_ticket_field"
+	textNoAssignee    = "admin_ticket_no_assignee"
+	textButtonTake    = "button_take"
+	textButtonReply   = "button_reply"
+	textClientMessage = "client_message"
+	textAdminReply    = "admin_reply"
+)
+
+// Как часто проверяем отложенные до открытия подразделения уведомления
+const deferredPollInterval = 30 * time.Second
+
+// Номер тикета есть во всех сообщениях бота о тикете, по нему определяем
+// к какому тикету относится ответ (reply) в чате
+var ticketReferenceRegexp = regexp.MustCompile(`№([A-Z0-9]+-\d+)`)
+
 type Handler interface {
 	Handle(ctx context.Context, data []byte) error
 }
 
 type handler struct {
-	repo   repository.Repository
-	botAPI *tgbotapi.BotAPI
-	logger *logrus.Logger
+	repo     repository.Repository
+	timers   redis.TimerOperator
+	presence redis.PresenceOperator
+	routing  redis.RoutingOperator
+	botAPI   *tgbotapi.BotAPI
+	logger   *logrus.Logger
 }
 
 func NewHandler(
 	repo repository.Repository,
+	timers redis.TimerOperator,
+	presence redis.PresenceOperator,
+	routing redis.RoutingOperator,
 	botAPI *tgbotapi.BotAPI,
 	logger *logrus.Logger,
 ) *handler {
 	return &handler{
-		repo:   repo,
-		botAPI: botAPI,
-		logger: logger,
+		repo:     repo,
+		timers:   timers,
+		presence: presence,
+		routing:  routing,
+		botAPI:   botAPI,
+		logger:   logger,
 	}
 }
 
@@ -41,34 +75,417 @@ func (h *handler) Handle(ctx context.Context, data []byte) error {
 		return errors.Wrap(err, "jsoniter.Unmarshal")
 	}
 
+	fields := make(models.FieldAnswers, 0, len(ticket.Fields))
+	for _, v := range ticket.Fields {
+		fields = append(fields, models.FieldAnswer{
+			Key:   v.Key,
+			Label: v.Label,
+			Value: v.Value,
+		})
+	}
+
+	s, _, err := UnitSchedule(ctx, h.repo, ticket.Unit)
+	if err != nil {
+		return errors.Wrap(err, "UnitSchedule")
+	}
+
+	// В нерабочее время не будим админов, уведомление уйдет к открытию, и SLA
+	// считается тоже с открытия. Если подразделение не откроется в ближайший год, уведомляем сразу
+	now := time.Now()
+	opens, ok := s.NextOpen(now)
+	deferred := ok && opens.After(now)
+
 	dbTicket := models.Ticket{
+		Reference:   ticket.Reference,
 		ChatID:      ticket.ChatID,
+		ClientName:  ticket.ClientName,
 		Unit:        ticket.Unit,
 		Name:        ticket.Name,
 		Description: ticket.Description,
+		Status:      models.StatusOpen,
+		Fields:      fields,
 	}
 
-	if err := h.repo.SaveTicket(ctx, dbTicket); err != nil {
+	slaStart := now
+	if deferred {
+		slaStart = opens
+		dbTicket.SLAStartedAt = &opens
+	}
+
+	id, err := h.repo.SaveTicket(ctx, dbTicket)
+	if err != nil {
 		return errors.Wrap(err, "repo.Save")
 	}
 
-	admins, err := h.repo.GetAdmins(ctx, ticket.Unit)
+	attachments := make([]models.Attachment, 0, len(ticket.Attachments))
+	for _, v := range ticket.Attachments {
+		attachments = append(attachments, models.Attachment{
+			TicketID:     id,
+			ChatID:       ticket.ChatID,
+			Type:         v.Type,
+			FileID:       v.FileID,
+			FileUniqueID: v.FileUniqueID,
+			MediaGroupID: v.MediaGroupID,
+			FileName:     v.FileName,
+			MimeType:     v.MimeType,
+			FileSize:     v.FileSize,
+			Caption:      v.Caption,
+		})
+	}
+
+	if err = h.repo.SaveAttachments(ctx, attachments); err != nil {
+		return errors.Wrap(err, "repo.SaveAttachments")
+	}
+
+	// Сроки SLA посчитает планировщик, ему достаточно первой проверки с начала отсчета
+	if err = h.timers.ScheduleSLA(ctx, id, slaStart); err != nil {
+		return errors.Wrap(err, "timers.ScheduleSLA")
+	}
+
+	if deferred {
+		if err = h.timers.ScheduleNotification(ctx, id, opens); err != nil {
+			return errors.Wrap(err, "timers.ScheduleNotification")
+		}
+
+		return nil
+	}
+
+	if err = h.notifyAdmins(ctx, id, false); err != nil {
+		return errors.Wrap(err, "notifyAdmins")
+	}
+
+	return nil
+}
+
+// StartDeferred рассылает отложенные уведомления: отложенные до открытия
+// подразделения и о тикетах, которые выбранный агент не взял вовремя
+func (h *handler) StartDeferred(ctx context.Context, gracefulWg *sync.WaitGroup) {
+	defer func() {
+		h.logger.Info("Shutting down deferred notifications")
+
+		gracefulWg.Done()
+	}()
+
+	ticker := time.NewTicker(deferredPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case now := <-ticker.C:
+			h.notifyDeferred(ctx, now)
+			h.notifyUnclaimed(ctx, now)
+		}
+	}
+}
+
+func (h *handler) notifyDeferred(ctx context.Context, now time.Time) {
+	ticketIDs, err := h.timers.PopDueNotifications(ctx, now)
 	if err != nil {
-		return errors.Wrap(err, "repo.GetAdmins")
+		h.logger.Errorf("Cannot pop notification timers, Error = %s", err)
+
+		return
 	}
 
-	adminsMap := make(map[int64]bool)
-	for _, v := range admins {
-		adminsMap[v.ChatID] = true
+	for _, v := range ticketIDs {
+		if err = h.notifyAdmins(ctx, v, false); err != nil {
+			h.logger.Errorf("Cannot notify admins about ticket ID = %d, Error = %s", v, err)
+
+			// Таймер уже снят, ставим заново, чтобы не потерять уведомление
+			if err = h.timers.ScheduleNotification(ctx, v, now.Add(deferredPollInterval)); err != nil {
+				h.logger.Errorf("Cannot reschedule notification of ticket ID = %d, Error = %s", v, err)
+			}
+		}
+	}
+}
+
+// notifyUnclaimed показывает всем на смене тикеты, которые выбранный агент не взял за отведенное время
+func (h *handler) notifyUnclaimed(ctx context.Context, now time.Time) {
+	ticketIDs, err := h.timers.PopDueClaims(ctx, now)
+	if err != nil {
+		h.logger.Errorf("Cannot pop claim timers, Error = %s", err)
+
+		return
+	}
+
+	for _, v := range ticketIDs {
+		if err = h.releaseUnclaimed(ctx, v); err == nil {
+			err = h.notifyAdmins(ctx, v, true)
+		}
+
+		if err != nil {
+			h.logger.Errorf("Cannot notify admins about unclaimed ticket ID = %d, Error = %s", v, err)
+
+			if err = h.timers.ScheduleClaim(ctx, v, now.Add(deferredPollInterval)); err != nil {
+				h.logger.Errorf("Cannot reschedule claim of ticket ID = %d, Error = %s", v, err)
+			}
+		}
+	}
+}
+
+// releaseUnclaimed снимает тикет с выбранного агента, если тот за него так и не взялся:
+// не ответил клиенту и не сменил статус. Тогда тикет сможет взять любой на смене
+func (h *handler) releaseUnclaimed(ctx context.Context, ticketID uint64) error {
+	ticket, err := h.repo.GetTicketSLA(ctx, ticketID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil
+		}
+
+		return errors.Wrap(err, "repo.GetTicketSLA")
+	}
+
+	if ticket.Assignee == nil || ticket.Status != models.StatusOpen || ticket.FirstResponseAt != nil {
+		return nil
+	}
+
+	released, err := h.repo.ReassignTicket(ctx, ticketID, nil, "")
+	if err != nil {
+		return errors.Wrap(err, "repo.ReassignTicket")
+	}
+
+	// У агента в уведомлении снова появляется кнопка "Взять"
+	if err = UpdateAdminMessages(ctx, h.repo, h.botAPI, *released); err != nil {
+		return errors.Wrap(err, "UpdateAdminMessages")
+	}
+
+	return nil
+}
+
+// notifyAdmins отправляет уведомление о тикете админам на смене, кому именно -
+// решает стратегия подразделения. broadcast - тикет не взяли вовремя, шлем всем на смене.
+// Повторный вызов не дублирует уже отправленные уведомления
+func (h *handler) notifyAdmins(ctx context.Context, ticketID uint64, broadcast bool) error {
+	// При повторной доставке тикет мог уже поменяться, берем актуальный
+	savedTicket, err := h.repo.GetTicket(ctx, ticketID)
+	if err != nil {
+		return errors.Wrap(err, "repo.GetTicket")
+	}
+
+	// Пока уведомление ждало, клиент мог закрыть заявку, а агент - взять ее
+	if savedTicket.Status == models.StatusClosed || broadcast && savedTicket.Assignee != nil {
+		return nil
+	}
+
+	notifications, err := h.repo.GetNotifications(ctx, ticketID)
+	if err != nil {
+		return errors.Wrap(err, "repo.GetNotifications")
+	}
+
+	notified := make(map[int64]bool)
+	for _, v := range notifications {
+		notified[v.ChatID] = true
+	}
+
+	responses, err := GetTopCannedResponses(ctx, h.repo, savedTicket.Unit)
+	if err != nil {
+		return errors.Wrap(err, "GetTopCannedResponses")
+	}
+
+	group, err := h.repo.GetUnitGroup(ctx, savedTicket.Unit)
+	if err != nil {
+		return errors.Wrap(err, "repo.GetUnitGroup")
+	}
+
+	// Подразделение работает в группе: одно уведомление на всех, без распределения по агентам
+	if group.ChatID != nil {
+		if notified[*group.ChatID] {
+			return nil
+		}
+
+		if err = h.notifyGroup(ctx, *savedTicket, *group, responses); err != nil {
+			return errors.Wrap(err, "notifyGroup")
+		}
+
+		return nil
+	}
+
+	adminsMap, err := OnDutyAdmins(ctx, h.repo, h.presence, savedTicket.Unit)
+	if err != nil {
+		return errors.Wrap(err, "OnDutyAdmins")
+	}
+
+	if !broadcast {
+		unitRouting, errRouting := h.repo.GetUnitRouting(ctx, savedTicket.Unit)
+		if errRouting != nil {
+			return errors.Wrap(errRouting, "repo.GetUnitRouting")
+		}
+
+		if unitRouting.Strategy != models.RoutingBroadcast {
+			// Тикет уже предложен агенту при прошлой доставке
+			if len(notified) > 0 {
+				return nil
+			}
+
+			// Таймер ставим до отправки, чтобы тикет не потерялся при падении
+			claimAt := time.Now().Add(time.Duration(unitRouting.ClaimTimeout) * time.Minute)
+			if err = h.timers.ScheduleClaim(ctx, ticketID, claimAt); err != nil {
+				return errors.Wrap(err, "timers.ScheduleClaim")
+			}
+
+			if adminsMap, err = RouteTicket(ctx, h.repo, h.routing, *unitRouting, adminsMap); err != nil {
+				return errors.Wrap(err, "RouteTicket")
+			}
+
+			if savedTicket, err = AssignRouted(ctx, h.repo, *savedTicket, adminsMap); err != nil {
+				return errors.Wrap(err, "AssignRouted")
+			}
+		}
+	}
+
+	attachments, err := ticketAttachments(ctx, h.repo, ticketID)
+	if err != nil {
+		return errors.Wrap(err, "ticketAttachments")
+	}
+
+	data, err := LoadTicketData(ctx, h.repo, *savedTicket)
+	if err != nil {
+		return errors.Wrap(err, "LoadTicketData")
 	}
 
 	for k, _ := range adminsMap {
-		text, markup := buildAdminMessageWithMarkup(ticket)
+		if notified[k] {
+			continue
+		}
+
+		lang, errLang := ChatLang(ctx, h.repo, k)
+		if errLang != nil {
+			return errors.Wrap(errLang, "ChatLang")
+		}
+
+		text, markup := BuildAdminMessageWithMarkup(lang, data, k, responses)
 
 		msgToSend := tgbotapi.NewMessage(k, text)
+		msgToSend.ParseMode = i18n.ParseMode()
 		msgToSend.ReplyMarkup = markup
 
-		if _, err = h.botAPI.Send(msgToSend); err != nil {
+		sent, errSend := h.botAPI.Send(msgToSend)
+		if errSend != nil {
+			return errors.Wrap(errSend, "botAPI.Send")
+		}
+
+		// Запоминаем уведомление, чтобы потом обновлять его у всех админов
+		notification := models.Notification{
+			TicketID:  savedTicket.ID,
+			ChatID:    k,
+			MessageID: sent.MessageID,
+		}
+
+		if err = h.repo.SaveNotification(ctx, notification); err != nil {
+			return errors.Wrap(err, "repo.SaveNotification")
+		}
+
+		if err = SendAttachments(h.botAPI, k, sent.MessageID, attachments); err != nil {
+			return errors.Wrap(err, "SendAttachments")
+		}
+	}
+
+	return nil
+}
+
+// notifyGroup отправляет уведомление о тикете в группу подразделения,
+// а если в группе включены темы - в новую тему тикета
+func (h *handler) notifyGroup(
+	ctx context.Context,
+	ticket models.Ticket,
+	group models.UnitGroup,
+	responses []models.CannedResponse,
+) error {
+	chatID := *group.ChatID
+
+	var (
+		threadID int
+		err      error
+	)
+
+	if group.Topics {
+		if threadID, err = EnsureTopic(ctx, h.repo, h.botAPI, ticket, chatID); err != nil {
+			return errors.Wrap(err, "EnsureTopic")
+		}
+	}
+
+	attachments, err := ticketAttachments(ctx, h.repo, ticket.ID)
+	if err != nil {
+		return errors.Wrap(err, "ticketAttachments")
+	}
+
+	lang, err := ChatLang(ctx, h.repo, chatID)
+	if err != nil {
+		return errors.Wrap(err, "ChatLang")
+	}
+
+	data, err := LoadTicketData(ctx, h.repo, ticket)
+	if err != nil {
+		return errors.Wrap(err, "LoadTicketData")
+	}
+
+	text, markup := BuildAdminMessageWithMarkup(lang, data, chatID, responses)
+
+	messageID, err := forum.SendMessage(h.botAPI, chatID, threadID, text, markup)
+	if err != nil {
+		return errors.Wrap(err, "forum.SendMessage")
+	}
+
+	notification := models.Notification{
+		TicketID:  ticket.ID,
+		ChatID:    chatID,
+		MessageID: messageID,
+	}
+
+	if err = h.repo.SaveNotification(ctx, notification); err != nil {
+		return errors.Wrap(err, "repo.SaveNotification")
+	}
+
+	if threadID == 0 {
+		if err = SendAttachments(h.botAPI, chatID, messageID, attachments); err != nil {
+			return errors.Wrap(err, "SendAttachments")
+		}
+
+		return nil
+	}
+
+	if err = forum.SendAttachments(h.botAPI, chatID, threadID, attachments); err != nil {
+		return errors.Wrap(err, "forum.SendAttachments")
+	}
+
+	return nil
+}
+
+// UpdateAdminMessages перерисовывает уведомления о тикете во всех чатах админов
+func UpdateAdminMessages(
+	ctx context.Context,
+	repo repository.Repository,
+	botAPI *tgbotapi.BotAPI,
+	ticket models.Ticket,
+) error {
+	notifications, err := repo.GetNotifications(ctx, ticket.ID)
+	if err != nil {
+		return errors.Wrap(err, "repo.GetNotifications")
+	}
+
+	responses, err := GetTopCannedResponses(ctx, repo, ticket.Unit)
+	if err != nil {
+		return errors.Wrap(err, "GetTopCannedResponses")
+	}
+
+	data, err := LoadTicketData(ctx, repo, ticket)
+	if err != nil {
+		return errors.Wrap(err, "LoadTicketData")
+	}
+
+	for _, v := range notifications {
+		lang, errLang := ChatLang(ctx, repo, v.ChatID)
+		if errLang != nil {
+			return errors.Wrap(errLang, "ChatLang")
+		}
+
+		text, markup := BuildAdminMessageWithMarkup(lang, data, v.ChatID, responses)
+
+		editMsg := tgbotapi.NewEditMessageTextAndMarkup(v.ChatID, v.MessageID, text, markup)
+		editMsg.ParseMode = i18n.ParseMode()
+		if _, err = botAPI.Send(editMsg); err != nil {
 			return errors.Wrap(err, "botAPI.Send")
 		}
 	}
@@ -76,22 +493,122 @@ func (h *handler) Handle(ctx context.Context, data []byte) error {
 	return nil
 }
 
-func buildAdminMessageWithMarkup(ticket hmodels.Ticket) (string, tgbotapi.InlineKeyboardMarkup) {
-	msg := `
-Пришло новое обращение:
+// TicketAdmins возвращает чаты админов, которым пишем по тикету:
+// исполнителя, если тикет взят, иначе всех админов подразделения
+func TicketAdmins(ctx context.Context, repo repository.Repository, ticket models.Ticket) (map[int64]bool, error) {
+	adminsMap := make(map[int64]bool)
 
-Название - %s
-Описание - %s
+	if ticket.Assignee != nil {
+		adminsMap[*ticket.Assignee] = true
 
-Необходимо ответить клиенту #%d`
+		return adminsMap, nil
+	}
 
-	msg = fmt.Sprintf(msg, ticket.Name, ticket.Description, ticket.ChatID)
+	admins, err := repo.GetAdmins(ctx, ticket.Unit)
+	if err != nil {
+		return nil, errors.Wrap(err, "repo.GetAdmins")
+	}
+
+	for _, v := range admins {
+		adminsMap[v.ChatID] = true
+	}
+
+	return adminsMap, nil
+}
+
+// BuildAdminMessageWithMarkup строит уведомление о тикете для админа adminChatID на его языке lang.
+// Пока тикет никто не взял, у всех есть кнопка "Взять", после - кнопки
+// ответа и смены статуса остаются только у исполнителя.
+// responses - топ шаблонов ответа из GetTopCannedResponses
+func BuildAdminMessageWithMarkup(
+	lang string,
+	data TicketData,
+	adminChatID int64,
+	responses []models.CannedResponse,
+) (string, tgbotapi.InlineKeyboardMarkup) {
+	ticket := data.Ticket
+
+	assignee := i18n.Plain(lang, textNoAssignee)
+	if ticket.Assignee != nil {
+		assignee = ticket.AssigneeName
+	}
+
+	var fields strings.Builder
+	for _, v := range ticket.Fields {
+		fields.WriteString(i18n.T(lang, textAdminField, i18n.Args{"label": v.Label, "value": v.Value}))
+	}
+
+	format := func(description string) string {
+		return i18n.T(lang, textAdminTicket, data.Args(i18n.Args{
+			"description": description,
+			"fields":      i18n.Safe(fields.String()),
+			"priority":    models.PriorityName(lang, ticket.Priority),
+			"status":      models.StatusName(lang, ticket.Status),
+			"assignee":    assignee,
+		}))
+	}
+
+	// Старые тикеты могли сохраниться с описанием длиннее лимита сообщения
+	msg := format(fitText(ticket.Description, textLength(format(""))))
+
+	ticketID := strconv.FormatUint(ticket.ID, 10)
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0)
+
+	// Пустая, но не nil клавиатура - так телеграм убирает кнопки при редактировании.
+	// В группе уведомление общее, кнопки остаются, исполнителя проверяет обработчик нажатия
+	if ticket.Assignee != nil && *ticket.Assignee != adminChatID && !IsGroupChat(adminChatID) {
+		return msg, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	}
+
+	if ticket.Assignee == nil {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(i18n.Plain(lang, textButtonTake), callbacks.Build(callbacks.ActionTake, ticketID)),
+		))
+	}
+
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(i18n.Plain(lang, textButtonReply), callbacks.Build(callbacks.ActionReply, ticketID)),
+	))
+
+	rows = append(rows, cannedResponsesRows(lang, ticket, responses)...)
+
+	for _, v := range models.NextStatuses(ticket.Status) {
+		data := callbacks.Build(callbacks.ActionStatus, ticketID, v)
+
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(models.StatusName(lang, v), data),
+		))
+	}
+
+	return msg, tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// BuildClientMessageWithMarkup строит сообщение клиента по тикету для пересылки админу
+func BuildClientMessageWithMarkup(lang string, data TicketData, text string) (string, tgbotapi.InlineKeyboardMarkup) {
+	msg := fitMessage(lang, textClientMessage, data, text)
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Fast Reply", "Hello, world!"),
+			tgbotapi.NewInlineKeyboardButtonData(
+				i18n.Plain(lang, textButtonReply), callbacks.Build(callbacks.ActionReply, strconv.FormatUint(data.Ticket.ID, 10)),
+			),
 		),
 	)
 
 	return msg, keyboard
 }
+
+// BuildAdminReply строит сообщение клиенту с ответом админа по тикету
+func BuildAdminReply(lang string, data TicketData, text string) string {
+	return fitMessage(lang, textAdminReply, data, text)
+}
+
+// ParseTicketReference достает номер тикета из текста сообщения бота
+func ParseTicketReference(text string) (string, bool) {
+	ss := ticketReferenceRegexp.FindStringSubmatch(text)
+	if len(ss) != 2 {
+		return "", false
+	}
+
+	return ss[1], true
+}
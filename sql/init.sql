@@ -1,18 +1,235 @@
-CREATE TYPE UNITS AS ENUM ('Поддержка', 'IT', 'Billing');
+CREATE TYPE TICKET_PRIORITY AS ENUM ('low', 'normal', 'high', 'urgent');
+
+-- Кому уходит новый тикет: всем на смене, по очереди или наименее загруженному агенту
+CREATE TYPE ROUTING_STRATEGY AS ENUM ('broadcast', 'round_robin', 'least_loaded');
+
+-- Подразделения заводятся админами в рантайме (/unit_add), name - отображаемое имя.
+-- Остальные таблицы ссылаются на name с ON UPDATE CASCADE, поэтому переименование безопасно
+CREATE TABLE units(
+    name TEXT PRIMARY KEY NOT NULL,
+    -- Префикс номеров тикетов и счетчик номеров
+    prefix TEXT NOT NULL UNIQUE,
+    counter INT NOT NULL DEFAULT 0,
+    description TEXT NOT NULL DEFAULT '',
+    -- Название для клиентов на других языках, {"en": "Support"}. Ключ подразделения -
+    -- name: по нему выбирают подразделение и ссылаются другие таблицы
+    names JSONB NOT NULL DEFAULT '{}',
+    position INT NOT NULL DEFAULT 0,
+    active BOOLEAN NOT NULL DEFAULT true,
+    -- Приоритет тикетов по умолчанию и кому эскалировать нарушения SLA
+    default_priority TICKET_PRIORITY NOT NULL DEFAULT 'normal',
+    supervisor_chat_id BIGINT,
+    -- Часовой пояс расписания и автоответ клиенту в нерабочее время ({ticket}, {unit}, {open})
+    timezone TEXT NOT NULL DEFAULT 'Europe/Moscow',
+    off_hours_reply TEXT NOT NULL DEFAULT '',
+    -- Если выбранный агент не взял тикет за claim_timeout_minutes, его видят все на смене
+    routing ROUTING_STRATEGY NOT NULL DEFAULT 'broadcast',
+    claim_timeout_minutes INT NOT NULL DEFAULT 15 CHECK (claim_timeout_minutes > 0),
+    -- Группа, куда уходят тикеты подразделения вместо личных чатов админов.
+    -- group_topics - на каждый тикет создается отдельная тема форума
+    group_chat_id BIGINT,
+    group_topics BOOLEAN NOT NULL DEFAULT false
+);
+
+INSERT INTO units(name, prefix, description, names, position, default_priority) VALUES
+    ('Поддержка', 'SUP', 'Общие вопросы', '{"en": "Support"}', 1, 'normal'),
+    ('IT', 'IT', 'Техника и доступы', '{}', 2, 'high'),
+    ('Billing', 'BILL', 'Счета и оплата', '{"ru": "Счета и оплата"}', 3, 'normal');
+
+-- Часы работы по дням недели (0 - воскресенье), дня нет - выходной.
+-- У подразделения без строк здесь нет расписания, оно работает круглосуточно
+CREATE TABLE unit_hours(
+    unit TEXT NOT NULL REFERENCES units(name) ON UPDATE CASCADE,
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    opens_at TIME NOT NULL,
+    closes_at TIME NOT NULL,
+    PRIMARY KEY(unit, weekday)
+);
+
+INSERT INTO unit_hours(unit, weekday, opens_at, closes_at)
+SELECT 'Billing', d, '09:00', '18:00' FROM generate_series(1, 5) AS d;
+
+-- Праздники и другие нерабочие дни вне недельного расписания
+CREATE TABLE unit_holidays(
+    unit TEXT NOT NULL REFERENCES units(name) ON UPDATE CASCADE,
+    day DATE NOT NULL,
+    PRIMARY KEY(unit, day)
+);
+
+CREATE TYPE FIELD_TYPE AS ENUM ('text', 'number', 'choice', 'date');
+
+-- Дополнительные поля опроса подразделения, спрашиваются после заголовка обращения.
+-- min_value и max_value - границы числа для number и длины для text, options - варианты для choice
+CREATE TABLE unit_fields(
+    id SERIAL PRIMARY KEY NOT NULL,
+    unit TEXT NOT NULL REFERENCES units(name) ON UPDATE CASCADE,
+    key TEXT NOT NULL,
+    label TEXT NOT NULL,
+    type FIELD_TYPE NOT NULL DEFAULT 'text',
+    required BOOLEAN NOT NULL DEFAULT true,
+    options TEXT[] NOT NULL DEFAULT '{}',
+    min_value NUMERIC,
+    max_value NUMERIC,
+    pattern TEXT NOT NULL DEFAULT '',
+    position INT NOT NULL DEFAULT 0,
+    UNIQUE(unit, key)
+);
+
+INSERT INTO unit_fields(unit, key, label, type, required, pattern, position) VALUES
+    ('Billing', 'invoice', 'Номер счета', 'text', true, '^[A-Za-z0-9-]+$', 1);
+
+INSERT INTO unit_fields(unit, key, label, type, required, options, position) VALUES
+    ('IT', 'os', 'Операционная система', 'choice', true, '{Windows,macOS,Linux,Другая}', 1);
+
+INSERT INTO unit_fields(unit, key, label, type, required, position) VALUES
+    ('IT', 'device', 'Устройство', 'text', false, 2);
+
+-- Цели SLA в минутах по приоритету: время до первого ответа и до решения
+CREATE TABLE sla_defaults(
+    priority TICKET_PRIORITY PRIMARY KEY NOT NULL,
+    first_response_minutes INT NOT NULL,
+    resolution_minutes INT NOT NULL
+);
+
+INSERT INTO sla_defaults(priority, first_response_minutes, resolution_minutes) VALUES
+    ('low', 480, 4320),
+    ('normal', 120, 1440),
+    ('high', 30, 480),
+    ('urgent', 10, 120);
+
+-- Цели SLA подразделения, если отличаются от sla_defaults
+CREATE TABLE sla_targets(
+    unit TEXT NOT NULL REFERENCES units(name) ON UPDATE CASCADE,
+    priority TICKET_PRIORITY NOT NULL,
+    first_response_minutes INT NOT NULL,
+    resolution_minutes INT NOT NULL,
+    PRIMARY KEY(unit, priority)
+);
+
+CREATE TYPE TICKET_STATUS AS ENUM ('open', 'in_progress', 'waiting_on_client', 'resolved', 'closed');
 
 CREATE TABLE tickets(
     id SERIAL PRIMARY KEY NOT NULL,
+    reference TEXT NOT NULL UNIQUE,
     chat_id BIGINT NOT NULL,
-    unit UNITS NOT NULL,
+    client_name TEXT NOT NULL DEFAULT '',
+    unit TEXT NOT NULL REFERENCES units(name) ON UPDATE CASCADE,
     name TEXT NOT NULL,
-    description TEXT NOT NULL
+    description TEXT NOT NULL,
+    status TICKET_STATUS NOT NULL DEFAULT 'open',
+    priority TICKET_PRIORITY NOT NULL DEFAULT 'normal',
+    assignee BIGINT,
+    assignee_name TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    first_response_at TIMESTAMPTZ,
+    resolved_at TIMESTAMPTZ,
+    -- Отсчет SLA: создание тикета, а если он пришел в нерабочее время - открытие подразделения
+    sla_started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- SLA не идет, пока тикет ждет ответа клиента
+    sla_paused_at TIMESTAMPTZ,
+    sla_paused_seconds INT NOT NULL DEFAULT 0,
+    first_response_escalated BOOLEAN NOT NULL DEFAULT false,
+    resolution_escalated BOOLEAN NOT NULL DEFAULT false,
+    -- Ответы на поля unit_fields: [{"key", "label", "value"}] в порядке опроса
+    fields JSONB NOT NULL DEFAULT '[]'
 );
 
 CREATE INDEX tickets_chat_id_idx ON tickets(chat_id);
 
+CREATE TABLE ticket_messages(
+    id SERIAL PRIMARY KEY NOT NULL,
+    ticket_id INT NOT NULL REFERENCES tickets(id),
+    chat_id BIGINT NOT NULL,
+    from_admin BOOLEAN NOT NULL,
+    text TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ticket_messages_ticket_id_idx ON ticket_messages(ticket_id);
+
+CREATE TYPE ATTACHMENT_TYPE AS ENUM ('photo', 'document', 'voice', 'video');
+
+CREATE TABLE ticket_attachments(
+    id SERIAL PRIMARY KEY NOT NULL,
+    ticket_id INT NOT NULL REFERENCES tickets(id),
+    chat_id BIGINT NOT NULL,
+    type ATTACHMENT_TYPE NOT NULL,
+    file_id TEXT NOT NULL,
+    file_unique_id TEXT NOT NULL,
+    media_group_id TEXT NOT NULL DEFAULT '',
+    file_name TEXT NOT NULL DEFAULT '',
+    mime_type TEXT NOT NULL DEFAULT '',
+    file_size INT NOT NULL DEFAULT 0,
+    caption TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE(ticket_id, file_unique_id)
+);
+
+CREATE TABLE ticket_notifications(
+    id SERIAL PRIMARY KEY NOT NULL,
+    ticket_id INT NOT NULL REFERENCES tickets(id),
+    chat_id BIGINT NOT NULL,
+    message_id INT NOT NULL
+);
+
+CREATE INDEX ticket_notifications_ticket_id_idx ON ticket_notifications(ticket_id);
+
+-- Тема форума группы подразделения, в которую зеркалируется переписка по тикету
+CREATE TABLE ticket_topics(
+    ticket_id INT PRIMARY KEY NOT NULL REFERENCES tickets(id),
+    chat_id BIGINT NOT NULL,
+    thread_id INT NOT NULL,
+    UNIQUE(chat_id, thread_id)
+);
+
+-- Порядок значений важен: роль выше - больше прав
+CREATE TYPE ADMIN_ROLE AS ENUM ('agent', 'supervisor', 'owner');
+
 CREATE TABLE admins(
     id SERIAL PRIMARY KEY NOT NULL,
     chat_id BIGINT NOT NULL,
-    unit UNITS NOT NULL,
+    unit TEXT NOT NULL REFERENCES units(name) ON UPDATE CASCADE,
+    role ADMIN_ROLE NOT NULL DEFAULT 'agent',
+    name TEXT NOT NULL DEFAULT '',
     UNIQUE(chat_id, unit)
-);
\ No newline at end of file
+);
+
+-- Одноразовые приглашения в подразделение, храним только sha256 от кода
+CREATE TABLE admin_invites(
+    token_hash TEXT PRIMARY KEY NOT NULL,
+    unit TEXT NOT NULL REFERENCES units(name) ON UPDATE CASCADE,
+    role ADMIN_ROLE NOT NULL,
+    -- NULL - приглашение создано при старте для подразделения без руководителя
+    created_by BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_by BIGINT,
+    used_at TIMESTAMPTZ
+);
+
+-- Журнал попыток входа по приглашению. Сам код не храним, даже неверный
+CREATE TABLE admin_login_attempts(
+    id SERIAL PRIMARY KEY NOT NULL,
+    chat_id BIGINT NOT NULL,
+    user_name TEXT NOT NULL DEFAULT '',
+    success BOOLEAN NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX admin_login_attempts_chat_id_idx ON admin_login_attempts(chat_id, created_at);
+
+CREATE TABLE canned_responses(
+    id SERIAL PRIMARY KEY NOT NULL,
+    unit TEXT NOT NULL REFERENCES units(name) ON UPDATE CASCADE,
+    title TEXT NOT NULL,
+    text TEXT NOT NULL,
+    uses INT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX canned_responses_unit_idx ON canned_responses(unit);
+
+INSERT INTO canned_responses(unit, title, text) VALUES
+    ('Поддержка', 'Приветствие', 'Здравствуйте, {client}! Мы получили обращение №{ticket} и уже работаем над ним.'),
+    ('IT', 'Приветствие', 'Здравствуйте, {client}! Мы получили обращение №{ticket} и уже работаем над ним.'),
+    ('Billing', 'Приветствие', 'Здравствуйте, {client}! Мы получили обращение №{ticket} и уже работаем над ним.');
\ No newline at end of file